@@ -2,8 +2,20 @@ package consts
 
 const (
 	ActivateScanOnNewImageFeatureEnvironmentVariable = "ACTIVATE_CVE_SCAN_ON_NEW_IMAGE_FEATURE"
+	AutoDiscoverCustomResourcesEnvironmentVariable   = "AUTO_DISCOVER_CUSTOM_RESOURCES"
+	CloudMetadataAPIFallbackEnvironmentVariable      = "CLOUD_METADATA_API_FALLBACK"
+	CloudMetadataAPIUrlEnvironmentVariable           = "CLOUD_METADATA_API_URL"
 	ConfigEnvironmentVariable                        = "CONFIG"
+	CustomResourcesEnvironmentVariable               = "CUSTOM_RESOURCES"
+	CustomResourcesStripFieldsEnvironmentVariable    = "CUSTOM_RESOURCES_STRIP_FIELDS"
+	EventsReasonsEnvironmentVariable                 = "EVENTS_REASONS"
+	EventsTypesEnvironmentVariable                   = "EVENTS_TYPES"
+	HashKeyEnvironmentVariable                       = "HASH_KEY"
 	NamespaceEnvironmentVariable                     = "NAMESPACE"
 	OtelCollectorSvcEnvironmentVariable              = "OTEL_COLLECTOR_SVC"
+	OwnerCacheTTLEnvironmentVariable                 = "OWNER_CACHE_TTL"
+	RedactArgumentsPatternsEnvironmentVariable       = "REDACT_ARGUMENTS_PATTERNS"
+	RedactExcludedNamespacesEnvironmentVariable      = "REDACT_EXCLUDED_NAMESPACES"
 	ReleaseBuildTagEnvironmentVariable               = "RELEASE"
+	ReportPolicyFileEnvironmentVariable              = "REPORT_POLICY_FILE"
 )
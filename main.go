@@ -93,21 +93,132 @@ func main() {
 		}
 	}()
 
+	go func() {
+		for {
+			wh.EndpointSliceWatch(ctx)
+		}
+	}()
+
 	go func() {
 		for {
 			wh.SecretWatch(ctx)
 		}
 	}()
+	go func() {
+		for {
+			wh.ServiceAccountWatch(ctx)
+		}
+	}()
 	go func() {
 		for {
 			wh.NamespaceWatch(ctx)
 		}
 	}()
+	go func() {
+		for {
+			wh.ResourceQuotaWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.LimitRangeWatch(ctx)
+		}
+	}()
 	go func() {
 		for {
 			wh.CronJobWatch(ctx)
 		}
 	}()
+	go func() {
+		for {
+			wh.DeploymentWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.StatefulSetWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.DaemonSetWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.JobWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.HorizontalPodAutoscalerWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.PodDisruptionBudgetWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.ValidatingWebhookConfigurationWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.MutatingWebhookConfigurationWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.CertificateSigningRequestWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.CustomResourceWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.CustomResourceDefinitionWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.CoreV1EventWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.EventsV1EventWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.PersistentVolumeWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.PersistentVolumeClaimWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.StorageClassWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.PriorityClassWatch(ctx)
+		}
+	}()
+	go func() {
+		for {
+			wh.RuntimeClassWatch(ctx)
+		}
+	}()
 	logger.L().Ctx(ctx).Fatal(wh.WebSocketHandle.SendReportRoutine(ctx, &isServerReady, wh.SetFirstReportFlag).Error())
 
 }
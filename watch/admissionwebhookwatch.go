@@ -0,0 +1,275 @@
+package watch
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	validatingWebhookConfigurationKind = "ValidatingWebhookConfiguration"
+	mutatingWebhookConfigurationKind   = "MutatingWebhookConfiguration"
+)
+
+// AdmissionWebhookConfigurationData a validating or mutating webhook configuration, without the CA bundles
+type AdmissionWebhookConfigurationData struct {
+	Kind              string                 `json:"kind"`
+	Name              string                 `json:"name"`
+	UID               string                 `json:"uid"`
+	Labels            map[string]string      `json:"labels,omitempty"`
+	CreationTimestamp string                 `json:"creationTimestamp"`
+	Webhooks          []AdmissionWebhookData `json:"webhooks"`
+}
+
+// AdmissionWebhookData a single webhook of a webhook configuration
+type AdmissionWebhookData struct {
+	Name               string                                       `json:"name"`
+	Rules              []admissionregistrationv1.RuleWithOperations `json:"rules,omitempty"`
+	FailurePolicy      string                                       `json:"failurePolicy,omitempty"`
+	MatchPolicy        string                                       `json:"matchPolicy,omitempty"`
+	SideEffects        string                                       `json:"sideEffects,omitempty"`
+	ReinvocationPolicy string                                       `json:"reinvocationPolicy,omitempty"`
+	TimeoutSeconds     *int32                                       `json:"timeoutSeconds,omitempty"`
+	NamespaceSelector  *metav1.LabelSelector                        `json:"namespaceSelector,omitempty"`
+	ObjectSelector     *metav1.LabelSelector                        `json:"objectSelector,omitempty"`
+	Service            *admissionregistrationv1.ServiceReference    `json:"service,omitempty"`
+	URL                string                                       `json:"url,omitempty"`
+	External           bool                                         `json:"external"`
+	Loopback           bool                                         `json:"loopback,omitempty"`
+}
+
+// ValidatingWebhookConfigurationWatch watch over validating webhook configurations
+func (wh *WatchHandler) ValidatingWebhookConfigurationWatch(ctx context.Context) {
+	wh.admissionWebhookWatch(ctx, validatingWebhookConfigurationKind, func() (watch.Interface, error) {
+		return wh.RestAPIClient.AdmissionregistrationV1().ValidatingWebhookConfigurations().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+// MutatingWebhookConfigurationWatch watch over mutating webhook configurations
+func (wh *WatchHandler) MutatingWebhookConfigurationWatch(ctx context.Context) {
+	wh.admissionWebhookWatch(ctx, mutatingWebhookConfigurationKind, func() (watch.Interface, error) {
+		return wh.RestAPIClient.AdmissionregistrationV1().MutatingWebhookConfigurations().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+func (wh *WatchHandler) admissionWebhookWatch(ctx context.Context, kind string, watchFunc func() (watch.Interface, error)) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER admissionWebhookWatch", helpers.String("kind", kind), helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	var lastWatchEventCreationTime time.Time
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over webhook configurations starting", helpers.String("kind", kind))
+		webhooksWatcher, err := watchFunc()
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over webhook configurations", helpers.String("kind", kind), helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		webhooksChan := webhooksWatcher.ResultChan()
+		logger.L().Info("Watching over webhook configurations started", helpers.String("kind", kind))
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-webhooksChan:
+			case <-newStateChan:
+				webhooksWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("webhook configurations watch chan loop", helpers.String("kind", kind), helpers.Interface("error", event.Object))
+				webhooksWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.admissionWebhookEventHandler(&event, lastWatchEventCreationTime); err != nil {
+				break ChanLoop
+			}
+		}
+		lastWatchEventCreationTime = time.Now()
+	}
+}
+
+func (wh *WatchHandler) admissionWebhookEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+	var data *AdmissionWebhookConfigurationData
+	var creationTimestamp time.Time
+	switch configuration := event.Object.(type) {
+	case *admissionregistrationv1.ValidatingWebhookConfiguration:
+		data, creationTimestamp = newValidatingWebhookConfigurationData(configuration), configuration.CreationTimestamp.Time
+	case *admissionregistrationv1.MutatingWebhookConfiguration:
+		data, creationTimestamp = newMutatingWebhookConfigurationData(configuration), configuration.CreationTimestamp.Time
+	default:
+		return fmt.Errorf("got unexpected webhook configuration from chan")
+	}
+	switch event.Type {
+	case watch.Added:
+		if creationTimestamp.Before(lastWatchEventCreationTime) {
+			return nil
+		}
+		id := CreateID()
+		wh.admissionwebhookdm.init(id)
+		wh.admissionwebhookdm.pushBack(id, data)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, ADMISSIONWEBHOOKS, CREATED)
+	case watch.Modified:
+		wh.updateAdmissionWebhook(data)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, ADMISSIONWEBHOOKS, UPDATED)
+	case watch.Deleted:
+		wh.removeAdmissionWebhook(data)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, ADMISSIONWEBHOOKS, DELETED)
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	}
+	return nil
+}
+
+func (wh *WatchHandler) updateAdmissionWebhook(data *AdmissionWebhookConfigurationData) {
+	for _, id := range wh.admissionwebhookdm.getIDs() {
+		front := wh.admissionwebhookdm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		stored, ok := front.Value.(*AdmissionWebhookConfigurationData)
+		if !ok {
+			continue
+		}
+		if stored.Kind == data.Kind && stored.Name == data.Name {
+			wh.admissionwebhookdm.updateFront(id, data)
+			return
+		}
+	}
+}
+
+func (wh *WatchHandler) removeAdmissionWebhook(data *AdmissionWebhookConfigurationData) string {
+	for _, id := range wh.admissionwebhookdm.getIDs() {
+		front := wh.admissionwebhookdm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		stored, ok := front.Value.(*AdmissionWebhookConfigurationData)
+		if !ok {
+			continue
+		}
+		if stored.Kind == data.Kind && stored.Name == data.Name {
+			wh.admissionwebhookdm.remove(id)
+			return data.Name
+		}
+	}
+	return ""
+}
+
+func newAdmissionWebhookConfigurationData(kind string, meta *metav1.ObjectMeta) *AdmissionWebhookConfigurationData {
+	return &AdmissionWebhookConfigurationData{
+		Kind:              kind,
+		Name:              meta.Name,
+		UID:               string(meta.UID),
+		Labels:            meta.Labels,
+		CreationTimestamp: meta.CreationTimestamp.Time.UTC().Format(time.RFC3339),
+		Webhooks:          []AdmissionWebhookData{},
+	}
+}
+
+func newValidatingWebhookConfigurationData(configuration *admissionregistrationv1.ValidatingWebhookConfiguration) *AdmissionWebhookConfigurationData {
+	data := newAdmissionWebhookConfigurationData(validatingWebhookConfigurationKind, &configuration.ObjectMeta)
+	for i := range configuration.Webhooks {
+		webhook := &configuration.Webhooks[i]
+		webhookData := AdmissionWebhookData{
+			Name:              webhook.Name,
+			Rules:             webhook.Rules,
+			TimeoutSeconds:    webhook.TimeoutSeconds,
+			NamespaceSelector: webhook.NamespaceSelector,
+			ObjectSelector:    webhook.ObjectSelector,
+		}
+		if webhook.FailurePolicy != nil {
+			webhookData.FailurePolicy = string(*webhook.FailurePolicy)
+		}
+		if webhook.MatchPolicy != nil {
+			webhookData.MatchPolicy = string(*webhook.MatchPolicy)
+		}
+		if webhook.SideEffects != nil {
+			webhookData.SideEffects = string(*webhook.SideEffects)
+		}
+		setWebhookClientConfig(&webhookData, &webhook.ClientConfig)
+		data.Webhooks = append(data.Webhooks, webhookData)
+	}
+	return data
+}
+
+func newMutatingWebhookConfigurationData(configuration *admissionregistrationv1.MutatingWebhookConfiguration) *AdmissionWebhookConfigurationData {
+	data := newAdmissionWebhookConfigurationData(mutatingWebhookConfigurationKind, &configuration.ObjectMeta)
+	for i := range configuration.Webhooks {
+		webhook := &configuration.Webhooks[i]
+		webhookData := AdmissionWebhookData{
+			Name:              webhook.Name,
+			Rules:             webhook.Rules,
+			TimeoutSeconds:    webhook.TimeoutSeconds,
+			NamespaceSelector: webhook.NamespaceSelector,
+			ObjectSelector:    webhook.ObjectSelector,
+		}
+		if webhook.FailurePolicy != nil {
+			webhookData.FailurePolicy = string(*webhook.FailurePolicy)
+		}
+		if webhook.MatchPolicy != nil {
+			webhookData.MatchPolicy = string(*webhook.MatchPolicy)
+		}
+		if webhook.SideEffects != nil {
+			webhookData.SideEffects = string(*webhook.SideEffects)
+		}
+		if webhook.ReinvocationPolicy != nil {
+			webhookData.ReinvocationPolicy = string(*webhook.ReinvocationPolicy)
+		}
+		setWebhookClientConfig(&webhookData, &webhook.ClientConfig)
+		data.Webhooks = append(data.Webhooks, webhookData)
+	}
+	return data
+}
+
+// setWebhookClientConfig sets the service or URL the webhook calls. The CA bundle is not reported
+func setWebhookClientConfig(webhookData *AdmissionWebhookData, clientConfig *admissionregistrationv1.WebhookClientConfig) {
+	webhookData.Service = clientConfig.Service
+	if clientConfig.URL != nil {
+		webhookData.URL = *clientConfig.URL
+		webhookData.Loopback = isLoopbackWebhookURL(webhookData.URL)
+		webhookData.External = !webhookData.Loopback && isExternalWebhookURL(webhookData.URL)
+	}
+}
+
+// isExternalWebhookURL returns true if the webhook URL does not point to an in-cluster service
+func isExternalWebhookURL(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Hostname() == "" {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	return !strings.HasSuffix(host, ".svc") && !strings.HasSuffix(host, ".svc.cluster.local")
+}
+
+// isLoopbackWebhookURL returns true if the webhook URL points to the API server host itself
+func isLoopbackWebhookURL(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	return host == "localhost"
+}
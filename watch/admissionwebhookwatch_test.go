@@ -0,0 +1,63 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsExternalWebhookURL(t *testing.T) {
+	assert.False(t, isExternalWebhookURL("https://webhook.kyverno.svc:443/validate"))
+	assert.False(t, isExternalWebhookURL("https://webhook.kyverno.svc.cluster.local/validate"))
+	assert.True(t, isExternalWebhookURL("https://hooks.example.com/mutate"))
+	assert.True(t, isExternalWebhookURL("https://34.12.1.9/mutate"))
+	assert.True(t, isExternalWebhookURL("::invalid"))
+}
+
+func TestIsLoopbackWebhookURL(t *testing.T) {
+	assert.True(t, isLoopbackWebhookURL("https://127.0.0.1:8443/mutate"))
+	assert.True(t, isLoopbackWebhookURL("https://127.10.0.3/mutate"))
+	assert.True(t, isLoopbackWebhookURL("https://[::1]:8443/mutate"))
+	assert.True(t, isLoopbackWebhookURL("https://LocalHost/mutate"))
+	assert.False(t, isLoopbackWebhookURL("https://webhook.kyverno.svc:443/validate"))
+	assert.False(t, isLoopbackWebhookURL("https://34.12.1.9/mutate"))
+	assert.False(t, isLoopbackWebhookURL("::invalid"))
+
+	webhookData := AdmissionWebhookData{}
+	loopbackURL := "https://[::1]:8443/mutate"
+	setWebhookClientConfig(&webhookData, &admissionregistrationv1.WebhookClientConfig{URL: &loopbackURL})
+	assert.True(t, webhookData.Loopback)
+	assert.False(t, webhookData.External)
+}
+
+func TestNewMutatingWebhookConfigurationData(t *testing.T) {
+	fail := admissionregistrationv1.Ignore
+	externalURL := "https://hooks.example.com/mutate"
+	configuration := &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "injector"},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{
+				Name:          "sidecar.example.com",
+				FailurePolicy: &fail,
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service:  &admissionregistrationv1.ServiceReference{Namespace: "injector", Name: "webhook"},
+					CABundle: []byte("ca"),
+				},
+			},
+			{
+				Name:         "external.example.com",
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{URL: &externalURL},
+			},
+		},
+	}
+	data := newMutatingWebhookConfigurationData(configuration)
+	assert.Equal(t, mutatingWebhookConfigurationKind, data.Kind)
+	assert.Len(t, data.Webhooks, 2)
+	assert.Equal(t, "Ignore", data.Webhooks[0].FailurePolicy)
+	assert.Equal(t, "webhook", data.Webhooks[0].Service.Name)
+	assert.False(t, data.Webhooks[0].External)
+	assert.Equal(t, externalURL, data.Webhooks[1].URL)
+	assert.True(t, data.Webhooks[1].External)
+}
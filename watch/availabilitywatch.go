@@ -0,0 +1,293 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	horizontalPodAutoscalerKind = "HorizontalPodAutoscaler"
+	podDisruptionBudgetKind     = "PodDisruptionBudget"
+)
+
+// HorizontalPodAutoscalerData a horizontal pod autoscaler and the microservice it scales
+type HorizontalPodAutoscalerData struct {
+	Name            string                                         `json:"name"`
+	Namespace       string                                         `json:"namespace"`
+	UID             string                                         `json:"uid"`
+	ScaleTargetRef  autoscalingv2.CrossVersionObjectReference      `json:"scaleTargetRef"`
+	MinReplicas     *int32                                         `json:"minReplicas,omitempty"`
+	MaxReplicas     int32                                          `json:"maxReplicas"`
+	CurrentReplicas int32                                          `json:"currentReplicas"`
+	DesiredReplicas int32                                          `json:"desiredReplicas"`
+	Metrics         []autoscalingv2.MetricSpec                     `json:"metrics,omitempty"`
+	Behavior        *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+	MicroService    *MicroServiceRef                               `json:"microService,omitempty"`
+}
+
+// PodDisruptionBudgetData a pod disruption budget and the microservices of the pods it selects
+type PodDisruptionBudgetData struct {
+	Name                       string                `json:"name"`
+	Namespace                  string                `json:"namespace"`
+	UID                        string                `json:"uid"`
+	Selector                   *metav1.LabelSelector `json:"selector,omitempty"`
+	MinAvailable               *intstr.IntOrString   `json:"minAvailable,omitempty"`
+	MaxUnavailable             *intstr.IntOrString   `json:"maxUnavailable,omitempty"`
+	UnhealthyPodEvictionPolicy string                `json:"unhealthyPodEvictionPolicy,omitempty"`
+	CurrentHealthy             int32                 `json:"currentHealthy"`
+	DesiredHealthy             int32                 `json:"desiredHealthy"`
+	ExpectedPods               int32                 `json:"expectedPods"`
+	DisruptionsAllowed         int32                 `json:"disruptionsAllowed"`
+	MicroServices              []MicroServiceRef     `json:"microServices,omitempty"`
+}
+
+// HorizontalPodAutoscalerWatch watch over autoscaling/v2 horizontal pod autoscalers
+func (wh *WatchHandler) HorizontalPodAutoscalerWatch(ctx context.Context) {
+	wh.availabilityWatch(ctx, horizontalPodAutoscalerKind, func() (watch.Interface, error) {
+		return wh.RestAPIClient.AutoscalingV2().HorizontalPodAutoscalers("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+// PodDisruptionBudgetWatch watch over policy/v1 pod disruption budgets
+func (wh *WatchHandler) PodDisruptionBudgetWatch(ctx context.Context) {
+	wh.availabilityWatch(ctx, podDisruptionBudgetKind, func() (watch.Interface, error) {
+		return wh.RestAPIClient.PolicyV1().PodDisruptionBudgets("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+func (wh *WatchHandler) availabilityWatch(ctx context.Context, kind string, watchFunc func() (watch.Interface, error)) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER availabilityWatch", helpers.String("kind", kind), helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	var lastWatchEventCreationTime time.Time
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over availability policies starting", helpers.String("kind", kind))
+		policiesWatcher, err := watchFunc()
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over availability policies", helpers.String("kind", kind), helpers.Error(err))
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		policiesChan := policiesWatcher.ResultChan()
+		logger.L().Info("Watching over availability policies started", helpers.String("kind", kind))
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-policiesChan:
+			case <-wh.microServices.subscribe(kind):
+				wh.refreshAvailabilityMicroServices(kind, wh.microServices.takeNamespaces(kind))
+				continue
+			case <-newStateChan:
+				policiesWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("availability policies watch chan loop", helpers.String("kind", kind), helpers.Interface("error", event.Object))
+				policiesWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.availabilityEventHandler(&event, lastWatchEventCreationTime); err != nil {
+				break ChanLoop
+			}
+		}
+		lastWatchEventCreationTime = time.Now()
+	}
+}
+
+func (wh *WatchHandler) availabilityEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+	var data interface{}
+	var rm *resourceMap
+	var jtype JsonType
+	var meta *metav1.ObjectMeta
+	switch policy := event.Object.(type) {
+	case *autoscalingv2.HorizontalPodAutoscaler:
+		data, rm, jtype, meta = wh.newHorizontalPodAutoscalerData(policy), wh.hpadm, HORIZONTALPODAUTOSCALERS, &policy.ObjectMeta
+	case *policyv1.PodDisruptionBudget:
+		data, rm, jtype, meta = wh.newPodDisruptionBudgetData(policy), wh.pdbdm, PODDISRUPTIONBUDGETS, &policy.ObjectMeta
+	default:
+		return fmt.Errorf("got unexpected availability policy from chan")
+	}
+	if !wh.isNamespaceWatched(meta.Namespace) {
+		return nil
+	}
+	switch event.Type {
+	case watch.Added:
+		if meta.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
+			return nil
+		}
+		id := CreateID()
+		rm.init(id)
+		rm.pushBack(id, uidObject{uid: string(meta.UID), data: data})
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, jtype, CREATED)
+	case watch.Modified:
+		updateUIDObject(rm, string(meta.UID), data)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, jtype, UPDATED)
+	case watch.Deleted:
+		removeUIDObject(rm, string(meta.UID))
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, jtype, DELETED)
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	}
+	return nil
+}
+
+// refreshAvailabilityMicroServices resolves again the microservices of the policies in the namespaces where a microservice got its first pod,
+// a policy may be reported before the pod watcher resolved the pods it covers
+func (wh *WatchHandler) refreshAvailabilityMicroServices(kind string, namespaces map[string]bool) {
+	rm, jtype := wh.hpadm, HORIZONTALPODAUTOSCALERS
+	if kind == podDisruptionBudgetKind {
+		rm, jtype = wh.pdbdm, PODDISRUPTIONBUDGETS
+	}
+	for _, id := range rm.getIDs() {
+		front := rm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		stored, ok := front.Value.(uidObject)
+		if !ok {
+			continue
+		}
+		var data interface{}
+		switch policy := stored.data.(type) {
+		case *HorizontalPodAutoscalerData:
+			if !namespaces[policy.Namespace] {
+				continue
+			}
+			// the reported data may still be queued, it is copied instead of updated
+			updated := *policy
+			updated.MicroService = wh.getScaledMicroService(policy.Namespace, policy.ScaleTargetRef)
+			if reflect.DeepEqual(policy.MicroService, updated.MicroService) {
+				continue
+			}
+			data = &updated
+		case *PodDisruptionBudgetData:
+			if !namespaces[policy.Namespace] {
+				continue
+			}
+			updated := *policy
+			updated.MicroServices = wh.getSelectedMicroServices(policy.Name, policy.Namespace, policy.Selector)
+			if reflect.DeepEqual(policy.MicroServices, updated.MicroServices) {
+				continue
+			}
+			data = &updated
+		default:
+			continue
+		}
+		rm.updateFront(id, uidObject{uid: stored.uid, data: data})
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, jtype, UPDATED)
+	}
+}
+
+// uidObject a reported object, stored by its UID
+type uidObject struct {
+	uid  string
+	data interface{}
+}
+
+func updateUIDObject(rm *resourceMap, uid string, data interface{}) {
+	for _, id := range rm.getIDs() {
+		front := rm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if stored, ok := front.Value.(uidObject); ok && stored.uid == uid {
+			rm.updateFront(id, uidObject{uid: uid, data: data})
+			return
+		}
+	}
+}
+
+func removeUIDObject(rm *resourceMap, uid string) {
+	for _, id := range rm.getIDs() {
+		front := rm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if stored, ok := front.Value.(uidObject); ok && stored.uid == uid {
+			rm.remove(id)
+			return
+		}
+	}
+}
+
+func (wh *WatchHandler) newHorizontalPodAutoscalerData(hpa *autoscalingv2.HorizontalPodAutoscaler) *HorizontalPodAutoscalerData {
+	data := &HorizontalPodAutoscalerData{
+		Name:            hpa.Name,
+		Namespace:       hpa.Namespace,
+		UID:             string(hpa.UID),
+		ScaleTargetRef:  hpa.Spec.ScaleTargetRef,
+		MinReplicas:     hpa.Spec.MinReplicas,
+		MaxReplicas:     hpa.Spec.MaxReplicas,
+		CurrentReplicas: hpa.Status.CurrentReplicas,
+		DesiredReplicas: hpa.Status.DesiredReplicas,
+		Metrics:         hpa.Spec.Metrics,
+		Behavior:        hpa.Spec.Behavior,
+	}
+	data.MicroService = wh.getScaledMicroService(hpa.Namespace, hpa.Spec.ScaleTargetRef)
+	return data
+}
+
+// getScaledMicroService returns the microservice scaled by a horizontal pod autoscaler, nil when its pods are not known
+func (wh *WatchHandler) getScaledMicroService(namespace string, target autoscalingv2.CrossVersionObjectReference) *MicroServiceRef {
+	// the microservices are reported by their uptree owner, so a deployment's pods are found by the deployment
+	if ref, ok := wh.microServices.getByOwner(namespace, target.Kind, target.Name); ok {
+		return &ref
+	}
+	return nil
+}
+
+func (wh *WatchHandler) newPodDisruptionBudgetData(pdb *policyv1.PodDisruptionBudget) *PodDisruptionBudgetData {
+	data := &PodDisruptionBudgetData{
+		Name:               pdb.Name,
+		Namespace:          pdb.Namespace,
+		UID:                string(pdb.UID),
+		Selector:           pdb.Spec.Selector,
+		MinAvailable:       pdb.Spec.MinAvailable,
+		MaxUnavailable:     pdb.Spec.MaxUnavailable,
+		CurrentHealthy:     pdb.Status.CurrentHealthy,
+		DesiredHealthy:     pdb.Status.DesiredHealthy,
+		ExpectedPods:       pdb.Status.ExpectedPods,
+		DisruptionsAllowed: pdb.Status.DisruptionsAllowed,
+	}
+	if pdb.Spec.UnhealthyPodEvictionPolicy != nil {
+		data.UnhealthyPodEvictionPolicy = string(*pdb.Spec.UnhealthyPodEvictionPolicy)
+	}
+	data.MicroServices = wh.getSelectedMicroServices(pdb.Name, pdb.Namespace, pdb.Spec.Selector)
+	return data
+}
+
+// getSelectedMicroServices returns the microservices of the pods selected by a pod disruption budget
+func (wh *WatchHandler) getSelectedMicroServices(name, namespace string, labelSelector *metav1.LabelSelector) []MicroServiceRef {
+	// a nil selector selects nothing, an empty selector selects all the pods of the namespace
+	if labelSelector == nil {
+		return nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		logger.L().Debug("invalid pod disruption budget selector", helpers.String("namespace", namespace), helpers.String("name", name), helpers.Error(err))
+		return nil
+	}
+	return wh.microServices.getBySelector(namespace, selector)
+}
@@ -0,0 +1,122 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func newAvailabilityTestWatchHandler() *WatchHandler {
+	wh := &WatchHandler{
+		hpadm:                  newResourceMap(),
+		pdbdm:                  newResourceMap(),
+		microServices:          newMicroServiceIndex(),
+		includeNamespaces:      []string{""},
+		aggregateFirstDataFlag: true,
+	}
+	wh.microServices.setPod("default", "nginx-1", map[string]string{"app": "nginx"}, MicroServiceRef{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"})
+	wh.microServices.setPod("default", "nginx-2", map[string]string{"app": "nginx"}, MicroServiceRef{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"})
+	wh.microServices.setPod("default", "redis-0", map[string]string{"app": "redis"}, MicroServiceRef{PodSpecId: 9, Namespace: "default", Kind: "StatefulSet", Name: "redis"})
+	wh.microServices.setPod("other", "nginx-1", map[string]string{"app": "nginx"}, MicroServiceRef{PodSpecId: 11, Namespace: "other", Kind: "Deployment", Name: "nginx"})
+	return wh
+}
+
+func TestHorizontalPodAutoscalerEventHandler(t *testing.T) {
+	wh := newAvailabilityTestWatchHandler()
+	minReplicas := int32(2)
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "hpa-uid"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "nginx"},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    10,
+		},
+		Status: autoscalingv2.HorizontalPodAutoscalerStatus{CurrentReplicas: 2, DesiredReplicas: 3},
+	}
+	assert.NoError(t, wh.availabilityEventHandler(&watch.Event{Type: watch.Added, Object: hpa}, time.Time{}))
+	assert.Equal(t, 1, wh.hpadm.len())
+	data := wh.jsonReport.HorizontalPodAutoscalers.Created[0].(*HorizontalPodAutoscalerData)
+	assert.Equal(t, int32(10), data.MaxReplicas)
+	assert.Equal(t, int32(3), data.DesiredReplicas)
+	assert.Equal(t, 7, data.MicroService.PodSpecId)
+
+	hpa.Spec.ScaleTargetRef.Name = "missing"
+	assert.NoError(t, wh.availabilityEventHandler(&watch.Event{Type: watch.Modified, Object: hpa}, time.Time{}))
+	assert.Nil(t, wh.jsonReport.HorizontalPodAutoscalers.Updated[0].(*HorizontalPodAutoscalerData).MicroService)
+
+	assert.NoError(t, wh.availabilityEventHandler(&watch.Event{Type: watch.Deleted, Object: hpa}, time.Time{}))
+	assert.Equal(t, 0, wh.hpadm.len())
+	assert.Len(t, wh.jsonReport.HorizontalPodAutoscalers.Deleted, 1)
+}
+
+func TestPodDisruptionBudgetEventHandler(t *testing.T) {
+	wh := newAvailabilityTestWatchHandler()
+	minAvailable := intstr.FromInt(1)
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "pdb-uid"},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+		},
+		Status: policyv1.PodDisruptionBudgetStatus{CurrentHealthy: 2, DesiredHealthy: 1, ExpectedPods: 2, DisruptionsAllowed: 1},
+	}
+	assert.NoError(t, wh.availabilityEventHandler(&watch.Event{Type: watch.Added, Object: pdb}, time.Time{}))
+	data := wh.jsonReport.PodDisruptionBudgets.Created[0].(*PodDisruptionBudgetData)
+	assert.Equal(t, []MicroServiceRef{{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"}}, data.MicroServices)
+	assert.Equal(t, int32(1), data.DisruptionsAllowed)
+
+	pdb.Spec.Selector = &metav1.LabelSelector{}
+	assert.NoError(t, wh.availabilityEventHandler(&watch.Event{Type: watch.Modified, Object: pdb}, time.Time{}))
+	data = wh.jsonReport.PodDisruptionBudgets.Updated[0].(*PodDisruptionBudgetData)
+	assert.Len(t, data.MicroServices, 2, "an empty selector selects all the pods of the namespace")
+
+	pdb.Spec.Selector = nil
+	assert.Empty(t, wh.newPodDisruptionBudgetData(pdb).MicroServices)
+}
+
+func TestRefreshAvailabilityMicroServices(t *testing.T) {
+	wh := newAvailabilityTestWatchHandler()
+	hpaChanged := wh.microServices.subscribe(horizontalPodAutoscalerKind)
+	pdbChanged := wh.microServices.subscribe(podDisruptionBudgetKind)
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", UID: "hpa-uid"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "api"},
+			MaxReplicas:    10,
+		},
+	}
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", UID: "pdb-uid"},
+		Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}}},
+	}
+	// the policies are reported before the pod watcher resolved their pods
+	assert.NoError(t, wh.availabilityEventHandler(&watch.Event{Type: watch.Added, Object: hpa}, time.Time{}))
+	assert.NoError(t, wh.availabilityEventHandler(&watch.Event{Type: watch.Added, Object: pdb}, time.Time{}))
+	created := wh.jsonReport.HorizontalPodAutoscalers.Created[0].(*HorizontalPodAutoscalerData)
+	assert.Nil(t, created.MicroService)
+	assert.Empty(t, wh.jsonReport.PodDisruptionBudgets.Created[0].(*PodDisruptionBudgetData).MicroServices)
+
+	ref := MicroServiceRef{PodSpecId: 13, Namespace: "default", Kind: "Deployment", Name: "api"}
+	wh.microServices.setPod("default", "api-1", map[string]string{"app": "api"}, ref)
+	<-hpaChanged
+	<-pdbChanged
+	wh.refreshAvailabilityMicroServices(horizontalPodAutoscalerKind, wh.microServices.takeNamespaces(horizontalPodAutoscalerKind))
+	wh.refreshAvailabilityMicroServices(podDisruptionBudgetKind, wh.microServices.takeNamespaces(podDisruptionBudgetKind))
+	assert.Len(t, wh.jsonReport.HorizontalPodAutoscalers.Updated, 1)
+	assert.Equal(t, &ref, wh.jsonReport.HorizontalPodAutoscalers.Updated[0].(*HorizontalPodAutoscalerData).MicroService)
+	assert.Nil(t, created.MicroService, "the reported data is not changed")
+	assert.Len(t, wh.jsonReport.PodDisruptionBudgets.Updated, 1)
+	assert.Equal(t, []MicroServiceRef{ref}, wh.jsonReport.PodDisruptionBudgets.Updated[0].(*PodDisruptionBudgetData).MicroServices)
+
+	// nothing changed, nothing is reported
+	wh.refreshAvailabilityMicroServices(horizontalPodAutoscalerKind, map[string]bool{"default": true})
+	wh.refreshAvailabilityMicroServices(podDisruptionBudgetKind, map[string]bool{"default": true})
+	assert.Len(t, wh.jsonReport.HorizontalPodAutoscalers.Updated, 1)
+	assert.Len(t, wh.jsonReport.PodDisruptionBudgets.Updated, 1)
+}
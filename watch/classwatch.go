@@ -0,0 +1,143 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// PriorityClassWatch watch over scheduling/v1 priority classes
+func (wh *WatchHandler) PriorityClassWatch(ctx context.Context) {
+	wh.classWatch(ctx, "PriorityClass", func() (watch.Interface, error) {
+		return wh.RestAPIClient.SchedulingV1().PriorityClasses().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+// RuntimeClassWatch watch over node.k8s.io/v1 runtime classes
+func (wh *WatchHandler) RuntimeClassWatch(ctx context.Context) {
+	wh.classWatch(ctx, "RuntimeClass", func() (watch.Interface, error) {
+		return wh.RestAPIClient.NodeV1().RuntimeClasses().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+func (wh *WatchHandler) classWatch(ctx context.Context, kind string, watchFunc func() (watch.Interface, error)) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER classWatch", helpers.String("kind", kind), helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	var lastWatchEventCreationTime time.Time
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over classes starting", helpers.String("kind", kind))
+		classesWatcher, err := watchFunc()
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over classes", helpers.String("kind", kind), helpers.Error(err))
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		classesChan := classesWatcher.ResultChan()
+		logger.L().Info("Watching over classes started", helpers.String("kind", kind))
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-classesChan:
+			case <-newStateChan:
+				classesWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("classes watch chan loop", helpers.String("kind", kind), helpers.Interface("error", event.Object))
+				classesWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.classEventHandler(&event, lastWatchEventCreationTime); err != nil {
+				break ChanLoop
+			}
+		}
+		lastWatchEventCreationTime = time.Now()
+	}
+}
+
+func (wh *WatchHandler) classEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+	var rm *resourceMap
+	var jtype JsonType
+	var meta *metav1.ObjectMeta
+	var obj metav1.Object
+	switch class := event.Object.(type) {
+	case *schedulingv1.PriorityClass:
+		rm, jtype, meta, obj = wh.priorityclassdm, PRIORITYCLASSES, &class.ObjectMeta, class
+	case *nodev1.RuntimeClass:
+		rm, jtype, meta, obj = wh.runtimeclassdm, RUNTIMECLASSES, &class.ObjectMeta, class
+	default:
+		return fmt.Errorf("got unexpected class from chan")
+	}
+	meta.ManagedFields = []metav1.ManagedFieldsEntry{}
+	removeLastAppliedConfiguration(meta)
+	switch event.Type {
+	case watch.Added:
+		// the classes are stored even if already reported, the pods are attributed by them
+		removeClusterScopedObject(rm, meta.Name)
+		id := CreateID()
+		rm.init(id)
+		rm.pushBack(id, obj)
+		if meta.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
+			return nil
+		}
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(obj, jtype, CREATED)
+	case watch.Modified:
+		updateClusterScopedObject(rm, meta.Name, obj)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(obj, jtype, UPDATED)
+	case watch.Deleted:
+		removeClusterScopedObject(rm, meta.Name)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(obj, jtype, DELETED)
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	}
+	return nil
+}
+
+// setPodClasses sets the priority class and the runtime class of a pod, as admitted by the API server
+func (wh *WatchHandler) setPodClasses(podData *PodDataForExistMicroService, pod *core.Pod) {
+	podData.PriorityClassName = pod.Spec.PriorityClassName
+	podData.Priority = pod.Spec.Priority
+	if pod.Spec.RuntimeClassName == nil {
+		return
+	}
+	podData.RuntimeClassName = *pod.Spec.RuntimeClassName
+	if runtimeClass := wh.getRuntimeClass(podData.RuntimeClassName); runtimeClass != nil {
+		podData.RuntimeHandler = runtimeClass.Handler
+	}
+}
+
+func (wh *WatchHandler) getRuntimeClass(name string) *nodev1.RuntimeClass {
+	if wh.runtimeclassdm == nil {
+		return nil
+	}
+	for _, id := range wh.runtimeclassdm.getIDs() {
+		front := wh.runtimeclassdm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if runtimeClass, ok := front.Value.(*nodev1.RuntimeClass); ok && runtimeClass.Name == name {
+			return runtimeClass
+		}
+	}
+	return nil
+}
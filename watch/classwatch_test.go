@@ -0,0 +1,53 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestSetPodClasses(t *testing.T) {
+	wh := &WatchHandler{
+		priorityclassdm:        newResourceMap(),
+		runtimeclassdm:         newResourceMap(),
+		aggregateFirstDataFlag: true,
+	}
+	defaultPriority := &schedulingv1.PriorityClass{ObjectMeta: metav1.ObjectMeta{Name: "default"}, Value: 100, GlobalDefault: true}
+	gvisor := &nodev1.RuntimeClass{ObjectMeta: metav1.ObjectMeta{Name: "gvisor"}, Handler: "runsc"}
+	assert.NoError(t, wh.classEventHandler(&watch.Event{Type: watch.Added, Object: defaultPriority}, time.Time{}))
+	assert.NoError(t, wh.classEventHandler(&watch.Event{Type: watch.Added, Object: gvisor}, time.Time{}))
+	assert.Equal(t, 1, wh.jsonReport.PriorityClasses.Len())
+	assert.Equal(t, 1, wh.jsonReport.RuntimeClasses.Len())
+
+	runtimeClassName := "gvisor"
+	pod := &core.Pod{Spec: core.PodSpec{RuntimeClassName: &runtimeClassName}}
+	podData := PodDataForExistMicroService{}
+	wh.setPodClasses(&podData, pod)
+	// the admission sets the default priority of the pod, it is not resolved from the watched classes
+	assert.Empty(t, podData.PriorityClassName)
+	assert.Nil(t, podData.Priority)
+	assert.Equal(t, "gvisor", podData.RuntimeClassName)
+	assert.Equal(t, "runsc", podData.RuntimeHandler)
+
+	priority := int32(1000000)
+	pod = &core.Pod{Spec: core.PodSpec{PriorityClassName: "system-node-critical", Priority: &priority}}
+	podData = PodDataForExistMicroService{}
+	wh.setPodClasses(&podData, pod)
+	assert.Equal(t, "system-node-critical", podData.PriorityClassName)
+	assert.Equal(t, priority, *podData.Priority)
+	assert.Empty(t, podData.RuntimeHandler)
+
+	// a class listed again after the watch is restarted is not reported, but is still stored
+	assert.NoError(t, wh.classEventHandler(&watch.Event{Type: watch.Added, Object: gvisor}, time.Now()))
+	assert.Equal(t, 1, wh.runtimeclassdm.len())
+	assert.Equal(t, 1, wh.jsonReport.RuntimeClasses.Len())
+
+	assert.NoError(t, wh.classEventHandler(&watch.Event{Type: watch.Deleted, Object: gvisor}, time.Time{}))
+	assert.Nil(t, wh.getRuntimeClass("gvisor"))
+}
@@ -1,10 +1,15 @@
 package watch
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strings"
 	"time"
+
+	"github.com/kubescape/kollector/consts"
 )
 
 var (
@@ -12,79 +17,216 @@ var (
 )
 
 const (
-	awsInstanceMetadataUrl   = "http://169.254.169.254/latest/meta-data/local-hostname"
-	gcpInstanceMetadataUrl   = "http://169.254.169.254/computeMetadata/v1/?alt=json&recursive=true"
-	azureInstanceMetadataUrl = "http://169.254.169.254/metadata/instance?api-version=2020-09-01"
+	defaultInstanceMetadataBaseUrl = "http://169.254.169.254"
+
+	awsTokenPath              = "/latest/api/token"
+	awsIdentityDocumentPath   = "/latest/dynamic/instance-identity/document"
+	awsClusterNameTagPath     = "/latest/meta-data/tags/instance/eks:cluster-name"
+	gcpInstanceMetadataPath   = "/computeMetadata/v1/?alt=json&recursive=true"
+	azureInstanceMetadataPath = "/metadata/instance?api-version=2021-02-01"
+
+	awsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	awsTokenHeader    = "X-aws-ec2-metadata-token"
+	awsTokenTTL       = "300"
+
+	azureClusterNameTag = "aks-managed-cluster-name"
 
 	awsVendorName   = "AWS"
 	gcpVendorName   = "GCP"
 	azureVendorName = "Azure"
 )
 
-func getAWSInstanceMetadata() (string, error) {
-	resp, err := httpClient.Get(awsInstanceMetadataUrl)
-	if err != nil {
-		return "", err
+// CloudMetadata the cloud vendor and the location of the cluster nodes
+type CloudMetadata struct {
+	Vendor       string `json:"vendor,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Zone         string `json:"zone,omitempty"`
+	InstanceType string `json:"instanceType,omitempty"`
+	// AccountID the AWS account, the GCP project or the Azure subscription
+	AccountID   string `json:"accountID,omitempty"`
+	ClusterName string `json:"clusterName,omitempty"`
+}
+
+// merge fills the missing fields from other
+func (cm *CloudMetadata) merge(other *CloudMetadata) {
+	if other == nil {
+		return
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&cm.Vendor, other.Vendor},
+		{&cm.Region, other.Region},
+		{&cm.Zone, other.Zone},
+		{&cm.InstanceType, other.InstanceType},
+		{&cm.AccountID, other.AccountID},
+		{&cm.ClusterName, other.ClusterName},
+	} {
+		if *f.dst == "" {
+			*f.dst = f.src
+		}
 	}
-	io.Copy(io.Discard, resp.Body)
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("http error: %s", resp.Status)
+}
+
+type instanceMetadataClient struct {
+	baseUrl    string
+	httpClient *http.Client
+}
+
+func newInstanceMetadataClient() *instanceMetadataClient {
+	baseUrl := os.Getenv(consts.CloudMetadataAPIUrlEnvironmentVariable)
+	if baseUrl == "" {
+		baseUrl = defaultInstanceMetadataBaseUrl
 	}
-	return awsVendorName, nil
+	return &instanceMetadataClient{baseUrl: strings.TrimSuffix(baseUrl, "/"), httpClient: &httpClient}
 }
 
-func getGCPInstanceMetadata() (string, error) {
-	req, err := http.NewRequest(http.MethodGet, gcpInstanceMetadataUrl, nil)
+func (c *instanceMetadataClient) do(method, path string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseUrl+path, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	req.Header.Add("Metadata-Flavor", "Google")
-	resp, err := httpClient.Do(req)
+	for k, v := range headers {
+		req.Header.Add(k, v)
+	}
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
 	}
-	io.Copy(io.Discard, resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("http error: %s", resp.Status)
+		return nil, fmt.Errorf("http error: %s", resp.Status)
 	}
-	return gcpVendorName, nil
+	return body, nil
 }
 
-func getAzureInstanceMetadata() (string, error) {
-	req, err := http.NewRequest(http.MethodGet, azureInstanceMetadataUrl, nil)
+// getAWSInstanceMetadata uses an IMDSv2 session token, falling back to IMDSv1 if the token is not available
+func (c *instanceMetadataClient) getAWSInstanceMetadata() (*CloudMetadata, error) {
+	headers := map[string]string{}
+	if token, err := c.do(http.MethodPut, awsTokenPath, map[string]string{awsTokenTTLHeader: awsTokenTTL}); err == nil {
+		headers[awsTokenHeader] = string(token)
+	}
+	body, err := c.do(http.MethodGet, awsIdentityDocumentPath, headers)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	req.Header.Add("Metadata", "true")
-	resp, err := httpClient.Do(req)
+	document := struct {
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		InstanceType     string `json:"instanceType"`
+		AccountID        string `json:"accountId"`
+	}{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+	metadata := &CloudMetadata{
+		Vendor:       awsVendorName,
+		Region:       document.Region,
+		Zone:         document.AvailabilityZone,
+		InstanceType: document.InstanceType,
+		AccountID:    document.AccountID,
+	}
+	// the instance tags are available only if enabled in the instance metadata options
+	if clusterName, err := c.do(http.MethodGet, awsClusterNameTagPath, headers); err == nil {
+		metadata.ClusterName = string(clusterName)
+	}
+	return metadata, nil
+}
+
+func (c *instanceMetadataClient) getGCPInstanceMetadata() (*CloudMetadata, error) {
+	body, err := c.do(http.MethodGet, gcpInstanceMetadataPath, map[string]string{"Metadata-Flavor": "Google"})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	document := struct {
+		Instance struct {
+			Zone        string            `json:"zone"`
+			MachineType string            `json:"machineType"`
+			Attributes  map[string]string `json:"attributes"`
+		} `json:"instance"`
+		Project struct {
+			ProjectID string `json:"projectId"`
+		} `json:"project"`
+	}{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
 	}
-	io.Copy(io.Discard, resp.Body)
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("http error: %s", resp.Status)
+	// the zone and the machine type are in the projects/<number>/zones/<zone> format
+	zone := lastPathElement(document.Instance.Zone)
+	metadata := &CloudMetadata{
+		Vendor:       gcpVendorName,
+		Zone:         zone,
+		InstanceType: lastPathElement(document.Instance.MachineType),
+		AccountID:    document.Project.ProjectID,
+		ClusterName:  document.Instance.Attributes["cluster-name"],
 	}
-	return azureVendorName, nil
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		metadata.Region = zone[:i]
+	}
+	return metadata, nil
 }
 
-func getInstanceMetadata() (string, error) {
-	if resp, err := getAzureInstanceMetadata(); err == nil {
-		return resp, nil
+func (c *instanceMetadataClient) getAzureInstanceMetadata() (*CloudMetadata, error) {
+	body, err := c.do(http.MethodGet, azureInstanceMetadataPath, map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
 	}
-	if resp, err := getGCPInstanceMetadata(); err == nil {
-		return resp, nil
+	document := struct {
+		Compute struct {
+			Location       string `json:"location"`
+			Zone           string `json:"zone"`
+			VMSize         string `json:"vmSize"`
+			SubscriptionID string `json:"subscriptionId"`
+			TagsList       []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"tagsList"`
+		} `json:"compute"`
+	}{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
 	}
-	if resp, err := getAWSInstanceMetadata(); err == nil {
-		return resp, nil
+	metadata := &CloudMetadata{
+		Vendor:       azureVendorName,
+		Region:       document.Compute.Location,
+		Zone:         document.Compute.Zone,
+		InstanceType: document.Compute.VMSize,
+		AccountID:    document.Compute.SubscriptionID,
 	}
-	return "", nil
+	for _, tag := range document.Compute.TagsList {
+		if tag.Name == azureClusterNameTag {
+			metadata.ClusterName = tag.Value
+		}
+	}
+	return metadata, nil
+}
+
+// getInstanceMetadata queries the instance metadata API of the vendor, or of all the supported vendors if the vendor is unknown
+func (c *instanceMetadataClient) getInstanceMetadata(vendor string) (*CloudMetadata, error) {
+	vendors := []struct {
+		name string
+		get  func() (*CloudMetadata, error)
+	}{
+		{azureVendorName, c.getAzureInstanceMetadata},
+		{gcpVendorName, c.getGCPInstanceMetadata},
+		{awsVendorName, c.getAWSInstanceMetadata},
+	}
+	for _, v := range vendors {
+		if vendor != "" && vendor != v.name {
+			continue
+		}
+		if metadata, err := v.get(); err == nil {
+			return metadata, nil
+		}
+	}
+	return nil, fmt.Errorf("instance metadata not found")
+}
+
+func lastPathElement(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
 }
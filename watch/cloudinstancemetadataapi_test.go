@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kubescape/kollector/consts"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestInstanceMetadataClient(t *testing.T, handler http.HandlerFunc) *instanceMetadataClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	t.Setenv(consts.CloudMetadataAPIUrlEnvironmentVariable, server.URL+"/")
+	return newInstanceMetadataClient()
+}
+
+func TestGetAWSInstanceMetadataIMDSv2(t *testing.T) {
+	c := newTestInstanceMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == awsTokenPath {
+			assert.Equal(t, awsTokenTTL, r.Header.Get(awsTokenTTLHeader))
+			w.Write([]byte("token"))
+			return
+		}
+		// IMDSv2 only
+		if r.Header.Get(awsTokenHeader) != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case awsIdentityDocumentPath:
+			w.Write([]byte(`{"region":"eu-west-1","availabilityZone":"eu-west-1b","instanceType":"m5.large","accountId":"123456789012"}`))
+		case awsClusterNameTagPath:
+			w.Write([]byte("prod"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	metadata, err := c.getInstanceMetadata(awsVendorName)
+	assert.NoError(t, err)
+	assert.Equal(t, &CloudMetadata{Vendor: awsVendorName, Region: "eu-west-1", Zone: "eu-west-1b", InstanceType: "m5.large", AccountID: "123456789012", ClusterName: "prod"}, metadata)
+}
+
+func TestGetAWSInstanceMetadataIMDSv1(t *testing.T) {
+	c := newTestInstanceMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut:
+			w.WriteHeader(http.StatusForbidden)
+		case r.URL.Path == awsIdentityDocumentPath:
+			w.Write([]byte(`{"region":"us-east-1","availabilityZone":"us-east-1a","instanceType":"t3.small","accountId":"210987654321"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	metadata, err := c.getAWSInstanceMetadata()
+	assert.NoError(t, err)
+	assert.Equal(t, &CloudMetadata{Vendor: awsVendorName, Region: "us-east-1", Zone: "us-east-1a", InstanceType: "t3.small", AccountID: "210987654321"}, metadata)
+}
+
+func TestGetGCPInstanceMetadata(t *testing.T) {
+	c := newTestInstanceMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"instance":{"zone":"projects/1234/zones/us-central1-a","machineType":"projects/1234/machineTypes/e2-medium","attributes":{"cluster-name":"gke-prod"}},"project":{"projectId":"my-project"}}`))
+	})
+	// the vendor is unknown, all the APIs are queried
+	metadata, err := c.getInstanceMetadata("")
+	assert.NoError(t, err)
+	assert.Equal(t, &CloudMetadata{Vendor: gcpVendorName, Region: "us-central1", Zone: "us-central1-a", InstanceType: "e2-medium", AccountID: "my-project", ClusterName: "gke-prod"}, metadata)
+}
+
+func TestGetAzureInstanceMetadata(t *testing.T) {
+	c := newTestInstanceMetadataClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/instance" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"compute":{"location":"westeurope","zone":"2","vmSize":"Standard_D4s_v3","subscriptionId":"sub","tagsList":[{"name":"aks-managed-cluster-name","value":"aks-prod"}]}}`))
+	})
+	metadata, err := c.getInstanceMetadata(azureVendorName)
+	assert.NoError(t, err)
+	assert.Equal(t, &CloudMetadata{Vendor: azureVendorName, Region: "westeurope", Zone: "2", InstanceType: "Standard_D4s_v3", AccountID: "sub", ClusterName: "aks-prod"}, metadata)
+
+	_, err = c.getInstanceMetadata(gcpVendorName)
+	assert.Error(t, err)
+}
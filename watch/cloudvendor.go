@@ -0,0 +1,138 @@
+package watch
+
+import (
+	"os"
+	"strings"
+
+	"github.com/armosec/utils-go/boolutils"
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/consts"
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	oracleVendorName       = "Oracle"
+	alibabaVendorName      = "Alibaba"
+	digitalOceanVendorName = "DigitalOcean"
+	ibmVendorName          = "IBM"
+	hetznerVendorName      = "Hetzner"
+	vSphereVendorName      = "vSphere"
+	openStackVendorName    = "OpenStack"
+
+	eksctlClusterNameLabel = "alpha.eksctl.io/cluster-name"
+)
+
+// providerIDVendors the spec.providerID prefixes set by the cloud controller managers
+var providerIDVendors = []struct {
+	prefix string
+	vendor string
+}{
+	{"aws://", awsVendorName},
+	{"gce://", gcpVendorName},
+	{"azure://", azureVendorName},
+	{"oci://", oracleVendorName},
+	{"ocid1.", oracleVendorName},
+	{"alicloud://", alibabaVendorName},
+	{"digitalocean://", digitalOceanVendorName},
+	{"ibm://", ibmVendorName},
+	{"hcloud://", hetznerVendorName},
+	{"vsphere://", vSphereVendorName},
+	{"openstack://", openStackVendorName},
+}
+
+// labelVendors node labels set only by a specific cloud
+var labelVendors = []struct {
+	label  string
+	vendor string
+}{
+	{"eks.amazonaws.com/nodegroup", awsVendorName},
+	{"cloud.google.com/gke-nodepool", gcpVendorName},
+	{"kubernetes.azure.com/cluster", azureVendorName},
+	{"oci.oraclecloud.com/fault-domain", oracleVendorName},
+	{"alibabacloud.com/nodepool-id", alibabaVendorName},
+	{"doks.digitalocean.com/node-id", digitalOceanVendorName},
+	{"ibm-cloud.kubernetes.io/worker-id", ibmVendorName},
+	{"csi.hetzner.cloud/location", hetznerVendorName},
+}
+
+// getCloudMetadata detects the cloud vendor and the location by the nodes, completed by the instance metadata APIs if enabled. The result is cached once detected
+func (wh *WatchHandler) getCloudMetadata(nodes []core.Node) *CloudMetadata {
+	if wh.cloudMetadataDetected {
+		return wh.cloudMetadata
+	}
+	if len(nodes) == 0 {
+		// the nodes were not listed, try again on the next watch
+		return nil
+	}
+	wh.cloudMetadataDetected = true
+	metadata := &CloudMetadata{Vendor: detectCloudVendor(nodes)}
+	metadata.merge(nodeCloudLocation(&nodes[0]))
+	if isInstanceMetadataFallbackEnabled() && hasInstanceMetadataAPI(metadata.Vendor) {
+		instanceMetadata, err := newInstanceMetadataClient().getInstanceMetadata(metadata.Vendor)
+		if err != nil {
+			logger.L().Debug("failed to get the instance metadata", helpers.String("cloudVendor", metadata.Vendor), helpers.Error(err))
+		}
+		metadata.merge(instanceMetadata)
+	}
+	if metadata.Vendor == "" {
+		return nil
+	}
+	return metadata
+}
+
+// hasInstanceMetadataAPI returns true if the instance metadata API of the vendor is supported, an unknown vendor is looked up in all the APIs
+// only when the fallback is enabled
+func hasInstanceMetadataAPI(vendor string) bool {
+	switch vendor {
+	case "", awsVendorName, gcpVendorName, azureVendorName:
+		return true
+	}
+	return false
+}
+
+// isInstanceMetadataFallbackEnabled returns true when the instance metadata APIs are enabled explicitly,
+// they are link local addresses which may be served by anything on the nodes of an unknown vendor
+func isInstanceMetadataFallbackEnabled() bool {
+	value := os.Getenv(consts.CloudMetadataAPIFallbackEnvironmentVariable)
+	if value == "" {
+		return false
+	}
+	return boolutils.StringToBool(value)
+}
+
+// detectCloudVendor detects the cloud vendor by the nodes provider IDs and well known labels
+func detectCloudVendor(nodes []core.Node) string {
+	for i := range nodes {
+		if vendor := nodeCloudVendor(&nodes[i]); vendor != "" {
+			logger.L().Debug("cloud vendor detected by node", helpers.String("node", nodes[i].Name), helpers.String("cloudVendor", vendor))
+			return vendor
+		}
+	}
+	return ""
+}
+
+// nodeCloudLocation returns the region, zone and instance type by the well known node labels
+func nodeCloudLocation(node *core.Node) *CloudMetadata {
+	return &CloudMetadata{
+		Region:       node.Labels[core.LabelTopologyRegion],
+		Zone:         node.Labels[core.LabelTopologyZone],
+		InstanceType: node.Labels[core.LabelInstanceTypeStable],
+		ClusterName:  node.Labels[eksctlClusterNameLabel],
+	}
+}
+
+func nodeCloudVendor(node *core.Node) string {
+	providerID := strings.ToLower(node.Spec.ProviderID)
+	for _, p := range providerIDVendors {
+		if strings.HasPrefix(providerID, p.prefix) {
+			return p.vendor
+		}
+	}
+	for _, l := range labelVendors {
+		if _, ok := node.Labels[l.label]; ok {
+			return l.vendor
+		}
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/kubescape/kollector/consts"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeCloudVendor(t *testing.T) {
+	tests := []struct {
+		name       string
+		providerID string
+		labels     map[string]string
+		expected   string
+	}{
+		{name: "aws", providerID: "aws:///us-east-1a/i-0123456789abcdef0", expected: awsVendorName},
+		{name: "gcp", providerID: "gce://project/us-central1-a/node-1", expected: gcpVendorName},
+		{name: "azure", providerID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm", expected: azureVendorName},
+		{name: "oracle", providerID: "ocid1.instance.oc1.iad.abc", expected: oracleVendorName},
+		{name: "alibaba", providerID: "alicloud://cn-hangzhou.i-abc", expected: alibabaVendorName},
+		{name: "digitalocean", providerID: "digitalocean://123456", expected: digitalOceanVendorName},
+		{name: "ibm", providerID: "ibm://account///cluster/worker", expected: ibmVendorName},
+		{name: "hetzner", providerID: "hcloud://123456", expected: hetznerVendorName},
+		{name: "vsphere", providerID: "vsphere://4237b5b2-a5d0-4b43-9b1a-24a1f2b1d6c3", expected: vSphereVendorName},
+		{name: "openstack", providerID: "openstack:///9d9d3b5c-4c6c-4a8b-9b6b-5b0b1d1a2c3d", expected: openStackVendorName},
+		{name: "label", labels: map[string]string{"doks.digitalocean.com/node-id": "abc"}, expected: digitalOceanVendorName},
+		{name: "kind", providerID: "kind://docker/kind/kind-control-plane", expected: ""},
+		{name: "bare metal", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &core.Node{ObjectMeta: metav1.ObjectMeta{Labels: tt.labels}, Spec: core.NodeSpec{ProviderID: tt.providerID}}
+			assert.Equal(t, tt.expected, nodeCloudVendor(node))
+		})
+	}
+}
+
+func TestGetCloudMetadata(t *testing.T) {
+	t.Setenv(consts.CloudMetadataAPIFallbackEnvironmentVariable, "false")
+	wh := &WatchHandler{}
+
+	// the nodes were not listed, the detection is retried
+	assert.Nil(t, wh.getCloudMetadata(nil))
+	assert.False(t, wh.cloudMetadataDetected)
+
+	nodes := []core.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+				core.LabelTopologyRegion:     "fsn1",
+				core.LabelTopologyZone:       "fsn1-dc14",
+				core.LabelInstanceTypeStable: "cx21",
+			}},
+		},
+		{Spec: core.NodeSpec{ProviderID: "hcloud://123456"}},
+	}
+	wh.cloudMetadata = wh.getCloudMetadata(nodes)
+	assert.Equal(t, &CloudMetadata{Vendor: hetznerVendorName, Region: "fsn1", Zone: "fsn1-dc14", InstanceType: "cx21"}, wh.cloudMetadata)
+	assert.True(t, wh.cloudMetadataDetected)
+
+	// cached once detected
+	assert.Equal(t, hetznerVendorName, wh.getCloudMetadata([]core.Node{{Spec: core.NodeSpec{ProviderID: "aws:///us-east-1a/i-0"}}}).Vendor)
+
+	// no vendor and no fallback
+	wh = &WatchHandler{}
+	assert.Nil(t, wh.getCloudMetadata([]core.Node{{Spec: core.NodeSpec{}}}))
+	assert.True(t, wh.cloudMetadataDetected)
+
+	// the fallback is disabled by default
+	t.Setenv(consts.CloudMetadataAPIFallbackEnvironmentVariable, "")
+	assert.False(t, isInstanceMetadataFallbackEnabled())
+}
@@ -0,0 +1,141 @@
+package watch
+
+import (
+	"strings"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+const (
+	DistributionEKS       = "EKS"
+	DistributionGKE       = "GKE"
+	DistributionAKS       = "AKS"
+	DistributionOpenShift = "OpenShift"
+	DistributionK3s       = "k3s"
+	DistributionRKE2      = "RKE2"
+	DistributionKind      = "kind"
+	DistributionMinikube  = "minikube"
+	DistributionTalos     = "Talos"
+
+	// number of nodes checked for the distribution and cloud vendor labels
+	clusterIdentityNodesLimit = 5
+	// openShiftNamespace a namespace created by every OpenShift cluster
+	openShiftNamespace = "openshift-apiserver"
+)
+
+// ClusterIdentity the stable identity and the distribution of the cluster
+type ClusterIdentity struct {
+	// UID the kube-system namespace UID, stable for the cluster lifetime
+	UID          string `json:"uid,omitempty"`
+	Distribution string `json:"distribution,omitempty"`
+}
+
+// distributionNodeLabels node labels set only by a specific distribution
+var distributionNodeLabels = []struct {
+	label        string
+	distribution string
+}{
+	{"eks.amazonaws.com/nodegroup", DistributionEKS},
+	{"eks.amazonaws.com/compute-type", DistributionEKS},
+	{"cloud.google.com/gke-nodepool", DistributionGKE},
+	{"cloud.google.com/gke-os-distribution", DistributionGKE},
+	{"kubernetes.azure.com/cluster", DistributionAKS},
+	{"kubernetes.azure.com/agentpool", DistributionAKS},
+	{"node.openshift.io/os_id", DistributionOpenShift},
+	{"minikube.k8s.io/name", DistributionMinikube},
+	{"node.kubernetes.io/instance-type=k3s", DistributionK3s},
+	{"node.kubernetes.io/instance-type=rke2", DistributionRKE2},
+}
+
+// listNodesSample lists a few nodes, used for detecting the distribution and the cloud vendor
+func (wh *WatchHandler) listNodesSample() []core.Node {
+	nodeList, err := wh.RestAPIClient.CoreV1().Nodes().List(globalHTTPContext, metav1.ListOptions{Limit: clusterIdentityNodesLimit})
+	if err != nil {
+		logger.L().Warning("failed to list nodes for the cluster detection", helpers.Error(err))
+		return nil
+	}
+	return nodeList.Items
+}
+
+// getClusterIdentity returns the cluster UID and detects the cluster distribution. The result is cached once the UID is found and the nodes are listed
+func (wh *WatchHandler) getClusterIdentity(serverVersion *version.Info, nodes []core.Node) *ClusterIdentity {
+	if wh.clusterIdentityDetected {
+		return wh.clusterIdentity
+	}
+	identity := &ClusterIdentity{}
+	if kubeSystem, err := wh.RestAPIClient.CoreV1().Namespaces().Get(globalHTTPContext, metav1.NamespaceSystem, metav1.GetOptions{}); err == nil {
+		identity.UID = string(kubeSystem.UID)
+	} else {
+		logger.L().Warning("failed to get the cluster UID", helpers.Error(err))
+	}
+
+	var namespaces []string
+	if _, err := wh.RestAPIClient.CoreV1().Namespaces().Get(globalHTTPContext, openShiftNamespace, metav1.GetOptions{}); err == nil {
+		namespaces = append(namespaces, openShiftNamespace)
+	} else if !errors.IsNotFound(err) {
+		logger.L().Warning("failed to get the namespace for the distribution detection", helpers.String("namespace", openShiftNamespace), helpers.Error(err))
+	}
+	identity.Distribution = detectDistribution(serverVersion, nodes, namespaces)
+	wh.clusterIdentityDetected = identity.UID != "" && len(nodes) > 0
+	logger.L().Info("K8s cluster identity", helpers.String("uid", identity.UID), helpers.String("distribution", identity.Distribution))
+	return identity
+}
+
+// detectDistribution detects the distribution by the API server version, the node labels, provider IDs and OS images and the existing well known namespaces
+func detectDistribution(serverVersion *version.Info, nodes []core.Node, namespaces []string) string {
+	if serverVersion != nil {
+		gitVersion := strings.ToLower(serverVersion.GitVersion)
+		switch {
+		case strings.Contains(gitVersion, "-eks-"):
+			return DistributionEKS
+		case strings.Contains(gitVersion, "-gke."):
+			return DistributionGKE
+		case strings.Contains(gitVersion, "+k3s"):
+			return DistributionK3s
+		case strings.Contains(gitVersion, "+rke2"):
+			return DistributionRKE2
+		}
+	}
+	for i := range nodes {
+		if distribution := nodeDistribution(&nodes[i]); distribution != "" {
+			return distribution
+		}
+	}
+	for _, namespace := range namespaces {
+		if strings.HasPrefix(namespace, "openshift-") {
+			return DistributionOpenShift
+		}
+	}
+	return ""
+}
+
+func nodeDistribution(node *core.Node) string {
+	for _, l := range distributionNodeLabels {
+		key, value, hasValue := strings.Cut(l.label, "=")
+		if nodeValue, ok := node.Labels[key]; ok && (!hasValue || nodeValue == value) {
+			return l.distribution
+		}
+	}
+	providerID := strings.ToLower(node.Spec.ProviderID)
+	switch {
+	case strings.HasPrefix(providerID, "kind://"):
+		return DistributionKind
+	case strings.HasPrefix(providerID, "k3s://"):
+		return DistributionK3s
+	}
+	if strings.HasPrefix(node.Status.NodeInfo.OSImage, "Talos") {
+		return DistributionTalos
+	}
+	if strings.Contains(node.Status.NodeInfo.KubeletVersion, "+k3s") {
+		return DistributionK3s
+	}
+	if strings.Contains(node.Status.NodeInfo.KubeletVersion, "+rke2") {
+		return DistributionRKE2
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDetectDistribution(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverVersion *version.Info
+		node          core.Node
+		namespaces    []string
+		expected      string
+	}{
+		{name: "EKS version", serverVersion: &version.Info{GitVersion: "v1.27.4-eks-2d98532"}, expected: DistributionEKS},
+		{name: "GKE version", serverVersion: &version.Info{GitVersion: "v1.27.3-gke.100"}, expected: DistributionGKE},
+		{name: "k3s version", serverVersion: &version.Info{GitVersion: "v1.27.4+k3s1"}, expected: DistributionK3s},
+		{name: "RKE2 version", serverVersion: &version.Info{GitVersion: "v1.26.7+rke2r1"}, expected: DistributionRKE2},
+		{name: "AKS label", node: core.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"kubernetes.azure.com/cluster": "MC_rg"}}}, expected: DistributionAKS},
+		{name: "minikube label", node: core.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"minikube.k8s.io/name": "minikube"}}}, expected: DistributionMinikube},
+		{name: "k3s instance type", node: core.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"node.kubernetes.io/instance-type": "k3s"}}}, expected: DistributionK3s},
+		{name: "kind provider", node: core.Node{Spec: core.NodeSpec{ProviderID: "kind://docker/kind/kind-control-plane"}}, expected: DistributionKind},
+		{name: "Talos OS image", node: core.Node{Status: core.NodeStatus{NodeInfo: core.NodeSystemInfo{OSImage: "Talos (v1.5.0)"}}}, expected: DistributionTalos},
+		{name: "OpenShift namespaces", namespaces: []string{"default", "openshift-apiserver"}, expected: DistributionOpenShift},
+		{name: "vanilla", serverVersion: &version.Info{GitVersion: "v1.28.0"}, namespaces: []string{"default"}, expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, detectDistribution(tt.serverVersion, []core.Node{tt.node}, tt.namespaces))
+		})
+	}
+}
+
+func TestGetClusterIdentity(t *testing.T) {
+	wh := &WatchHandler{RestAPIClient: fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: "cluster-uid"}},
+		&core.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"cloud.google.com/gke-nodepool": "pool-1"}}},
+	)}
+	identity := wh.getClusterIdentity(&version.Info{GitVersion: "v1.28.0"}, wh.listNodesSample())
+	assert.Equal(t, "cluster-uid", identity.UID)
+	assert.Equal(t, DistributionGKE, identity.Distribution)
+
+	// the identity is cached
+	wh.clusterIdentity = identity
+	assert.NoError(t, wh.RestAPIClient.CoreV1().Namespaces().Delete(globalHTTPContext, metav1.NamespaceSystem, metav1.DeleteOptions{}))
+	assert.Same(t, identity, wh.getClusterIdentity(nil, wh.listNodesSample()))
+
+	wh = &WatchHandler{RestAPIClient: fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: "cluster-uid"}},
+		&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: openShiftNamespace}},
+	)}
+	assert.Equal(t, DistributionOpenShift, wh.getClusterIdentity(nil, nil).Distribution)
+	assert.False(t, wh.clusterIdentityDetected, "the nodes are listed again on the next watch")
+
+	wh = &WatchHandler{RestAPIClient: fake.NewSimpleClientset()}
+	assert.Equal(t, &ClusterIdentity{}, wh.getClusterIdentity(nil, wh.listNodesSample()))
+}
@@ -0,0 +1,230 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/armosec/utils-go/boolutils"
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/consts"
+	"golang.org/x/net/context"
+	apixv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// securityCustomResources well known security related custom resources, collected automatically once their CRD is installed
+var securityCustomResources = map[schema.GroupResource]bool{
+	{Group: "kyverno.io", Resource: "clusterpolicies"}:                            true,
+	{Group: "kyverno.io", Resource: "policies"}:                                   true,
+	{Group: "templates.gatekeeper.sh", Resource: "constrainttemplates"}:           true,
+	{Group: "security.istio.io", Resource: "authorizationpolicies"}:               true,
+	{Group: "security.istio.io", Resource: "peerauthentications"}:                 true,
+	{Group: "security.istio.io", Resource: "requestauthentications"}:              true,
+	{Group: "cilium.io", Resource: "ciliumnetworkpolicies"}:                       true,
+	{Group: "cilium.io", Resource: "ciliumclusterwidenetworkpolicies"}:            true,
+	{Group: "crd.projectcalico.org", Resource: "networkpolicies"}:                 true,
+	{Group: "crd.projectcalico.org", Resource: "globalnetworkpolicies"}:           true,
+	{Group: "cert-manager.io", Resource: "issuers"}:                               true,
+	{Group: "cert-manager.io", Resource: "clusterissuers"}:                        true,
+	{Group: "policy.networking.k8s.io", Resource: "adminnetworkpolicies"}:         true,
+	{Group: "policy.networking.k8s.io", Resource: "baselineadminnetworkpolicies"}: true,
+	{Group: "secrets-store.csi.x-k8s.io", Resource: "secretproviderclasses"}:      true,
+	{Group: "external-secrets.io", Resource: "secretstores"}:                      true,
+	{Group: "external-secrets.io", Resource: "clustersecretstores"}:               true,
+}
+
+// CustomResourceDefinitionData an installed CRD, without its schema
+type CustomResourceDefinitionData struct {
+	Name              string   `json:"name"`
+	UID               string   `json:"uid"`
+	Group             string   `json:"group"`
+	Kind              string   `json:"kind"`
+	Plural            string   `json:"plural"`
+	Scope             string   `json:"scope"`
+	Versions          []string `json:"versions"`
+	StorageVersion    string   `json:"storageVersion,omitempty"`
+	Established       bool     `json:"established"`
+	CreationTimestamp string   `json:"creationTimestamp"`
+}
+
+// CustomResourceDefinitionWatch watch over the installed CRDs. Refreshes the API resources discovery and enables the collection of the well known security CRDs
+func (wh *WatchHandler) CustomResourceDefinitionWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER CustomResourceDefinitionWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	autoEnable := true
+	if value := os.Getenv(consts.AutoDiscoverCustomResourcesEnvironmentVariable); value != "" {
+		autoEnable = boolutils.StringToBool(value)
+	}
+	var lastWatchEventCreationTime time.Time
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over custom resource definitions starting")
+		crdsWatcher, err := wh.extensionsClient.CustomResourceDefinitions().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over custom resource definitions", helpers.Error(err))
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		crdsChan := crdsWatcher.ResultChan()
+		logger.L().Info("Watching over custom resource definitions started")
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-crdsChan:
+			case <-newStateChan:
+				crdsWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("custom resource definitions watch chan loop", helpers.Interface("error", event.Object))
+				crdsWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.crdEventHandler(ctx, &event, lastWatchEventCreationTime, autoEnable); err != nil {
+				break ChanLoop
+			}
+		}
+		lastWatchEventCreationTime = time.Now()
+	}
+}
+
+func (wh *WatchHandler) crdEventHandler(ctx context.Context, event *watch.Event, lastWatchEventCreationTime time.Time, autoEnable bool) error {
+	crd, ok := event.Object.(*apixv1.CustomResourceDefinition)
+	if !ok {
+		return fmt.Errorf("got unexpected custom resource definition from chan")
+	}
+	data := newCustomResourceDefinitionData(crd)
+	switch event.Type {
+	case watch.Added:
+		if autoEnable {
+			wh.watchSecurityCustomResource(ctx, crd)
+		}
+		if crd.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
+			return nil
+		}
+		// the CRDs which existed when the watch was restarted are discovered already
+		wh.apiResources.invalidate()
+		id := CreateID()
+		wh.crddm.init(id)
+		wh.crddm.pushBack(id, data)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, CUSTOMRESOURCEDEFINITIONS, CREATED)
+	case watch.Modified:
+		wh.apiResources.invalidate()
+		if autoEnable {
+			wh.watchSecurityCustomResource(ctx, crd)
+		}
+		wh.updateCustomResourceDefinition(data)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, CUSTOMRESOURCEDEFINITIONS, UPDATED)
+	case watch.Deleted:
+		wh.apiResources.invalidate()
+		wh.unwatchCustomResource(schema.GroupResource{Group: crd.Spec.Group, Resource: crd.Spec.Names.Plural})
+		wh.removeCustomResourceDefinition(data)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, CUSTOMRESOURCEDEFINITIONS, DELETED)
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	}
+	return nil
+}
+
+// watchSecurityCustomResource starts collecting the custom resources of a well known security CRD, once the CRD is established
+func (wh *WatchHandler) watchSecurityCustomResource(ctx context.Context, crd *apixv1.CustomResourceDefinition) {
+	if !securityCustomResources[schema.GroupResource{Group: crd.Spec.Group, Resource: crd.Spec.Names.Plural}] || !isCustomResourceDefinitionEstablished(crd) {
+		return
+	}
+	version := customResourceDefinitionServedVersion(crd)
+	if version == "" {
+		return
+	}
+	wh.watchCustomResource(ctx, schema.GroupVersionResource{Group: crd.Spec.Group, Version: version, Resource: crd.Spec.Names.Plural})
+}
+
+func (wh *WatchHandler) updateCustomResourceDefinition(data *CustomResourceDefinitionData) {
+	for _, id := range wh.crddm.getIDs() {
+		front := wh.crddm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if stored, ok := front.Value.(*CustomResourceDefinitionData); ok && stored.Name == data.Name {
+			wh.crddm.updateFront(id, data)
+			return
+		}
+	}
+}
+
+func (wh *WatchHandler) removeCustomResourceDefinition(data *CustomResourceDefinitionData) string {
+	for _, id := range wh.crddm.getIDs() {
+		front := wh.crddm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if stored, ok := front.Value.(*CustomResourceDefinitionData); ok && stored.Name == data.Name {
+			wh.crddm.remove(id)
+			return data.Name
+		}
+	}
+	return ""
+}
+
+func newCustomResourceDefinitionData(crd *apixv1.CustomResourceDefinition) *CustomResourceDefinitionData {
+	data := &CustomResourceDefinitionData{
+		Name:              crd.Name,
+		UID:               string(crd.UID),
+		Group:             crd.Spec.Group,
+		Kind:              crd.Spec.Names.Kind,
+		Plural:            crd.Spec.Names.Plural,
+		Scope:             string(crd.Spec.Scope),
+		Versions:          []string{},
+		Established:       isCustomResourceDefinitionEstablished(crd),
+		CreationTimestamp: crd.CreationTimestamp.Time.UTC().Format(time.RFC3339),
+	}
+	for i := range crd.Spec.Versions {
+		if crd.Spec.Versions[i].Served {
+			data.Versions = append(data.Versions, crd.Spec.Versions[i].Name)
+		}
+		if crd.Spec.Versions[i].Storage {
+			data.StorageVersion = crd.Spec.Versions[i].Name
+		}
+	}
+	return data
+}
+
+func isCustomResourceDefinitionEstablished(crd *apixv1.CustomResourceDefinition) bool {
+	for i := range crd.Status.Conditions {
+		if crd.Status.Conditions[i].Type == apixv1.Established {
+			return crd.Status.Conditions[i].Status == apixv1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// customResourceDefinitionServedVersion returns the storage version if it is served, otherwise the first served version
+func customResourceDefinitionServedVersion(crd *apixv1.CustomResourceDefinition) string {
+	served := ""
+	for i := range crd.Spec.Versions {
+		if !crd.Spec.Versions[i].Served {
+			continue
+		}
+		if crd.Spec.Versions[i].Storage {
+			return crd.Spec.Versions[i].Name
+		}
+		if served == "" {
+			served = crd.Spec.Versions[i].Name
+		}
+	}
+	return served
+}
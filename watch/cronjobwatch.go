@@ -67,6 +67,12 @@ func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher w
 			// handle cases like microservice
 			cronjob.ManagedFields = []metav1.ManagedFieldsEntry{}
 			switch event.Type {
+			case watch.Added, watch.Modified:
+				wh.ownerCache.update(cronjob)
+			case watch.Deleted:
+				wh.ownerCache.remove(cronjob.UID)
+			}
+			switch event.Type {
 			case watch.Added:
 				if cronjob.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
 					logger.L().Info("cronjob already exist, will not be reported", helpers.String("name", cronjob.Name))
@@ -80,7 +86,7 @@ func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher w
 				}
 				wh.pdm[id] = list.New()
 				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
-					Owner: od, PodSpecId: id}
+					Owner: od, PodSpecId: id, Storage: wh.getMicroServiceStorage(cronjob.Namespace, &cronjob.Spec.JobTemplate.Spec.Template.Spec)}
 				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
 				cronJobIDs[string(cronjob.GetUID())] = id
 				informNewDataArrive(wh)
@@ -91,7 +97,7 @@ func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher w
 					OwnerData: cronjob,
 				}
 				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
-					Owner: od, PodSpecId: cronJobIDs[string(cronjob.GetUID())]}
+					Owner: od, PodSpecId: cronJobIDs[string(cronjob.GetUID())], Storage: wh.getMicroServiceStorage(cronjob.Namespace, &cronjob.Spec.JobTemplate.Spec.Template.Spec)}
 				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, UPDATED)
 				informNewDataArrive(wh)
 			case watch.Deleted:
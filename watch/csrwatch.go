@@ -0,0 +1,204 @@
+package watch
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	CSRStatusPending  = "Pending"
+	CSRStatusApproved = "Approved"
+	CSRStatusDenied   = "Denied"
+	CSRStatusFailed   = "Failed"
+)
+
+// CertificateSigningRequestData a certificate signing request, without the request and the issued certificate
+type CertificateSigningRequestData struct {
+	Name              string                     `json:"name"`
+	UID               string                     `json:"uid"`
+	SignerName        string                     `json:"signerName"`
+	Usages            []string                   `json:"usages,omitempty"`
+	ExpirationSeconds *int32                     `json:"expirationSeconds,omitempty"`
+	Username          string                     `json:"username,omitempty"`
+	RequestorUID      string                     `json:"requestorUID,omitempty"`
+	Groups            []string                   `json:"groups,omitempty"`
+	Status            string                     `json:"status"`
+	StatusReason      string                     `json:"statusReason,omitempty"`
+	Issued            bool                       `json:"issued"`
+	Subject           *CertificateRequestSubject `json:"subject,omitempty"`
+	CreationTimestamp string                     `json:"creationTimestamp"`
+}
+
+// CertificateRequestSubject the subject and the alternative names parsed from the PEM request
+type CertificateRequestSubject struct {
+	CommonName         string   `json:"commonName,omitempty"`
+	Organization       []string `json:"organization,omitempty"`
+	OrganizationalUnit []string `json:"organizationalUnit,omitempty"`
+	DNSNames           []string `json:"dnsNames,omitempty"`
+	IPAddresses        []string `json:"ipAddresses,omitempty"`
+	EmailAddresses     []string `json:"emailAddresses,omitempty"`
+	URIs               []string `json:"uris,omitempty"`
+	// SystemGroups the requested "system:" groups (e.g. system:masters)
+	SystemGroups []string `json:"systemGroups,omitempty"`
+}
+
+// CertificateSigningRequestWatch watch over certificates/v1 certificate signing requests
+func (wh *WatchHandler) CertificateSigningRequestWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER CertificateSigningRequestWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	var lastWatchEventCreationTime time.Time
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over certificate signing requests starting")
+		csrsWatcher, err := wh.RestAPIClient.CertificatesV1().CertificateSigningRequests().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over certificate signing requests", helpers.Error(err))
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		csrsChan := csrsWatcher.ResultChan()
+		logger.L().Info("Watching over certificate signing requests started")
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-csrsChan:
+			case <-newStateChan:
+				csrsWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("certificate signing requests watch chan loop", helpers.Interface("error", event.Object))
+				csrsWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.csrEventHandler(&event, lastWatchEventCreationTime); err != nil {
+				break ChanLoop
+			}
+		}
+		lastWatchEventCreationTime = time.Now()
+	}
+}
+
+func (wh *WatchHandler) csrEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+	csr, ok := event.Object.(*certificatesv1.CertificateSigningRequest)
+	if !ok {
+		return fmt.Errorf("got unexpected certificate signing request from chan")
+	}
+	data := newCertificateSigningRequestData(csr)
+	switch event.Type {
+	case watch.Added:
+		if csr.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
+			return nil
+		}
+		id := CreateID()
+		wh.csrdm.init(id)
+		wh.csrdm.pushBack(id, uidObject{uid: data.UID, data: data})
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, CERTIFICATESIGNINGREQUESTS, CREATED)
+	case watch.Modified:
+		updateUIDObject(wh.csrdm, data.UID, data)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, CERTIFICATESIGNINGREQUESTS, UPDATED)
+	case watch.Deleted:
+		removeUIDObject(wh.csrdm, data.UID)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(data, CERTIFICATESIGNINGREQUESTS, DELETED)
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	}
+	return nil
+}
+
+func newCertificateSigningRequestData(csr *certificatesv1.CertificateSigningRequest) *CertificateSigningRequestData {
+	data := &CertificateSigningRequestData{
+		Name:              csr.Name,
+		UID:               string(csr.UID),
+		SignerName:        csr.Spec.SignerName,
+		ExpirationSeconds: csr.Spec.ExpirationSeconds,
+		Username:          csr.Spec.Username,
+		RequestorUID:      csr.Spec.UID,
+		Groups:            csr.Spec.Groups,
+		Issued:            len(csr.Status.Certificate) > 0,
+		CreationTimestamp: csr.CreationTimestamp.Time.UTC().Format(time.RFC3339),
+	}
+	for _, usage := range csr.Spec.Usages {
+		data.Usages = append(data.Usages, string(usage))
+	}
+	data.Status, data.StatusReason = certificateSigningRequestStatus(&csr.Status)
+	subject, err := parseCertificateRequestSubject(csr.Spec.Request)
+	if err != nil {
+		logger.L().Debug("failed to parse certificate signing request", helpers.String("name", csr.Name), helpers.Error(err))
+	}
+	data.Subject = subject
+	return data
+}
+
+// certificateSigningRequestStatus returns the approval status and its reason. A denied or failed request is never issued
+func certificateSigningRequestStatus(status *certificatesv1.CertificateSigningRequestStatus) (string, string) {
+	result, reason := CSRStatusPending, ""
+	for i := range status.Conditions {
+		condition := &status.Conditions[i]
+		if condition.Status == corev1.ConditionFalse {
+			continue
+		}
+		switch condition.Type {
+		case certificatesv1.CertificateDenied:
+			return CSRStatusDenied, condition.Reason
+		case certificatesv1.CertificateFailed:
+			return CSRStatusFailed, condition.Reason
+		case certificatesv1.CertificateApproved:
+			result, reason = CSRStatusApproved, condition.Reason
+		}
+	}
+	return result, reason
+}
+
+// parseCertificateRequestSubject parses the PEM encoded x509 certificate request
+func parseCertificateRequestSubject(request []byte) (*CertificateRequestSubject, error) {
+	block, _ := pem.Decode(request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("PEM block type must be CERTIFICATE REQUEST")
+	}
+	certificateRequest, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	subject := &CertificateRequestSubject{
+		CommonName:         certificateRequest.Subject.CommonName,
+		Organization:       certificateRequest.Subject.Organization,
+		OrganizationalUnit: certificateRequest.Subject.OrganizationalUnit,
+		DNSNames:           certificateRequest.DNSNames,
+		EmailAddresses:     certificateRequest.EmailAddresses,
+	}
+	for _, ip := range certificateRequest.IPAddresses {
+		subject.IPAddresses = append(subject.IPAddresses, ip.String())
+	}
+	for _, uri := range certificateRequest.URIs {
+		subject.URIs = append(subject.URIs, uri.String())
+	}
+	for _, organization := range certificateRequest.Subject.Organization {
+		if strings.HasPrefix(organization, "system:") {
+			subject.SystemGroups = append(subject.SystemGroups, organization)
+		}
+	}
+	return subject, nil
+}
@@ -0,0 +1,76 @@
+package watch
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func newTestCertificateRequest(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "admin", Organization: []string{"system:masters", "dev"}},
+		DNSNames:    []string{"admin.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+	}, key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestNewCertificateSigningRequestData(t *testing.T) {
+	csr := &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "admin-csr", UID: "csr-uid"},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    newTestCertificateRequest(t),
+			SignerName: certificatesv1.KubeAPIServerClientSignerName,
+			Usages:     []certificatesv1.KeyUsage{certificatesv1.UsageClientAuth},
+			Username:   "bob",
+			Groups:     []string{"system:authenticated"},
+		},
+	}
+	data := newCertificateSigningRequestData(csr)
+	assert.Equal(t, CSRStatusPending, data.Status)
+	assert.Equal(t, []string{"client auth"}, data.Usages)
+	assert.Equal(t, "bob", data.Username)
+	assert.Equal(t, "admin", data.Subject.CommonName)
+	assert.Equal(t, []string{"system:masters"}, data.Subject.SystemGroups)
+	assert.Equal(t, []string{"10.0.0.1"}, data.Subject.IPAddresses)
+	assert.False(t, data.Issued)
+
+	csr.Status.Conditions = []certificatesv1.CertificateSigningRequestCondition{{Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue, Reason: "AutoApproved"}}
+	csr.Status.Certificate = []byte("cert")
+	data = newCertificateSigningRequestData(csr)
+	assert.Equal(t, CSRStatusApproved, data.Status)
+	assert.Equal(t, "AutoApproved", data.StatusReason)
+	assert.True(t, data.Issued)
+
+	csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{Type: certificatesv1.CertificateFailed, Status: corev1.ConditionTrue})
+	assert.Equal(t, CSRStatusFailed, newCertificateSigningRequestData(csr).Status)
+
+	csr.Spec.Request = []byte("not a PEM")
+	assert.Nil(t, newCertificateSigningRequestData(csr).Subject)
+}
+
+func TestCSREventHandler(t *testing.T) {
+	wh := &WatchHandler{csrdm: newResourceMap(), aggregateFirstDataFlag: true}
+	csr := &certificatesv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: "csr", UID: "csr-uid"}}
+	assert.NoError(t, wh.csrEventHandler(&watch.Event{Type: watch.Added, Object: csr}, time.Time{}))
+	assert.Equal(t, 1, wh.csrdm.len())
+	assert.NoError(t, wh.csrEventHandler(&watch.Event{Type: watch.Deleted, Object: csr}, time.Time{}))
+	assert.Equal(t, 0, wh.csrdm.len())
+	assert.Equal(t, 2, wh.jsonReport.CertificateSigningRequests.Len())
+	assert.Error(t, wh.csrEventHandler(&watch.Event{Type: watch.Added, Object: &corev1.Pod{}}, time.Time{}))
+}
@@ -0,0 +1,193 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/consts"
+	"golang.org/x/net/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// customResourceCollector watches over any GroupVersionResource using the dynamic client and reports the objects as unstructured
+type customResourceCollector struct {
+	dynamicClient dynamic.Interface
+	informers     map[schema.GroupVersionResource]*customResourceInformer
+	stripFields   [][]string
+	mutex         sync.Mutex
+}
+
+// customResourceInformer an informer of a single GroupVersionResource, stopped on its own once the resource is not served anymore
+type customResourceInformer struct {
+	informer cache.SharedIndexInformer
+	stopChan chan struct{}
+}
+
+func newCustomResourceCollector(dynamicClient dynamic.Interface) *customResourceCollector {
+	collector := &customResourceCollector{
+		dynamicClient: dynamicClient,
+		informers:     make(map[schema.GroupVersionResource]*customResourceInformer),
+		mutex:         sync.Mutex{},
+	}
+	for _, field := range getStringSliceFromEnvVar(consts.CustomResourcesStripFieldsEnvironmentVariable, nil) {
+		collector.stripFields = append(collector.stripFields, strings.Split(field, "."))
+	}
+	return collector
+}
+
+// parseGroupVersionResource parses a GVR in the "group/version/resource" format ("version/resource" for the core group)
+func parseGroupVersionResource(s string) (schema.GroupVersionResource, error) {
+	parts := strings.Split(s, "/")
+	switch {
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}, nil
+	case len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "":
+		return schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}, nil
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("invalid resource %q, expected group/version/resource", s)
+}
+
+// gvrKey the key of a GroupVersionResource in the customResources section
+func gvrKey(gvr schema.GroupVersionResource) string {
+	if gvr.Group == "" {
+		return gvr.Version + "/" + gvr.Resource
+	}
+	return gvr.Group + "/" + gvr.Version + "/" + gvr.Resource
+}
+
+// CustomResourceWatch watch over the GroupVersionResources configured in the CUSTOM_RESOURCES environment variable
+func (wh *WatchHandler) CustomResourceWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER CustomResourceWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	for _, resource := range getStringSliceFromEnvVar(consts.CustomResourcesEnvironmentVariable, nil) {
+		gvr, err := parseGroupVersionResource(resource)
+		if err != nil {
+			logger.L().Ctx(ctx).Error("failed to parse custom resource", helpers.String("resource", resource), helpers.Error(err))
+			continue
+		}
+		wh.watchCustomResource(ctx, gvr)
+	}
+	for range newStateChan {
+		wh.customResources.reportAll(wh)
+	}
+}
+
+// watchCustomResource starts watching over a GroupVersionResource, in case it is not already watched
+func (wh *WatchHandler) watchCustomResource(ctx context.Context, gvr schema.GroupVersionResource) {
+	collector := wh.customResources
+	if collector == nil || collector.dynamicClient == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	if _, ok := collector.informers[gvr]; ok {
+		return
+	}
+	informer := dynamicinformer.NewFilteredDynamicInformer(collector.dynamicClient, gvr, metav1.NamespaceAll, 0,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil).Informer()
+	if err := informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		logger.L().Ctx(ctx).Warning("custom resource watch error", helpers.String("resource", gvrKey(gvr)), helpers.Error(err))
+	}); err != nil {
+		logger.L().Ctx(ctx).Debug("failed to set watch error handler", helpers.String("resource", gvrKey(gvr)), helpers.Error(err))
+	}
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			wh.customResourceEventHandler(gvr, obj, CREATED)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if o, ok := oldObj.(*unstructured.Unstructured); ok {
+				if n, ok := newObj.(*unstructured.Unstructured); ok && o.GetResourceVersion() == n.GetResourceVersion() {
+					return
+				}
+			}
+			wh.customResourceEventHandler(gvr, newObj, UPDATED)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			wh.customResourceEventHandler(gvr, obj, DELETED)
+		},
+	}); err != nil {
+		logger.L().Ctx(ctx).Error("failed to watch over custom resource", helpers.String("resource", gvrKey(gvr)), helpers.Error(err))
+		return
+	}
+	stopChan := make(chan struct{})
+	collector.informers[gvr] = &customResourceInformer{informer: informer, stopChan: stopChan}
+	go informer.Run(stopChan)
+	logger.L().Info("Watching over custom resource started", helpers.String("resource", gvrKey(gvr)))
+}
+
+// unwatchCustomResource stops watching over all the versions of a resource, so it is watched again from scratch once re-created
+func (wh *WatchHandler) unwatchCustomResource(gr schema.GroupResource) {
+	collector := wh.customResources
+	if collector == nil {
+		return
+	}
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	for gvr, watched := range collector.informers {
+		if gvr.GroupResource() != gr {
+			continue
+		}
+		close(watched.stopChan)
+		delete(collector.informers, gvr)
+		logger.L().Info("Watching over custom resource stopped", helpers.String("resource", gvrKey(gvr)))
+	}
+}
+
+func (wh *WatchHandler) customResourceEventHandler(gvr schema.GroupVersionResource, obj interface{}, stype StateType) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	if u.GetNamespace() != "" && !wh.isNamespaceWatched(u.GetNamespace()) {
+		return
+	}
+	u = wh.customResources.strip(u)
+	wh.jsonReport.AddCustomResourceToJsonFormat(gvrKey(gvr), u.Object, stype)
+	informNewDataArrive(wh)
+}
+
+// strip returns a copy of the object without the managed fields and the configured fields
+func (collector *customResourceCollector) strip(u *unstructured.Unstructured) *unstructured.Unstructured {
+	u = u.DeepCopy()
+	u.SetManagedFields(nil)
+	if annotations := u.GetAnnotations(); annotations != nil {
+		delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+		u.SetAnnotations(annotations)
+	}
+	for _, field := range collector.stripFields {
+		unstructured.RemoveNestedField(u.Object, field...)
+	}
+	return u
+}
+
+// reportAll reports all the watched objects as created. Called when a new state report is requested
+func (collector *customResourceCollector) reportAll(wh *WatchHandler) {
+	collector.mutex.Lock()
+	informers := make(map[schema.GroupVersionResource]cache.SharedIndexInformer, len(collector.informers))
+	for gvr, watched := range collector.informers {
+		informers[gvr] = watched.informer
+	}
+	collector.mutex.Unlock()
+	for gvr, informer := range informers {
+		for _, obj := range informer.GetStore().List() {
+			wh.customResourceEventHandler(gvr, obj, CREATED)
+		}
+	}
+}
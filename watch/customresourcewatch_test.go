@@ -0,0 +1,90 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kubescape/kollector/consts"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestParseGroupVersionResource(t *testing.T) {
+	gvr, err := parseGroupVersionResource("networking.istio.io/v1beta1/virtualservices")
+	assert.NoError(t, err)
+	assert.Equal(t, schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "virtualservices"}, gvr)
+	assert.Equal(t, "networking.istio.io/v1beta1/virtualservices", gvrKey(gvr))
+
+	gvr, err = parseGroupVersionResource("v1/configmaps")
+	assert.NoError(t, err)
+	assert.Equal(t, schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, gvr)
+	assert.Equal(t, "v1/configmaps", gvrKey(gvr))
+
+	_, err = parseGroupVersionResource("virtualservices")
+	assert.Error(t, err)
+	_, err = parseGroupVersionResource("a//b")
+	assert.Error(t, err)
+}
+
+func newTestVirtualService() *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("networking.istio.io/v1beta1")
+	u.SetKind("VirtualService")
+	u.SetNamespace("default")
+	u.SetName("reviews")
+	u.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}", "team": "a"})
+	_ = unstructured.SetNestedField(u.Object, "reviews", "spec", "hosts")
+	_ = unstructured.SetNestedField(u.Object, "ok", "status", "phase")
+	return u
+}
+
+func TestCustomResourceCollectorStrip(t *testing.T) {
+	t.Setenv(consts.CustomResourcesStripFieldsEnvironmentVariable, "status")
+	collector := newCustomResourceCollector(nil)
+
+	u := newTestVirtualService()
+	stripped := collector.strip(u)
+	assert.Equal(t, map[string]string{"team": "a"}, stripped.GetAnnotations())
+	_, found, _ := unstructured.NestedFieldNoCopy(stripped.Object, "status")
+	assert.False(t, found)
+
+	// the original object is not modified
+	_, found, _ = unstructured.NestedFieldNoCopy(u.Object, "status")
+	assert.True(t, found)
+}
+
+func TestWatchCustomResource(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "virtualservices"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "VirtualServiceList"}, newTestVirtualService())
+
+	wh := WatchHandler{
+		customResources:        newCustomResourceCollector(dynamicClient),
+		includeNamespaces:      []string{""},
+		aggregateFirstDataFlag: true,
+	}
+	defer wh.unwatchCustomResource(gvr.GroupResource())
+
+	wh.watchCustomResource(context.Background(), gvr)
+	wh.watchCustomResource(context.Background(), gvr)
+	assert.Len(t, wh.customResources.informers, 1)
+
+	assert.Eventually(t, func() bool {
+		customResourcesMutex.Lock()
+		defer customResourcesMutex.Unlock()
+		return wh.jsonReport.CustomResources[gvrKey(gvr)].Len() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the resource is watched again from scratch once its definition is re-created
+	stopped := wh.customResources.informers[gvr]
+	wh.unwatchCustomResource(gvr.GroupResource())
+	assert.Len(t, wh.customResources.informers, 0)
+	assert.Eventually(t, stopped.informer.IsStopped, 5*time.Second, 10*time.Millisecond)
+	wh.watchCustomResource(context.Background(), gvr)
+	assert.Len(t, wh.customResources.informers, 1)
+	assert.NotSame(t, stopped, wh.customResources.informers[gvr])
+}
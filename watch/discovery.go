@@ -0,0 +1,183 @@
+package watch
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+const (
+	minDiscoveryRefreshInterval = 5 * time.Second
+)
+
+// APIResource a resource served by the API server
+type APIResource struct {
+	GroupVersionResource schema.GroupVersionResource
+	GroupVersionKind     schema.GroupVersionKind
+	Namespaced           bool
+	Preferred            bool
+}
+
+// apiResourceDiscovery caches the API resources served by the API server
+type apiResourceDiscovery struct {
+	client      discovery.DiscoveryInterface
+	resources   []APIResource
+	lastRefresh time.Time
+	// stale the resources were changed since the last refresh
+	stale bool
+	mutex sync.RWMutex
+}
+
+func newAPIResourceDiscovery(client discovery.DiscoveryInterface) *apiResourceDiscovery {
+	return &apiResourceDiscovery{
+		client: client,
+		mutex:  sync.RWMutex{},
+	}
+}
+
+// refresh reloads the API resources from the API server. Groups which fail discovery (e.g. an unavailable aggregated API) are skipped
+func (d *apiResourceDiscovery) refresh() error {
+	if d == nil || d.client == nil {
+		return fmt.Errorf("discovery client is not initialized")
+	}
+	groups, resourceLists, err := discovery.ServerGroupsAndResources(d.client)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return err
+	}
+	if err != nil {
+		logger.L().Warning("failed to discover some of the API groups", helpers.Error(err))
+	}
+	preferredVersions := make(map[string]string, len(groups))
+	for _, group := range groups {
+		preferredVersions[group.Name] = group.PreferredVersion.Version
+	}
+	resources := []APIResource{}
+	for _, resourceList := range resourceLists {
+		gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for i := range resourceList.APIResources {
+			resources = append(resources, newAPIResource(gv, &resourceList.APIResources[i], preferredVersions[gv.Group] == gv.Version))
+		}
+	}
+	resources = filterSubResources(resources)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.resources = resources
+	logger.L().Debug("API resources discovered", helpers.Int("resources", len(resources)))
+	return nil
+}
+
+// refreshIfStale refreshes the cache unless it was refreshed (or failed to refresh) in the last few seconds
+func (d *apiResourceDiscovery) refreshIfStale() {
+	d.mutex.Lock()
+	due := time.Since(d.lastRefresh) > minDiscoveryRefreshInterval
+	if due {
+		d.lastRefresh = time.Now()
+		d.stale = false
+	}
+	d.mutex.Unlock()
+	if !due {
+		return
+	}
+	if err := d.refresh(); err != nil {
+		logger.L().Error("failed to discover API resources", helpers.Error(err))
+		d.invalidate()
+	}
+}
+
+// invalidate marks the cached resources as stale, the first lookup after the refresh interval discovers them again,
+// so a burst of CRD events triggers a single discovery. Called when a CRD is added, changed or removed
+func (d *apiResourceDiscovery) invalidate() {
+	if d == nil {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stale = true
+}
+
+func newAPIResource(gv schema.GroupVersion, resource *metav1.APIResource, preferred bool) APIResource {
+	return APIResource{
+		GroupVersionResource: gv.WithResource(resource.Name),
+		GroupVersionKind:     gv.WithKind(resource.Kind),
+		Namespaced:           resource.Namespaced,
+		Preferred:            preferred,
+	}
+}
+
+func filterSubResources(resources []APIResource) []APIResource {
+	filtered := resources[:0]
+	for _, resource := range resources {
+		if !strings.Contains(resource.GroupVersionResource.Resource, "/") {
+			filtered = append(filtered, resource)
+		}
+	}
+	return filtered
+}
+
+// getResources returns the cached resources, discovering them in case the cache is empty or stale
+func (d *apiResourceDiscovery) getResources() []APIResource {
+	if d == nil {
+		return nil
+	}
+	d.mutex.RLock()
+	resources, stale := d.resources, d.stale
+	d.mutex.RUnlock()
+	if resources != nil && !stale {
+		return resources
+	}
+	d.refreshIfStale()
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.resources
+}
+
+// ResourceForKind returns the resource of a kind in a specific apiVersion
+func (d *apiResourceDiscovery) ResourceForKind(apiVersion, kind string) (APIResource, bool) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return APIResource{}, false
+	}
+	for _, resource := range d.getResources() {
+		if resource.GroupVersionKind.GroupVersion() == gv && resource.GroupVersionKind.Kind == kind {
+			return resource, true
+		}
+	}
+	return APIResource{}, false
+}
+
+// ResourcesForKind returns the resources of a kind in all the groups and versions. The preferred versions are first
+func (d *apiResourceDiscovery) ResourcesForKind(kind string) []APIResource {
+	var preferred, other []APIResource
+	for _, resource := range d.getResources() {
+		if resource.GroupVersionKind.Kind != kind {
+			continue
+		}
+		if resource.Preferred {
+			preferred = append(preferred, resource)
+		} else {
+			other = append(other, resource)
+		}
+	}
+	return append(preferred, other...)
+}
+
+// ResourceForGVR returns a served resource by its GroupVersionResource
+func (d *apiResourceDiscovery) ResourceForGVR(gvr schema.GroupVersionResource) (APIResource, bool) {
+	for _, resource := range d.getResources() {
+		if resource.GroupVersionResource == gvr {
+			return resource, true
+		}
+	}
+	return APIResource{}, false
+}
@@ -0,0 +1,117 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apixv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newFakeAPIResourceDiscovery(resources ...*metav1.APIResourceList) *apiResourceDiscovery {
+	return newAPIResourceDiscovery(&fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{Resources: resources}})
+}
+
+func TestAPIResourceDiscovery(t *testing.T) {
+	d := newFakeAPIResourceDiscovery(
+		&metav1.APIResourceList{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Kind: "Deployment", Namespaced: true},
+				{Name: "deployments/scale", Kind: "Scale", Namespaced: true},
+			},
+		},
+		&metav1.APIResourceList{
+			GroupVersion: "kyverno.io/v1",
+			APIResources: []metav1.APIResource{{Name: "clusterpolicies", Kind: "ClusterPolicy"}},
+		},
+	)
+
+	resource, ok := d.ResourceForKind("apps/v1", "Deployment")
+	assert.True(t, ok)
+	assert.Equal(t, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, resource.GroupVersionResource)
+	assert.True(t, resource.Namespaced)
+
+	_, ok = d.ResourceForKind("apps/v1beta1", "Deployment")
+	assert.False(t, ok)
+	_, ok = d.ResourceForKind("apps/v1", "Scale")
+	assert.False(t, ok, "sub resources are not reported")
+
+	resources := d.ResourcesForKind("ClusterPolicy")
+	assert.Len(t, resources, 1)
+	assert.Equal(t, "kyverno.io", resources[0].GroupVersionKind.Group)
+
+	_, ok = d.ResourceForGVR(schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"})
+	assert.True(t, ok)
+}
+
+func TestAPIResourceDiscoveryInvalidate(t *testing.T) {
+	fake := &k8stesting.Fake{}
+	d := newAPIResourceDiscovery(&fakediscovery.FakeDiscovery{Fake: fake})
+	_, ok := d.ResourceForKind("kyverno.io/v1", "ClusterPolicy")
+	assert.False(t, ok)
+
+	fake.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "kyverno.io/v1",
+		APIResources: []metav1.APIResource{{Name: "clusterpolicies", Kind: "ClusterPolicy"}},
+	}}
+	_, ok = d.ResourceForKind("kyverno.io/v1", "ClusterPolicy")
+	assert.False(t, ok, "the cached resources are used until invalidated")
+
+	// the discovery is not repeated within the refresh interval
+	d.invalidate()
+	_, ok = d.ResourceForKind("kyverno.io/v1", "ClusterPolicy")
+	assert.False(t, ok, "the stale resources are used until the refresh interval passed")
+
+	d.lastRefresh = time.Now().Add(-2 * minDiscoveryRefreshInterval)
+	_, ok = d.ResourceForKind("kyverno.io/v1", "ClusterPolicy")
+	assert.True(t, ok)
+	d.lastRefresh = time.Now().Add(-2 * minDiscoveryRefreshInterval)
+	_, ok = d.ResourceForKind("kyverno.io/v1", "ClusterPolicy")
+	assert.True(t, ok, "the resources are not discovered again until invalidated")
+	assert.False(t, d.stale)
+}
+
+func TestCRDEventHandler(t *testing.T) {
+	wh := &WatchHandler{
+		crddm:                  newResourceMap(),
+		apiResources:           newFakeAPIResourceDiscovery(),
+		aggregateFirstDataFlag: true,
+	}
+	crd := &apixv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "clusterpolicies.kyverno.io"},
+		Spec: apixv1.CustomResourceDefinitionSpec{
+			Group: "kyverno.io",
+			Names: apixv1.CustomResourceDefinitionNames{Kind: "ClusterPolicy", Plural: "clusterpolicies"},
+			Scope: apixv1.ClusterScoped,
+			Versions: []apixv1.CustomResourceDefinitionVersion{
+				{Name: "v1", Served: true, Storage: true},
+				{Name: "v2beta1", Served: true},
+				{Name: "v1alpha1"},
+			},
+		},
+		Status: apixv1.CustomResourceDefinitionStatus{
+			Conditions: []apixv1.CustomResourceDefinitionCondition{{Type: apixv1.Established, Status: apixv1.ConditionTrue}},
+		},
+	}
+	assert.NoError(t, wh.crdEventHandler(globalHTTPContext, &watch.Event{Type: watch.Added, Object: crd}, time.Time{}, false))
+	assert.Equal(t, 1, wh.crddm.len())
+	assert.Equal(t, 1, wh.jsonReport.CustomResourceDefinitions.Len())
+	data := wh.jsonReport.CustomResourceDefinitions.Created[0].(*CustomResourceDefinitionData)
+	assert.Equal(t, "ClusterPolicy", data.Kind)
+	assert.Equal(t, []string{"v1", "v2beta1"}, data.Versions)
+	assert.Equal(t, "v1", data.StorageVersion)
+	assert.True(t, data.Established)
+	assert.Equal(t, "v1", customResourceDefinitionServedVersion(crd))
+
+	assert.NoError(t, wh.crdEventHandler(globalHTTPContext, &watch.Event{Type: watch.Deleted, Object: crd}, time.Time{}, false))
+	assert.Equal(t, 0, wh.crddm.len())
+	assert.Equal(t, 1, len(wh.jsonReport.CustomResourceDefinitions.Deleted))
+
+	assert.Error(t, wh.crdEventHandler(globalHTTPContext, &watch.Event{Type: watch.Added, Object: &metav1.Status{}}, time.Time{}, false))
+}
@@ -0,0 +1,182 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// ServiceEndpointsData the pods (and their microservices) backing a service
+type ServiceEndpointsData struct {
+	ServiceName   string            `json:"serviceName"`
+	Namespace     string            `json:"namespace"`
+	Pods          []string          `json:"pods"`
+	NotReadyPods  []string          `json:"notReadyPods,omitempty"`
+	MicroServices []MicroServiceRef `json:"microServices,omitempty"`
+}
+
+// endpointSlicesSubscriber the name of the endpoint slice watcher in the microservice index subscribers
+const endpointSlicesSubscriber = "endpointslices"
+
+// serviceEndpoints the endpoint slices of a service, by slice name
+type serviceEndpoints struct {
+	slices map[string]*discoveryv1.EndpointSlice
+	last   *ServiceEndpointsData
+}
+
+// EndpointSliceWatch watch over endpoint slices and report the pods behind each service
+func (wh *WatchHandler) EndpointSliceWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER EndpointSliceWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	services := make(map[string]*serviceEndpoints)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over endpoint slices starting")
+		slicesWatcher, err := wh.RestAPIClient.DiscoveryV1().EndpointSlices("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true, LabelSelector: discoveryv1.LabelServiceName})
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over endpoint slices", helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		slicesChan := slicesWatcher.ResultChan()
+		logger.L().Info("Watching over endpoint slices started")
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-slicesChan:
+			case <-wh.microServices.subscribe(endpointSlicesSubscriber):
+				wh.refreshServiceEndpoints(services, wh.microServices.takeNamespaces(endpointSlicesSubscriber))
+				continue
+			case <-newStateChan:
+				slicesWatcher.Stop()
+				services = make(map[string]*serviceEndpoints)
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("endpoint slices watch chan loop", helpers.Interface("error", event.Object))
+				slicesWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.endpointSliceEventHandler(&event, services); err != nil {
+				break ChanLoop
+			}
+		}
+		logger.L().Debug("Watching over endpoint slices ended - timeout")
+	}
+}
+
+func (wh *WatchHandler) endpointSliceEventHandler(event *watch.Event, services map[string]*serviceEndpoints) error {
+	slice, ok := event.Object.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return fmt.Errorf("got unexpected endpoint slice from chan")
+	}
+	if !wh.isNamespaceWatched(slice.Namespace) {
+		return nil
+	}
+	serviceName := slice.Labels[discoveryv1.LabelServiceName]
+	if serviceName == "" {
+		return nil
+	}
+	key := podKey(slice.Namespace, serviceName)
+	endpoints, exist := services[key]
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		if !exist {
+			endpoints = &serviceEndpoints{slices: make(map[string]*discoveryv1.EndpointSlice)}
+			services[key] = endpoints
+		}
+		endpoints.slices[slice.Name] = slice
+	case watch.Deleted:
+		if !exist {
+			return nil
+		}
+		delete(endpoints.slices, slice.Name)
+		if len(endpoints.slices) == 0 {
+			delete(services, key)
+			if endpoints.last != nil {
+				wh.jsonReport.AddToJsonFormat(endpoints.last, SERVICEENDPOINTS, DELETED)
+				informNewDataArrive(wh)
+			}
+			return nil
+		}
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	}
+
+	wh.reportServiceEndpoints(slice.Namespace, serviceName, endpoints)
+	return nil
+}
+
+// reportServiceEndpoints reports the pods of a service when they changed since the last report
+func (wh *WatchHandler) reportServiceEndpoints(namespace, serviceName string, endpoints *serviceEndpoints) {
+	data := wh.newServiceEndpointsData(namespace, serviceName, endpoints)
+	if endpoints.last != nil && reflect.DeepEqual(endpoints.last, data) {
+		return
+	}
+	stype := UPDATED
+	if endpoints.last == nil {
+		stype = CREATED
+	}
+	endpoints.last = data
+	wh.jsonReport.AddToJsonFormat(data, SERVICEENDPOINTS, stype)
+	informNewDataArrive(wh)
+}
+
+// refreshServiceEndpoints resolves again the microservices of the services in the namespaces where a microservice got its first pod,
+// the pods of a slice may be reported before the pod watcher resolved them
+func (wh *WatchHandler) refreshServiceEndpoints(services map[string]*serviceEndpoints, namespaces map[string]bool) {
+	for key, endpoints := range services {
+		namespace, serviceName, _ := strings.Cut(key, "/")
+		if namespaces[namespace] {
+			wh.reportServiceEndpoints(namespace, serviceName, endpoints)
+		}
+	}
+}
+
+// newServiceEndpointsData aggregates the pods of all the slices of a service
+func (wh *WatchHandler) newServiceEndpointsData(namespace, serviceName string, endpoints *serviceEndpoints) *ServiceEndpointsData {
+	data := &ServiceEndpointsData{ServiceName: serviceName, Namespace: namespace, Pods: []string{}}
+	pods := map[string]bool{}
+	microServices := map[int]MicroServiceRef{}
+	for _, slice := range endpoints.slices {
+		for i := range slice.Endpoints {
+			endpoint := &slice.Endpoints[i]
+			if endpoint.TargetRef == nil || endpoint.TargetRef.Kind != "Pod" || pods[endpoint.TargetRef.Name] {
+				continue
+			}
+			pods[endpoint.TargetRef.Name] = true
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				data.Pods = append(data.Pods, endpoint.TargetRef.Name)
+			} else {
+				data.NotReadyPods = append(data.NotReadyPods, endpoint.TargetRef.Name)
+			}
+			if ref, ok := wh.microServices.getPod(namespace, endpoint.TargetRef.Name); ok {
+				microServices[ref.PodSpecId] = ref
+			}
+		}
+	}
+	sort.Strings(data.Pods)
+	sort.Strings(data.NotReadyPods)
+	for _, ref := range microServices {
+		data.MicroServices = append(data.MicroServices, ref)
+	}
+	sort.Slice(data.MicroServices, func(i, j int) bool { return data.MicroServices[i].PodSpecId < data.MicroServices[j].PodSpecId })
+	return data
+}
@@ -0,0 +1,97 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func newTestEndpointSlice(name string, ready bool, pods ...string) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{discoveryv1.LabelServiceName: "nginx"}},
+	}
+	for _, pod := range pods {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			TargetRef:  &core.ObjectReference{Kind: "Pod", Namespace: "default", Name: pod},
+		})
+	}
+	return slice
+}
+
+func TestEndpointSliceEventHandler(t *testing.T) {
+	wh := WatchHandler{
+		microServices:          newMicroServiceIndex(),
+		includeNamespaces:      []string{""},
+		aggregateFirstDataFlag: true,
+	}
+	wh.microServices.setPod("default", "nginx-1", nil, MicroServiceRef{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"})
+	services := map[string]*serviceEndpoints{}
+
+	event := watch.Event{Type: watch.Added, Object: newTestEndpointSlice("nginx-abc", true, "nginx-1", "nginx-2")}
+	assert.NoError(t, wh.endpointSliceEventHandler(&event, services))
+	assert.Len(t, wh.jsonReport.ServiceEndpoints.Created, 1)
+	data := wh.jsonReport.ServiceEndpoints.Created[0].(*ServiceEndpointsData)
+	assert.Equal(t, []string{"nginx-1", "nginx-2"}, data.Pods)
+	assert.Equal(t, []MicroServiceRef{{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"}}, data.MicroServices)
+
+	// a second slice of the same service
+	event = watch.Event{Type: watch.Added, Object: newTestEndpointSlice("nginx-def", false, "nginx-3")}
+	assert.NoError(t, wh.endpointSliceEventHandler(&event, services))
+	assert.Len(t, wh.jsonReport.ServiceEndpoints.Updated, 1)
+	data = wh.jsonReport.ServiceEndpoints.Updated[0].(*ServiceEndpointsData)
+	assert.Equal(t, []string{"nginx-3"}, data.NotReadyPods)
+
+	// no change, nothing is reported
+	event = watch.Event{Type: watch.Modified, Object: newTestEndpointSlice("nginx-def", false, "nginx-3")}
+	assert.NoError(t, wh.endpointSliceEventHandler(&event, services))
+	assert.Len(t, wh.jsonReport.ServiceEndpoints.Updated, 1)
+
+	event = watch.Event{Type: watch.Deleted, Object: newTestEndpointSlice("nginx-abc", true)}
+	assert.NoError(t, wh.endpointSliceEventHandler(&event, services))
+	event = watch.Event{Type: watch.Deleted, Object: newTestEndpointSlice("nginx-def", false)}
+	assert.NoError(t, wh.endpointSliceEventHandler(&event, services))
+	assert.Len(t, wh.jsonReport.ServiceEndpoints.Deleted, 1)
+	assert.Empty(t, services)
+}
+
+func TestRefreshServiceEndpoints(t *testing.T) {
+	wh := WatchHandler{
+		microServices:          newMicroServiceIndex(),
+		includeNamespaces:      []string{""},
+		aggregateFirstDataFlag: true,
+	}
+	changed := wh.microServices.subscribe(endpointSlicesSubscriber)
+	services := map[string]*serviceEndpoints{}
+
+	// the slice is reported before the pod watcher resolved its pods
+	event := watch.Event{Type: watch.Added, Object: newTestEndpointSlice("nginx-abc", true, "nginx-1", "nginx-2")}
+	assert.NoError(t, wh.endpointSliceEventHandler(&event, services))
+	assert.Empty(t, wh.jsonReport.ServiceEndpoints.Created[0].(*ServiceEndpointsData).MicroServices)
+
+	wh.microServices.setPod("default", "nginx-1", nil, MicroServiceRef{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"})
+	wh.microServices.setPod("default", "nginx-2", nil, MicroServiceRef{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"})
+	assert.Len(t, changed, 1)
+	<-changed
+	wh.refreshServiceEndpoints(services, wh.microServices.takeNamespaces(endpointSlicesSubscriber))
+	assert.Len(t, wh.jsonReport.ServiceEndpoints.Updated, 1)
+	data := wh.jsonReport.ServiceEndpoints.Updated[0].(*ServiceEndpointsData)
+	assert.Equal(t, []MicroServiceRef{{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"}}, data.MicroServices)
+
+	// another pod of a known microservice does not signal
+	wh.microServices.setPod("default", "nginx-3", nil, MicroServiceRef{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"})
+	assert.Len(t, changed, 0)
+	assert.Empty(t, wh.microServices.takeNamespaces(endpointSlicesSubscriber))
+
+	// the microservice is added again after all its pods are removed
+	wh.microServices.removePod("default", "nginx-1")
+	wh.microServices.removePod("default", "nginx-2")
+	wh.microServices.removePod("default", "nginx-3")
+	wh.microServices.setPod("default", "nginx-4", nil, MicroServiceRef{PodSpecId: 7, Namespace: "default", Kind: "Deployment", Name: "nginx"})
+	assert.Len(t, changed, 1)
+	assert.Equal(t, map[string]bool{"default": true}, wh.microServices.takeNamespaces(endpointSlicesSubscriber))
+}
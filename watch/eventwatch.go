@@ -0,0 +1,322 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/consts"
+	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var (
+	defaultEventsTypes = []string{core.EventTypeWarning}
+)
+
+// EventData a cluster event, deduplicated by the involved object and the reason
+type EventData struct {
+	Type               string               `json:"type"`
+	Reason             string               `json:"reason"`
+	Message            string               `json:"message"`
+	InvolvedObject     core.ObjectReference `json:"involvedObject"`
+	Count              int32                `json:"count"`
+	FirstTimestamp     string               `json:"firstTimestamp,omitempty"`
+	LastTimestamp      string               `json:"lastTimestamp,omitempty"`
+	ReportingComponent string               `json:"reportingComponent,omitempty"`
+	MicroService       *MicroServiceRef     `json:"microService,omitempty"`
+}
+
+type eventRecord struct {
+	data   EventData
+	counts map[types.UID]int32
+	last   time.Time
+}
+
+// eventsFilter the event types and reasons which are reported. An empty list matches everything
+type eventsFilter struct {
+	types   map[string]bool
+	reasons map[string]bool
+}
+
+// eventsStore deduplicates the events received from both the core/v1 and the events.k8s.io APIs
+type eventsStore struct {
+	records map[string]*eventRecord
+	mutex   sync.Mutex
+}
+
+func newEventsFilter() *eventsFilter {
+	filter := &eventsFilter{
+		types:   make(map[string]bool),
+		reasons: make(map[string]bool),
+	}
+	for _, t := range getStringSliceFromEnvVar(consts.EventsTypesEnvironmentVariable, defaultEventsTypes) {
+		filter.types[t] = true
+	}
+	for _, r := range getStringSliceFromEnvVar(consts.EventsReasonsEnvironmentVariable, nil) {
+		filter.reasons[r] = true
+	}
+	return filter
+}
+
+func (filter *eventsFilter) matches(eventType, reason string) bool {
+	if len(filter.types) > 0 && !filter.types[eventType] {
+		return false
+	}
+	if len(filter.reasons) > 0 && !filter.reasons[reason] {
+		return false
+	}
+	return true
+}
+
+func newEventsStore() *eventsStore {
+	return &eventsStore{
+		records: make(map[string]*eventRecord),
+		mutex:   sync.Mutex{},
+	}
+}
+
+func eventKey(involvedObject *core.ObjectReference, reason string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", involvedObject.Kind, involvedObject.Namespace, involvedObject.Name, reason)
+}
+
+// upsert adds an occurrence of an event. Returns the aggregated event and the state to report, or false if nothing changed
+func (store *eventsStore) upsert(uid types.UID, data *EventData, last time.Time) (EventData, StateType, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := eventKey(&data.InvolvedObject, data.Reason)
+	record, exist := store.records[key]
+	if !exist {
+		record = &eventRecord{data: *data, counts: map[types.UID]int32{uid: data.Count}, last: last}
+		store.records[key] = record
+		return record.data, CREATED, true
+	}
+	if count, ok := record.counts[uid]; ok && count == data.Count && !last.After(record.last) {
+		// same occurrence, already reported (usually received from the second events API)
+		return record.data, UPDATED, false
+	}
+	record.counts[uid] = data.Count
+	record.data.Count = 0
+	for _, c := range record.counts {
+		record.data.Count += c
+	}
+	if !last.Before(record.last) {
+		record.last = last
+		record.data.Type = data.Type
+		record.data.Message = data.Message
+		record.data.LastTimestamp = data.LastTimestamp
+		record.data.ReportingComponent = data.ReportingComponent
+	}
+	if data.MicroService != nil {
+		record.data.MicroService = data.MicroService
+	}
+	return record.data, UPDATED, true
+}
+
+// remove removes an occurrence of an event. Returns the aggregated event in case it was the last occurrence
+func (store *eventsStore) remove(uid types.UID, involvedObject *core.ObjectReference, reason string) (EventData, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := eventKey(involvedObject, reason)
+	record, exist := store.records[key]
+	if !exist {
+		return EventData{}, false
+	}
+	delete(record.counts, uid)
+	if len(record.counts) > 0 {
+		return EventData{}, false
+	}
+	delete(store.records, key)
+	return record.data, true
+}
+
+// CoreV1EventWatch watch over core/v1 events
+func (wh *WatchHandler) CoreV1EventWatch(ctx context.Context) {
+	wh.eventWatch(ctx, "core/v1", func() (watch.Interface, error) {
+		return wh.RestAPIClient.CoreV1().Events("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+// EventsV1EventWatch watch over events.k8s.io/v1 events
+func (wh *WatchHandler) EventsV1EventWatch(ctx context.Context) {
+	wh.eventWatch(ctx, "events.k8s.io/v1", func() (watch.Interface, error) {
+		return wh.RestAPIClient.EventsV1().Events("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+func (wh *WatchHandler) eventWatch(ctx context.Context, apiVersion string, watchFunc func() (watch.Interface, error)) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER eventWatch", helpers.String("apiVersion", apiVersion), helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over events starting", helpers.String("apiVersion", apiVersion))
+		eventsWatcher, err := watchFunc()
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over events", helpers.String("apiVersion", apiVersion), helpers.Error(err))
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		eventsChan := eventsWatcher.ResultChan()
+		logger.L().Info("Watching over events started", helpers.String("apiVersion", apiVersion))
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-eventsChan:
+			case <-newStateChan:
+				eventsWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("events watch chan loop", helpers.String("apiVersion", apiVersion), helpers.Interface("error", event.Object))
+				eventsWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.eventEventHandler(&event); err != nil {
+				break ChanLoop
+			}
+		}
+		logger.L().Debug("Watching over events ended - timeout", helpers.String("apiVersion", apiVersion))
+	}
+}
+
+func (wh *WatchHandler) eventEventHandler(event *watch.Event) error {
+	var uid types.UID
+	var data *EventData
+	var last time.Time
+	switch e := event.Object.(type) {
+	case *core.Event:
+		uid, data, last = e.UID, coreV1EventToEventData(e), coreV1EventTime(e)
+	case *eventsv1.Event:
+		uid, data, last = e.UID, eventsV1EventToEventData(e), eventsV1EventTime(e)
+	default:
+		return fmt.Errorf("got unexpected event from chan")
+	}
+	if !wh.isNamespaceWatched(data.InvolvedObject.Namespace) || !wh.eventsFilter.matches(data.Type, data.Reason) {
+		return nil
+	}
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		data.MicroService = wh.getEventMicroService(&data.InvolvedObject)
+		if eventData, stype, changed := wh.events.upsert(uid, data, last); changed {
+			wh.jsonReport.AddToJsonFormat(eventData, EVENTS, stype)
+			informNewDataArrive(wh)
+		}
+	case watch.Deleted:
+		if eventData, removed := wh.events.remove(uid, &data.InvolvedObject, data.Reason); removed {
+			wh.jsonReport.AddToJsonFormat(eventData, EVENTS, DELETED)
+			informNewDataArrive(wh)
+		}
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	}
+	return nil
+}
+
+// getEventMicroService returns the microservice the involved object belongs to (the pod's microservice or the owner itself)
+func (wh *WatchHandler) getEventMicroService(involvedObject *core.ObjectReference) *MicroServiceRef {
+	if involvedObject.Kind == "Pod" {
+		if ref, ok := wh.microServices.getPod(involvedObject.Namespace, involvedObject.Name); ok {
+			return &ref
+		}
+		return nil
+	}
+	if ref, ok := wh.microServices.getByOwner(involvedObject.Namespace, involvedObject.Kind, involvedObject.Name); ok {
+		return &ref
+	}
+	return nil
+}
+
+func coreV1EventToEventData(e *core.Event) *EventData {
+	data := &EventData{
+		Type:               e.Type,
+		Reason:             e.Reason,
+		Message:            e.Message,
+		InvolvedObject:     e.InvolvedObject,
+		Count:              e.Count,
+		FirstTimestamp:     formatConditionTime(e.FirstTimestamp),
+		LastTimestamp:      formatConditionTime(metav1.NewTime(coreV1EventTime(e))),
+		ReportingComponent: e.ReportingController,
+	}
+	if e.Series != nil {
+		data.Count = e.Series.Count
+	}
+	if data.Count == 0 {
+		data.Count = 1
+	}
+	if data.ReportingComponent == "" {
+		data.ReportingComponent = e.Source.Component
+	}
+	if data.InvolvedObject.Namespace == "" {
+		data.InvolvedObject.Namespace = e.Namespace
+	}
+	return data
+}
+
+func coreV1EventTime(e *core.Event) time.Time {
+	if e.Series != nil && !e.Series.LastObservedTime.IsZero() {
+		return e.Series.LastObservedTime.Time
+	}
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
+
+func eventsV1EventToEventData(e *eventsv1.Event) *EventData {
+	data := &EventData{
+		Type:               e.Type,
+		Reason:             e.Reason,
+		Message:            e.Note,
+		InvolvedObject:     e.Regarding,
+		Count:              e.DeprecatedCount,
+		FirstTimestamp:     formatConditionTime(e.DeprecatedFirstTimestamp),
+		LastTimestamp:      formatConditionTime(metav1.NewTime(eventsV1EventTime(e))),
+		ReportingComponent: e.ReportingController,
+	}
+	if e.Series != nil {
+		data.Count = e.Series.Count
+	}
+	if data.Count == 0 {
+		data.Count = 1
+	}
+	if data.FirstTimestamp == "" && !e.EventTime.IsZero() {
+		data.FirstTimestamp = e.EventTime.Time.UTC().Format(time.RFC3339)
+	}
+	if data.ReportingComponent == "" {
+		data.ReportingComponent = e.DeprecatedSource.Component
+	}
+	if data.InvolvedObject.Namespace == "" {
+		data.InvolvedObject.Namespace = e.Namespace
+	}
+	return data
+}
+
+func eventsV1EventTime(e *eventsv1.Event) time.Time {
+	if e.Series != nil && !e.Series.LastObservedTime.IsZero() {
+		return e.Series.LastObservedTime.Time
+	}
+	if !e.DeprecatedLastTimestamp.IsZero() {
+		return e.DeprecatedLastTimestamp.Time
+	}
+	if !e.EventTime.IsZero() {
+		return e.EventTime.Time
+	}
+	return e.CreationTimestamp.Time
+}
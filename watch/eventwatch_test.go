@@ -0,0 +1,80 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kubescape/kollector/consts"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEventsFilter(t *testing.T) {
+	filter := newEventsFilter()
+	assert.True(t, filter.matches(core.EventTypeWarning, "BackOff"))
+	assert.False(t, filter.matches(core.EventTypeNormal, "Scheduled"))
+
+	t.Setenv(consts.EventsTypesEnvironmentVariable, "Warning, Normal")
+	t.Setenv(consts.EventsReasonsEnvironmentVariable, "FailedMount,OOMKilling")
+	filter = newEventsFilter()
+	assert.True(t, filter.matches(core.EventTypeNormal, "OOMKilling"))
+	assert.False(t, filter.matches(core.EventTypeWarning, "BackOff"))
+}
+
+func TestEventsStore(t *testing.T) {
+	store := newEventsStore()
+	now := time.Now()
+	involvedObject := core.ObjectReference{Kind: "Pod", Namespace: "default", Name: "nginx-1"}
+
+	coreEvent := &core.Event{
+		ObjectMeta:     metav1.ObjectMeta{UID: "uid-1", Namespace: "default"},
+		InvolvedObject: involvedObject,
+		Type:           core.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		Count:          1,
+		LastTimestamp:  metav1.NewTime(now),
+	}
+	data, stype, changed := store.upsert(coreEvent.UID, coreV1EventToEventData(coreEvent), coreV1EventTime(coreEvent))
+	assert.True(t, changed)
+	assert.Equal(t, CREATED, stype)
+	assert.Equal(t, int32(1), data.Count)
+
+	// the same event received from the events.k8s.io API is not reported again
+	eventsV1Event := &eventsv1.Event{
+		ObjectMeta:              metav1.ObjectMeta{UID: "uid-1", Namespace: "default"},
+		Regarding:               involvedObject,
+		Type:                    core.EventTypeWarning,
+		Reason:                  "BackOff",
+		Note:                    "Back-off restarting failed container",
+		DeprecatedCount:         1,
+		DeprecatedLastTimestamp: metav1.NewTime(now),
+	}
+	_, _, changed = store.upsert(eventsV1Event.UID, eventsV1EventToEventData(eventsV1Event), eventsV1EventTime(eventsV1Event))
+	assert.False(t, changed)
+
+	// another occurrence of the same event
+	coreEvent.Count = 3
+	coreEvent.LastTimestamp = metav1.NewTime(now.Add(time.Minute))
+	data, stype, changed = store.upsert(coreEvent.UID, coreV1EventToEventData(coreEvent), coreV1EventTime(coreEvent))
+	assert.True(t, changed)
+	assert.Equal(t, UPDATED, stype)
+	assert.Equal(t, int32(3), data.Count)
+
+	// a different event object with the same involved object and reason is aggregated
+	otherEvent := coreEvent.DeepCopy()
+	otherEvent.UID = "uid-2"
+	otherEvent.Count = 2
+	data, stype, changed = store.upsert(otherEvent.UID, coreV1EventToEventData(otherEvent), coreV1EventTime(otherEvent))
+	assert.True(t, changed)
+	assert.Equal(t, UPDATED, stype)
+	assert.Equal(t, int32(5), data.Count)
+
+	_, removed := store.remove("uid-1", &involvedObject, "BackOff")
+	assert.False(t, removed)
+	data, removed = store.remove("uid-2", &involvedObject, "BackOff")
+	assert.True(t, removed)
+	assert.Equal(t, "nginx-1", data.InvolvedObject.Name)
+}
@@ -0,0 +1,281 @@
+package watch
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	podSecurityEnforceLabel        = "pod-security.kubernetes.io/enforce"
+	podSecurityEnforceVersionLabel = "pod-security.kubernetes.io/enforce-version"
+	podSecurityAuditLabel          = "pod-security.kubernetes.io/audit"
+	podSecurityAuditVersionLabel   = "pod-security.kubernetes.io/audit-version"
+	podSecurityWarnLabel           = "pod-security.kubernetes.io/warn"
+	podSecurityWarnVersionLabel    = "pod-security.kubernetes.io/warn-version"
+)
+
+// NamespaceData a namespace and its governance summary
+type NamespaceData struct {
+	*corev1.Namespace `json:",inline"`
+	Governance        NamespaceGovernance `json:"governance"`
+}
+
+// NamespaceGovernance the resource quotas, limit ranges and pod security admission levels of a namespace
+type NamespaceGovernance struct {
+	ResourceQuotas []ResourceQuotaSummary `json:"resourceQuotas,omitempty"`
+	LimitRanges    []LimitRangeSummary    `json:"limitRanges,omitempty"`
+	PodSecurity    PodSecuritySummary     `json:"podSecurity"`
+}
+
+// ResourceQuotaSummary the hard limits of a resource quota and their usage
+type ResourceQuotaSummary struct {
+	Name            string                        `json:"name"`
+	Hard            corev1.ResourceList           `json:"hard,omitempty"`
+	Used            corev1.ResourceList           `json:"used,omitempty"`
+	UsagePercentage map[corev1.ResourceName]int64 `json:"usagePercentage,omitempty"`
+	Scopes          []corev1.ResourceQuotaScope   `json:"scopes,omitempty"`
+	ScopeSelector   *corev1.ScopeSelector         `json:"scopeSelector,omitempty"`
+}
+
+// LimitRangeSummary the default and allowed limits of a limit range
+type LimitRangeSummary struct {
+	Name   string                  `json:"name"`
+	Limits []corev1.LimitRangeItem `json:"limits,omitempty"`
+}
+
+// PodSecuritySummary the pod security admission levels set by the namespace labels
+type PodSecuritySummary struct {
+	Labeled        bool   `json:"labeled"`
+	Enforce        string `json:"enforce,omitempty"`
+	EnforceVersion string `json:"enforceVersion,omitempty"`
+	Audit          string `json:"audit,omitempty"`
+	AuditVersion   string `json:"auditVersion,omitempty"`
+	Warn           string `json:"warn,omitempty"`
+	WarnVersion    string `json:"warnVersion,omitempty"`
+}
+
+// namespaceGovernanceStore the resource quotas and limit ranges of each namespace
+type namespaceGovernanceStore struct {
+	resourceQuotas map[string]map[string]*corev1.ResourceQuota
+	limitRanges    map[string]map[string]*corev1.LimitRange
+	mutex          sync.RWMutex
+}
+
+func newNamespaceGovernanceStore() *namespaceGovernanceStore {
+	return &namespaceGovernanceStore{
+		resourceQuotas: make(map[string]map[string]*corev1.ResourceQuota),
+		limitRanges:    make(map[string]map[string]*corev1.LimitRange),
+		mutex:          sync.RWMutex{},
+	}
+}
+
+// setResourceQuota stores a resource quota. Returns false if the same version is already stored
+func (store *namespaceGovernanceStore) setResourceQuota(quota *corev1.ResourceQuota) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.resourceQuotas[quota.Namespace] == nil {
+		store.resourceQuotas[quota.Namespace] = make(map[string]*corev1.ResourceQuota)
+	}
+	if stored, ok := store.resourceQuotas[quota.Namespace][quota.Name]; ok && stored.ResourceVersion == quota.ResourceVersion {
+		return false
+	}
+	store.resourceQuotas[quota.Namespace][quota.Name] = quota
+	return true
+}
+
+func (store *namespaceGovernanceStore) removeResourceQuota(quota *corev1.ResourceQuota) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.resourceQuotas[quota.Namespace][quota.Name]; !ok {
+		return false
+	}
+	delete(store.resourceQuotas[quota.Namespace], quota.Name)
+	return true
+}
+
+// setLimitRange stores a limit range. Returns false if the same version is already stored
+func (store *namespaceGovernanceStore) setLimitRange(limitRange *corev1.LimitRange) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.limitRanges[limitRange.Namespace] == nil {
+		store.limitRanges[limitRange.Namespace] = make(map[string]*corev1.LimitRange)
+	}
+	if stored, ok := store.limitRanges[limitRange.Namespace][limitRange.Name]; ok && stored.ResourceVersion == limitRange.ResourceVersion {
+		return false
+	}
+	store.limitRanges[limitRange.Namespace][limitRange.Name] = limitRange
+	return true
+}
+
+func (store *namespaceGovernanceStore) removeLimitRange(limitRange *corev1.LimitRange) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.limitRanges[limitRange.Namespace][limitRange.Name]; !ok {
+		return false
+	}
+	delete(store.limitRanges[limitRange.Namespace], limitRange.Name)
+	return true
+}
+
+// governance returns the governance summary of a namespace, sorted by name
+func (store *namespaceGovernanceStore) governance(namespace *corev1.Namespace) NamespaceGovernance {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	governance := NamespaceGovernance{PodSecurity: newPodSecuritySummary(namespace.Labels)}
+	for _, quota := range store.resourceQuotas[namespace.Name] {
+		governance.ResourceQuotas = append(governance.ResourceQuotas, newResourceQuotaSummary(quota))
+	}
+	sort.Slice(governance.ResourceQuotas, func(i, j int) bool { return governance.ResourceQuotas[i].Name < governance.ResourceQuotas[j].Name })
+	for _, limitRange := range store.limitRanges[namespace.Name] {
+		governance.LimitRanges = append(governance.LimitRanges, LimitRangeSummary{Name: limitRange.Name, Limits: limitRange.Spec.Limits})
+	}
+	sort.Slice(governance.LimitRanges, func(i, j int) bool { return governance.LimitRanges[i].Name < governance.LimitRanges[j].Name })
+	return governance
+}
+
+func newResourceQuotaSummary(quota *corev1.ResourceQuota) ResourceQuotaSummary {
+	summary := ResourceQuotaSummary{
+		Name:          quota.Name,
+		Hard:          quota.Status.Hard,
+		Used:          quota.Status.Used,
+		Scopes:        quota.Spec.Scopes,
+		ScopeSelector: quota.Spec.ScopeSelector,
+	}
+	if summary.Hard == nil {
+		// the status is not yet calculated by the quota controller
+		summary.Hard = quota.Spec.Hard
+	}
+	for name, hard := range summary.Hard {
+		used, ok := summary.Used[name]
+		if !ok || hard.IsZero() {
+			continue
+		}
+		if summary.UsagePercentage == nil {
+			summary.UsagePercentage = make(map[corev1.ResourceName]int64)
+		}
+		// the milli values of large quantities, e.g. storage, overflow when multiplied
+		summary.UsagePercentage[name] = int64(used.AsApproximateFloat64() * 100 / hard.AsApproximateFloat64())
+	}
+	return summary
+}
+
+func newPodSecuritySummary(labels map[string]string) PodSecuritySummary {
+	summary := PodSecuritySummary{
+		Enforce:        labels[podSecurityEnforceLabel],
+		EnforceVersion: labels[podSecurityEnforceVersionLabel],
+		Audit:          labels[podSecurityAuditLabel],
+		AuditVersion:   labels[podSecurityAuditVersionLabel],
+		Warn:           labels[podSecurityWarnLabel],
+		WarnVersion:    labels[podSecurityWarnVersionLabel],
+	}
+	summary.Labeled = summary.Enforce != "" || summary.Audit != "" || summary.Warn != ""
+	return summary
+}
+
+// newNamespaceData returns the namespace with its governance summary
+func (wh *WatchHandler) newNamespaceData(namespace *corev1.Namespace) *NamespaceData {
+	return &NamespaceData{
+		Namespace:  namespace,
+		Governance: wh.namespaceGovernance.governance(namespace),
+	}
+}
+
+// ResourceQuotaWatch watch over resource quotas and report the changes in the namespace governance summary
+func (wh *WatchHandler) ResourceQuotaWatch(ctx context.Context) {
+	wh.governanceWatch(ctx, "ResourceQuota", func() (watch.Interface, error) {
+		return wh.RestAPIClient.CoreV1().ResourceQuotas("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+// LimitRangeWatch watch over limit ranges and report the changes in the namespace governance summary
+func (wh *WatchHandler) LimitRangeWatch(ctx context.Context) {
+	wh.governanceWatch(ctx, "LimitRange", func() (watch.Interface, error) {
+		return wh.RestAPIClient.CoreV1().LimitRanges("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+func (wh *WatchHandler) governanceWatch(ctx context.Context, kind string, watchFunc func() (watch.Interface, error)) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER governanceWatch", helpers.String("kind", kind), helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over namespace governance starting", helpers.String("kind", kind))
+		governanceWatcher, err := watchFunc()
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over namespace governance", helpers.String("kind", kind), helpers.Error(err))
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		governanceChan := governanceWatcher.ResultChan()
+		logger.L().Info("Watching over namespace governance started", helpers.String("kind", kind))
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-governanceChan:
+			case <-newStateChan:
+				governanceWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("namespace governance watch chan loop", helpers.String("kind", kind), helpers.Interface("error", event.Object))
+				governanceWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.governanceEventHandler(&event); err != nil {
+				break ChanLoop
+			}
+		}
+		logger.L().Debug("Watching over namespace governance ended - timeout", helpers.String("kind", kind))
+	}
+}
+
+func (wh *WatchHandler) governanceEventHandler(event *watch.Event) error {
+	var namespace string
+	changed := false
+	switch obj := event.Object.(type) {
+	case *corev1.ResourceQuota:
+		namespace = obj.Namespace
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			changed = wh.namespaceGovernance.setResourceQuota(obj)
+		case watch.Deleted:
+			changed = wh.namespaceGovernance.removeResourceQuota(obj)
+		}
+	case *corev1.LimitRange:
+		namespace = obj.Namespace
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			changed = wh.namespaceGovernance.setLimitRange(obj)
+		case watch.Deleted:
+			changed = wh.namespaceGovernance.removeLimitRange(obj)
+		}
+	default:
+		return fmt.Errorf("got unexpected namespace governance object from chan")
+	}
+	if !changed {
+		return nil
+	}
+	// the namespace is reported once it is received by the namespaces watcher
+	if ns := wh.getNamespace(namespace); ns != nil {
+		wh.jsonReport.AddToJsonFormat(wh.newNamespaceData(ns), NAMESPACES, UPDATED)
+		informNewDataArrive(wh)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestNewResourceQuotaSummary(t *testing.T) {
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "team-a"},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("4"), corev1.ResourcePods: resource.MustParse("10"), corev1.ResourceServices: resource.MustParse("0")},
+			Used: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("500m"), corev1.ResourcePods: resource.MustParse("10"), corev1.ResourceServices: resource.MustParse("0")},
+		},
+	}
+	summary := newResourceQuotaSummary(quota)
+	assert.Equal(t, map[corev1.ResourceName]int64{corev1.ResourceRequestsCPU: 12, corev1.ResourcePods: 100}, summary.UsagePercentage)
+
+	quota.Status.Hard = corev1.ResourceList{corev1.ResourceRequestsStorage: resource.MustParse("200Ti")}
+	quota.Status.Used = corev1.ResourceList{corev1.ResourceRequestsStorage: resource.MustParse("50Ti")}
+	summary = newResourceQuotaSummary(quota)
+	assert.Equal(t, map[corev1.ResourceName]int64{corev1.ResourceRequestsStorage: 25}, summary.UsagePercentage)
+
+	quota.Status = corev1.ResourceQuotaStatus{}
+	quota.Spec.Hard = corev1.ResourceList{corev1.ResourcePods: resource.MustParse("10")}
+	summary = newResourceQuotaSummary(quota)
+	assert.Equal(t, quota.Spec.Hard, summary.Hard)
+	assert.Nil(t, summary.UsagePercentage)
+}
+
+func TestNewPodSecuritySummary(t *testing.T) {
+	assert.False(t, newPodSecuritySummary(nil).Labeled)
+	summary := newPodSecuritySummary(map[string]string{podSecurityEnforceLabel: "restricted", podSecurityEnforceVersionLabel: "v1.27", podSecurityWarnLabel: "baseline"})
+	assert.True(t, summary.Labeled)
+	assert.Equal(t, "restricted", summary.Enforce)
+	assert.Equal(t, "v1.27", summary.EnforceVersion)
+	assert.Equal(t, "baseline", summary.Warn)
+	assert.Empty(t, summary.Audit)
+}
+
+func TestGovernanceEventHandler(t *testing.T) {
+	wh := &WatchHandler{
+		namespacedm:            newResourceMap(),
+		namespaceGovernance:    newNamespaceGovernanceStore(),
+		aggregateFirstDataFlag: true,
+	}
+	limitRange := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "team-a", ResourceVersion: "1"},
+		Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{
+			Type:    corev1.LimitTypeContainer,
+			Default: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+		}}},
+	}
+	// the namespace is not yet received, nothing is reported
+	assert.NoError(t, wh.governanceEventHandler(&watch.Event{Type: watch.Added, Object: limitRange}))
+	assert.Nil(t, wh.jsonReport.Namespace)
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}
+	id := CreateID()
+	wh.namespacedm.init(id)
+	wh.namespacedm.pushBack(id, namespace)
+	data := wh.newNamespaceData(namespace)
+	assert.Len(t, data.Governance.LimitRanges, 1)
+	assert.Equal(t, "defaults", data.Governance.LimitRanges[0].Name)
+
+	quota := &corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "team-a", ResourceVersion: "1"}}
+	assert.NoError(t, wh.governanceEventHandler(&watch.Event{Type: watch.Added, Object: quota}))
+	assert.Len(t, wh.jsonReport.Namespace.Updated, 1)
+	data = wh.jsonReport.Namespace.Updated[0].(*NamespaceData)
+	assert.Equal(t, "team-a", data.Name)
+	assert.Len(t, data.Governance.ResourceQuotas, 1)
+
+	// the same version is received again after the watch is restarted
+	assert.NoError(t, wh.governanceEventHandler(&watch.Event{Type: watch.Added, Object: quota}))
+	assert.Len(t, wh.jsonReport.Namespace.Updated, 1)
+
+	assert.NoError(t, wh.governanceEventHandler(&watch.Event{Type: watch.Deleted, Object: quota}))
+	assert.Len(t, wh.jsonReport.Namespace.Updated, 2)
+	assert.Empty(t, wh.jsonReport.Namespace.Updated[1].(*NamespaceData).Governance.ResourceQuotas)
+}
@@ -0,0 +1,51 @@
+package watch
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/kubescape/go-logger"
+	"github.com/kubescape/kollector/consts"
+)
+
+const (
+	keyedHashPrefix = "hmac-sha256:"
+	hashKeySize     = 32
+)
+
+// hashKey the key of the reported hashes, a random per process key unless the key of the installation is set
+var hashKey = newHashKey()
+
+func newHashKey() []byte {
+	key := make([]byte, hashKeySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// keyedHash returns the HMAC of the content, the hashed values cannot be recovered by hashing guesses without the key
+func keyedHash(content []byte) string {
+	mac := hmac.New(sha256.New, hashKey)
+	mac.Write(content)
+	return keyedHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// loadEnvHashKey sets the key of the reported hashes to the key supplied by the deployment, so the hashes are stable across restarts.
+// It must be called before the watchers are started
+func loadEnvHashKey() error {
+	key, ok := os.LookupEnv(consts.HashKeyEnvironmentVariable)
+	if !ok {
+		logger.L().Warning("the hash key is not set, the reported hashes are changed on restart")
+		return nil
+	}
+	if len(key) < hashKeySize {
+		return fmt.Errorf("the hash key is shorter than %d bytes", hashKeySize)
+	}
+	hashKey = []byte(key)
+	return nil
+}
@@ -0,0 +1,30 @@
+package watch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kubescape/kollector/consts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEnvHashKey(t *testing.T) {
+	defer func(key []byte) { hashKey = key }(hashKey)
+	key := strings.Repeat("k", hashKeySize)
+	t.Setenv(consts.HashKeyEnvironmentVariable, key)
+	assert.NoError(t, loadEnvHashKey())
+	assert.Equal(t, []byte(key), hashKey)
+
+	t.Setenv(consts.HashKeyEnvironmentVariable, "short")
+	assert.Error(t, loadEnvHashKey())
+}
+
+func TestKeyedHash(t *testing.T) {
+	hash := keyedHash([]byte("hunter2"))
+	assert.Regexp(t, "^"+keyedHashPrefix+"[0-9a-f]{64}$", hash)
+	assert.Equal(t, hash, keyedHash([]byte("hunter2")))
+
+	defer func(key []byte) { hashKey = key }(hashKey)
+	hashKey = newHashKey()
+	assert.NotEqual(t, hash, keyedHash([]byte("hunter2")))
+}
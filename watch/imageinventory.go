@@ -0,0 +1,299 @@
+package watch
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	defaultImageRegistry  = "docker.io"
+	defaultImageTag       = "latest"
+	officialImagesPrefix  = "library/"
+	legacyDefaultRegistry = "index.docker.io"
+	digestPrefix          = "sha256:"
+)
+
+// ImageData an image running in the cluster, identified by its normalized reference and the resolved digest
+type ImageData struct {
+	Image      string `json:"image"`
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest"`
+	// ConfigID the image config ID reported by the runtime when the repo digest is not known, e.g. a locally built image
+	ConfigID  string          `json:"configID,omitempty"`
+	Workloads []ImageWorkload `json:"workloads,omitempty"`
+	Nodes     []string        `json:"nodes,omitempty"`
+	FirstSeen string          `json:"firstSeen"`
+	LastSeen  string          `json:"lastSeen"`
+}
+
+// ImageWorkload a workload running an image
+type ImageWorkload struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+}
+
+func newImageWorkload(pod *core.Pod, owner *OwnerDet) ImageWorkload {
+	return ImageWorkload{Namespace: pod.Namespace, Kind: owner.Kind, Name: owner.Name}
+}
+
+type imageUsage struct {
+	workload ImageWorkload
+	node     string
+}
+
+type imageRecord struct {
+	data  ImageData
+	users map[string]imageUsage
+}
+
+// imageInventory the images of the running containers, updated by the pod watcher
+type imageInventory struct {
+	images    map[string]*imageRecord
+	podImages map[string]map[string]bool
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+func newImageInventory() *imageInventory {
+	return &imageInventory{
+		images:    make(map[string]*imageRecord),
+		podImages: make(map[string]map[string]bool),
+		now:       time.Now,
+	}
+}
+
+// imageDeltas the images to report after a change of the inventory
+type imageDeltas struct {
+	created []ImageData
+	updated []ImageData
+	deleted []ImageData
+}
+
+func (deltas imageDeltas) isEmpty() bool {
+	return len(deltas.created) == 0 && len(deltas.updated) == 0 && len(deltas.deleted) == 0
+}
+
+// setPod sets the images of a pod. The containers which their image is not resolved yet are not in the inventory
+func (inventory *imageInventory) setPod(pod *core.Pod, workload ImageWorkload) imageDeltas {
+	usage := imageUsage{workload: workload, node: pod.Spec.NodeName}
+	images := make(map[string]ImageData)
+	for _, container := range podContainerImages(pod) {
+		if data, ok := newImageData(container.image, container.imageID); ok {
+			images[data.key()] = data
+		}
+	}
+	return inventory.update(podKey(pod.Namespace, pod.Name), images, usage)
+}
+
+// removePod removes the images of a deleted pod
+func (inventory *imageInventory) removePod(namespace, name string) imageDeltas {
+	return inventory.update(podKey(namespace, name), nil, imageUsage{})
+}
+
+func (inventory *imageInventory) update(pod string, images map[string]ImageData, usage imageUsage) imageDeltas {
+	inventory.mutex.Lock()
+	defer inventory.mutex.Unlock()
+	deltas := imageDeltas{}
+	now := inventory.now().UTC().Format(time.RFC3339)
+	for key, data := range images {
+		record, ok := inventory.images[key]
+		if !ok {
+			data.FirstSeen = now
+			record = &imageRecord{data: data, users: make(map[string]imageUsage)}
+			inventory.images[key] = record
+		}
+		record.data.LastSeen = now
+		previous, used := record.users[pod]
+		record.users[pod] = usage
+		switch {
+		case !ok:
+			deltas.created = append(deltas.created, record.report())
+		case !used || previous != usage:
+			deltas.updated = append(deltas.updated, record.report())
+		}
+	}
+	for key := range inventory.podImages[pod] {
+		if _, ok := images[key]; ok {
+			continue
+		}
+		record, ok := inventory.images[key]
+		if !ok {
+			continue
+		}
+		delete(record.users, pod)
+		record.data.LastSeen = now
+		if len(record.users) == 0 {
+			delete(inventory.images, key)
+			deltas.deleted = append(deltas.deleted, record.report())
+		} else {
+			deltas.updated = append(deltas.updated, record.report())
+		}
+	}
+	if len(images) == 0 {
+		delete(inventory.podImages, pod)
+	} else {
+		keys := make(map[string]bool, len(images))
+		for key := range images {
+			keys[key] = true
+		}
+		inventory.podImages[pod] = keys
+	}
+	return deltas
+}
+
+// report returns the image with the workloads and nodes using it, sorted
+func (record *imageRecord) report() ImageData {
+	data := record.data
+	workloads := make(map[ImageWorkload]bool)
+	nodes := make(map[string]bool)
+	for _, usage := range record.users {
+		workloads[usage.workload] = true
+		if usage.node != "" {
+			nodes[usage.node] = true
+		}
+	}
+	data.Workloads = make([]ImageWorkload, 0, len(workloads))
+	for workload := range workloads {
+		data.Workloads = append(data.Workloads, workload)
+	}
+	sort.Slice(data.Workloads, func(i, j int) bool {
+		a, b := data.Workloads[i], data.Workloads[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	data.Nodes = make([]string, 0, len(nodes))
+	for node := range nodes {
+		data.Nodes = append(data.Nodes, node)
+	}
+	sort.Strings(data.Nodes)
+	return data
+}
+
+type containerImage struct {
+	image   string
+	imageID string
+}
+
+// podContainerImages returns the images of the containers, the init containers and the ephemeral containers with their resolved image IDs
+func podContainerImages(pod *core.Pod) []containerImage {
+	imageIDs := make(map[string]string)
+	for _, statuses := range [][]core.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses, pod.Status.EphemeralContainerStatuses} {
+		for i := range statuses {
+			imageIDs[statuses[i].Name] = statuses[i].ImageID
+		}
+	}
+	var images []containerImage
+	for i := range pod.Spec.InitContainers {
+		images = append(images, containerImage{image: pod.Spec.InitContainers[i].Image, imageID: imageIDs[pod.Spec.InitContainers[i].Name]})
+	}
+	for i := range pod.Spec.Containers {
+		images = append(images, containerImage{image: pod.Spec.Containers[i].Image, imageID: imageIDs[pod.Spec.Containers[i].Name]})
+	}
+	for i := range pod.Spec.EphemeralContainers {
+		images = append(images, containerImage{image: pod.Spec.EphemeralContainers[i].Image, imageID: imageIDs[pod.Spec.EphemeralContainers[i].Name]})
+	}
+	return images
+}
+
+// newImageData returns the image of a container, false if the image is not resolved yet
+func newImageData(image, imageID string) (ImageData, bool) {
+	registry, repository, tag, digest := normalizeImageReference(image)
+	if resolved := imageDigest(imageID); resolved != "" {
+		digest = resolved
+	}
+	var configID string
+	if digest == "" {
+		configID = imageConfigID(imageID)
+	}
+	if repository == "" || (digest == "" && configID == "") {
+		return ImageData{}, false
+	}
+	data := ImageData{Registry: registry, Repository: repository, Tag: tag, Digest: digest, ConfigID: configID}
+	data.Image = registry + "/" + repository
+	if tag != "" {
+		data.Image += ":" + tag
+	}
+	return data, true
+}
+
+// key returns the inventory key of an image, by its repo digest or by its config ID when the digest is not known
+func (data *ImageData) key() string {
+	if data.Digest == "" {
+		return data.Image + "@" + data.ConfigID
+	}
+	return data.Image + "@" + data.Digest
+}
+
+// normalizeImageReference splits an image reference to the registry, the repository, the tag and the digest, with the Docker Hub defaults
+func normalizeImageReference(image string) (registry, repository, tag, digest string) {
+	image = strings.TrimSpace(image)
+	if i := strings.Index(image, "@"); i >= 0 {
+		image, digest = image[:i], image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image, tag = image[:i], image[i+1:]
+	}
+	registry = defaultImageRegistry
+	if i := strings.Index(image, "/"); i >= 0 {
+		// the first component is a registry if it is a host name
+		if first := image[:i]; strings.ContainsAny(first, ".:") || first == "localhost" {
+			registry, image = first, image[i+1:]
+		}
+	}
+	if registry == legacyDefaultRegistry {
+		registry = defaultImageRegistry
+	}
+	if registry == defaultImageRegistry && image != "" && !strings.Contains(image, "/") {
+		image = officialImagesPrefix + image
+	}
+	if tag == "" && digest == "" {
+		tag = defaultImageTag
+	}
+	return registry, image, tag, digest
+}
+
+// imageDigest returns the repo digest of a container status image ID, e.g. docker-pullable://nginx@sha256:...
+func imageDigest(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 && strings.HasPrefix(imageID[i+1:], digestPrefix) {
+		return imageID[i+1:]
+	}
+	return ""
+}
+
+// imageConfigID returns the image config ID of a container status image ID without a repo digest, e.g. sha256:... or docker://sha256:...
+func imageConfigID(imageID string) string {
+	if _, id, ok := strings.Cut(imageID, "://"); ok {
+		imageID = id
+	}
+	if strings.HasPrefix(imageID, digestPrefix) {
+		return imageID
+	}
+	return ""
+}
+
+func (wh *WatchHandler) reportImageDeltas(deltas imageDeltas) {
+	for i := range deltas.created {
+		wh.jsonReport.AddToJsonFormat(deltas.created[i], IMAGES, CREATED)
+	}
+	for i := range deltas.updated {
+		wh.jsonReport.AddToJsonFormat(deltas.updated[i], IMAGES, UPDATED)
+	}
+	for i := range deltas.deleted {
+		wh.jsonReport.AddToJsonFormat(deltas.deleted[i], IMAGES, DELETED)
+	}
+	if !deltas.isEmpty() {
+		informNewDataArrive(wh)
+	}
+}
@@ -0,0 +1,147 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNormalizeImageReference(t *testing.T) {
+	tests := []struct {
+		image      string
+		registry   string
+		repository string
+		tag        string
+		digest     string
+	}{
+		{image: "nginx", registry: "docker.io", repository: "library/nginx", tag: "latest"},
+		{image: "nginx:1.25", registry: "docker.io", repository: "library/nginx", tag: "1.25"},
+		{image: "bitnami/redis:7.0", registry: "docker.io", repository: "bitnami/redis", tag: "7.0"},
+		{image: "index.docker.io/library/nginx:1.25", registry: "docker.io", repository: "library/nginx", tag: "1.25"},
+		{image: "quay.io/kubescape/kollector:v0.1.2", registry: "quay.io", repository: "kubescape/kollector", tag: "v0.1.2"},
+		{image: "localhost:5000/app", registry: "localhost:5000", repository: "app", tag: "latest"},
+		{image: "gcr.io/project/app@sha256:abc", registry: "gcr.io", repository: "project/app", digest: "sha256:abc"},
+		{image: "registry.k8s.io/pause:3.9@sha256:def", registry: "registry.k8s.io", repository: "pause", tag: "3.9", digest: "sha256:def"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			registry, repository, tag, digest := normalizeImageReference(tt.image)
+			assert.Equal(t, tt.registry, registry)
+			assert.Equal(t, tt.repository, repository)
+			assert.Equal(t, tt.tag, tag)
+			assert.Equal(t, tt.digest, digest)
+		})
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	assert.Equal(t, "sha256:abc", imageDigest("docker-pullable://nginx@sha256:abc"))
+	assert.Equal(t, "sha256:abc", imageDigest("docker.io/library/nginx@sha256:abc"))
+	assert.Equal(t, "", imageDigest("sha256:abc"), "a config ID is not a repo digest")
+	assert.Equal(t, "", imageDigest("docker://sha256:abc"))
+	assert.Equal(t, "", imageDigest(""))
+
+	assert.Equal(t, "sha256:abc", imageConfigID("sha256:abc"))
+	assert.Equal(t, "sha256:abc", imageConfigID("docker://sha256:abc"))
+	assert.Equal(t, "", imageConfigID("docker-pullable://nginx@sha256:abc"))
+}
+
+func TestNewImageDataConfigID(t *testing.T) {
+	data, ok := newImageData("app:dev", "docker://sha256:c")
+	assert.True(t, ok)
+	assert.Empty(t, data.Digest)
+	assert.Equal(t, "sha256:c", data.ConfigID)
+	assert.Equal(t, "docker.io/library/app:dev@sha256:c", data.key())
+
+	// the digest of the reference is kept when the runtime reports a config ID
+	data, ok = newImageData("gcr.io/project/app@sha256:abc", "sha256:c")
+	assert.True(t, ok)
+	assert.Equal(t, "sha256:abc", data.Digest)
+	assert.Empty(t, data.ConfigID)
+}
+
+func newImagesPod(name, node string, imageIDs ...string) *core.Pod {
+	pod := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: core.PodSpec{
+			NodeName:       node,
+			InitContainers: []core.Container{{Name: "init", Image: "busybox"}},
+			Containers:     []core.Container{{Name: "nginx", Image: "nginx:1.25"}},
+		},
+	}
+	if len(imageIDs) == 2 {
+		pod.Status.InitContainerStatuses = []core.ContainerStatus{{Name: "init", ImageID: imageIDs[0]}}
+		pod.Status.ContainerStatuses = []core.ContainerStatus{{Name: "nginx", ImageID: imageIDs[1]}}
+	}
+	return pod
+}
+
+func TestImageInventory(t *testing.T) {
+	now := time.Date(2023, 8, 1, 10, 0, 0, 0, time.UTC)
+	inventory := newImageInventory()
+	inventory.now = func() time.Time { return now }
+	workload := ImageWorkload{Namespace: "default", Kind: "Deployment", Name: "web"}
+
+	// the images are not resolved yet
+	deltas := inventory.setPod(newImagesPod("web-a", "node-1"), workload)
+	assert.True(t, deltas.isEmpty())
+
+	deltas = inventory.setPod(newImagesPod("web-a", "node-1", "docker-pullable://busybox@sha256:b", "docker-pullable://nginx@sha256:n"), workload)
+	assert.Len(t, deltas.created, 2)
+	assert.Empty(t, deltas.updated)
+	nginx := deltas.created[1]
+	if nginx.Repository != "library/nginx" {
+		nginx = deltas.created[0]
+	}
+	assert.Equal(t, ImageData{
+		Image:      "docker.io/library/nginx:1.25",
+		Registry:   "docker.io",
+		Repository: "library/nginx",
+		Tag:        "1.25",
+		Digest:     "sha256:n",
+		Workloads:  []ImageWorkload{workload},
+		Nodes:      []string{"node-1"},
+		FirstSeen:  "2023-08-01T10:00:00Z",
+		LastSeen:   "2023-08-01T10:00:00Z",
+	}, nginx)
+
+	// no change
+	assert.True(t, inventory.setPod(newImagesPod("web-a", "node-1", "docker-pullable://busybox@sha256:b", "docker-pullable://nginx@sha256:n"), workload).isEmpty())
+
+	// another pod on another node
+	now = now.Add(time.Hour)
+	deltas = inventory.setPod(newImagesPod("web-b", "node-2", "docker-pullable://busybox@sha256:b", "docker-pullable://nginx@sha256:n"), workload)
+	assert.Len(t, deltas.updated, 2)
+	assert.Equal(t, []string{"node-1", "node-2"}, deltas.updated[0].Nodes)
+	assert.Equal(t, "2023-08-01T10:00:00Z", deltas.updated[0].FirstSeen)
+	assert.Equal(t, "2023-08-01T11:00:00Z", deltas.updated[0].LastSeen)
+
+	// the tag was moved, the new digest is a new image
+	deltas = inventory.setPod(newImagesPod("web-b", "node-2", "docker-pullable://busybox@sha256:b", "docker-pullable://nginx@sha256:n2"), workload)
+	assert.Len(t, deltas.created, 1)
+	assert.Equal(t, "sha256:n2", deltas.created[0].Digest)
+	assert.Len(t, deltas.updated, 1)
+	assert.Equal(t, []string{"node-1"}, deltas.updated[0].Nodes)
+
+	deltas = inventory.removePod("default", "web-a")
+	assert.Len(t, deltas.deleted, 1)
+	assert.Equal(t, "sha256:n", deltas.deleted[0].Digest)
+	assert.Len(t, deltas.updated, 1)
+
+	deltas = inventory.removePod("default", "web-b")
+	assert.Len(t, deltas.deleted, 2)
+	assert.Empty(t, inventory.images)
+	assert.Empty(t, inventory.podImages)
+}
+
+func TestReportImageDeltas(t *testing.T) {
+	wh := &WatchHandler{images: newImageInventory(), aggregateFirstDataFlag: true}
+	pod := newImagesPod("web-a", "node-1", "docker-pullable://busybox@sha256:b", "docker-pullable://nginx@sha256:n")
+	wh.reportImageDeltas(wh.images.setPod(pod, ImageWorkload{Namespace: "default", Kind: "Deployment", Name: "web"}))
+	assert.Len(t, wh.jsonReport.Images.Created, 2)
+	wh.reportImageDeltas(wh.images.removePod("default", "web-a"))
+	assert.Len(t, wh.jsonReport.Images.Deleted, 2)
+}
@@ -19,6 +19,9 @@ import (
 
 var defaultClientInClusterTrigger = http.DefaultClient
 
+// the scan command argument of the containers which their image changed
+const changedContainersArg = "containers"
+
 func newInClusterNotifier(config config.IConfig) iClusterNotifier {
 	trigger := os.Getenv(consts.ActivateScanOnNewImageFeatureEnvironmentVariable)
 	if !boolutils.StringToBool(trigger) {
@@ -28,7 +31,7 @@ func newInClusterNotifier(config config.IConfig) iClusterNotifier {
 }
 
 type iClusterNotifier interface {
-	notifyNewMicroServiceCreatedInTheCluster(namespace string, k8sType string, name string) error
+	notifyNewMicroServiceCreatedInTheCluster(namespace string, k8sType string, name string, containers []ChangedContainer) error
 }
 
 type clusterNotifierImpl struct {
@@ -46,12 +49,12 @@ func newClusterNotifierImpl(customerGuid, clusterName, notifierHost string) *clu
 	}
 }
 
-func (notifier *clusterNotifierImpl) notifyNewMicroServiceCreatedInTheCluster(namespace string, k8sType string, name string) error {
+func (notifier *clusterNotifierImpl) notifyNewMicroServiceCreatedInTheCluster(namespace string, k8sType string, name string, containers []ChangedContainer) error {
 
 	var body *bytes.Buffer
 	var err error
 
-	if body, err = notifier.createNotificationPostJson(namespace, k8sType, name); err != nil {
+	if body, err = notifier.createNotificationPostJson(namespace, k8sType, name, containers); err != nil {
 		return fmt.Errorf("createNotificationPostJson: fail to create notification post json with err %v", err)
 	}
 
@@ -62,11 +65,16 @@ func (notifier *clusterNotifierImpl) notifyNewMicroServiceCreatedInTheCluster(na
 	return nil
 }
 
-func (notifier *clusterNotifierImpl) createNotificationPostJson(namespace string, k8sType string, name string) (*bytes.Buffer, error) {
+func (notifier *clusterNotifierImpl) createNotificationPostJson(namespace string, k8sType string, name string, containers []ChangedContainer) (*bytes.Buffer, error) {
 
 	cmds := apis.Commands{}
 	wlid := "wlid://cluster-" + notifier.clusterName + "/namespace-" + namespace + "/" + k8sType + "-" + name // TODO: Use a wlid generator function
-	cmds.Commands = append(cmds.Commands, apis.Command{CommandName: apis.TypeScanImages, Wlid: wlid})
+	cmd := apis.Command{CommandName: apis.TypeScanImages, Wlid: wlid}
+	if len(containers) > 0 {
+		// scan only the containers which their image changed
+		cmd.Args = map[string]interface{}{changedContainersArg: containers}
+	}
+	cmds.Commands = append(cmds.Commands, cmd)
 
 	notification := notificationserver.Notification{
 		Target: map[string]string{
@@ -121,6 +129,6 @@ func newSkipInClusterNotifier(customerGuid, clusterName, notifierHost string) *s
 	return &skipInClusterNotifier{}
 }
 
-func (skip *skipInClusterNotifier) notifyNewMicroServiceCreatedInTheCluster(namespace string, k8sType string, name string) error {
+func (skip *skipInClusterNotifier) notifyNewMicroServiceCreatedInTheCluster(namespace string, k8sType string, name string, containers []ChangedContainer) error {
 	return nil
 }
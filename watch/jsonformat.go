@@ -3,6 +3,7 @@ package watch
 import (
 	"context"
 	"encoding/json"
+	"sync"
 
 	"github.com/armosec/armoapi-go/armotypes"
 	"github.com/armosec/utils-k8s-go/armometadata"
@@ -21,6 +22,20 @@ const (
 	PODS          JsonType = 4
 	SECRETS       JsonType = 5
 	NAMESPACES    JsonType = 6
+
+	PERSISTENTVOLUMES          JsonType = 7
+	PERSISTENTVOLUMECLAIMS     JsonType = 8
+	STORAGECLASSES             JsonType = 9
+	EVENTS                     JsonType = 10
+	SERVICEENDPOINTS           JsonType = 11
+	ADMISSIONWEBHOOKS          JsonType = 12
+	CUSTOMRESOURCEDEFINITIONS  JsonType = 13
+	HORIZONTALPODAUTOSCALERS   JsonType = 14
+	PODDISRUPTIONBUDGETS       JsonType = 15
+	CERTIFICATESIGNINGREQUESTS JsonType = 16
+	PRIORITYCLASSES            JsonType = 17
+	RUNTIMECLASSES             JsonType = 18
+	IMAGES                     JsonType = 19
 )
 
 const (
@@ -41,16 +56,31 @@ type ObjectData struct {
 }
 
 type jsonFormat struct {
-	FirstReport             bool                        `json:"firstReport"`
-	ClusterAPIServerVersion *version.Info               `json:"clusterAPIServerVersion,omitempty"`
-	CloudVendor             string                      `json:"cloudVendor,omitempty"`
-	Nodes                   *ObjectData                 `json:"node,omitempty"`
-	Services                *ObjectData                 `json:"service,omitempty"`
-	MicroServices           *ObjectData                 `json:"microservice,omitempty"`
-	Pods                    *ObjectData                 `json:"pod,omitempty"`
-	Secret                  *ObjectData                 `json:"secret,omitempty"`
-	Namespace               *ObjectData                 `json:"namespace,omitempty"`
-	InstallationData        *armotypes.InstallationData `json:"installationData,omitempty"`
+	FirstReport                bool                        `json:"firstReport"`
+	ClusterAPIServerVersion    *version.Info               `json:"clusterAPIServerVersion,omitempty"`
+	CloudMetadata              *CloudMetadata              `json:"cloudMetadata,omitempty"`
+	ClusterIdentity            *ClusterIdentity            `json:"clusterIdentity,omitempty"`
+	Nodes                      *ObjectData                 `json:"node,omitempty"`
+	Services                   *ObjectData                 `json:"service,omitempty"`
+	MicroServices              *ObjectData                 `json:"microservice,omitempty"`
+	Pods                       *ObjectData                 `json:"pod,omitempty"`
+	Secret                     *ObjectData                 `json:"secret,omitempty"`
+	Namespace                  *ObjectData                 `json:"namespace,omitempty"`
+	PersistentVolumes          *ObjectData                 `json:"persistentVolume,omitempty"`
+	PersistentVolumeClaims     *ObjectData                 `json:"persistentVolumeClaim,omitempty"`
+	StorageClasses             *ObjectData                 `json:"storageClass,omitempty"`
+	Events                     *ObjectData                 `json:"events,omitempty"`
+	ServiceEndpoints           *ObjectData                 `json:"serviceEndpoints,omitempty"`
+	AdmissionWebhooks          *ObjectData                 `json:"admissionWebhookConfiguration,omitempty"`
+	CustomResourceDefinitions  *ObjectData                 `json:"customResourceDefinition,omitempty"`
+	HorizontalPodAutoscalers   *ObjectData                 `json:"horizontalPodAutoscaler,omitempty"`
+	PodDisruptionBudgets       *ObjectData                 `json:"podDisruptionBudget,omitempty"`
+	CertificateSigningRequests *ObjectData                 `json:"certificateSigningRequest,omitempty"`
+	PriorityClasses            *ObjectData                 `json:"priorityClass,omitempty"`
+	RuntimeClasses             *ObjectData                 `json:"runtimeClass,omitempty"`
+	Images                     *ObjectData                 `json:"images,omitempty"`
+	CustomResources            map[string]*ObjectData      `json:"customResources,omitempty"`
+	InstallationData           *armotypes.InstallationData `json:"installationData,omitempty"`
 }
 
 func (obj *ObjectData) AddToJsonFormatByState(NewData interface{}, stype StateType) {
@@ -82,6 +112,13 @@ func (obj *ObjectData) Len() int {
 }
 
 func (jsonReport *jsonFormat) AddToJsonFormat(data interface{}, jtype JsonType, stype StateType) {
+	if jtype == MICROSERVICES {
+		if stype != DELETED {
+			data = setSecuritySummary(data)
+		}
+		data = getRedactor().redactMicroService(data)
+	}
+	data = getReportPolicy().apply(data, jsonTypeSections[jtype])
 	switch jtype {
 	case NODE:
 		if jsonReport.Nodes == nil {
@@ -113,12 +150,114 @@ func (jsonReport *jsonFormat) AddToJsonFormat(data interface{}, jtype JsonType,
 			jsonReport.Namespace = &ObjectData{}
 		}
 		jsonReport.Namespace.AddToJsonFormatByState(data, stype)
+	case PERSISTENTVOLUMES:
+		if jsonReport.PersistentVolumes == nil {
+			jsonReport.PersistentVolumes = &ObjectData{}
+		}
+		jsonReport.PersistentVolumes.AddToJsonFormatByState(data, stype)
+	case PERSISTENTVOLUMECLAIMS:
+		if jsonReport.PersistentVolumeClaims == nil {
+			jsonReport.PersistentVolumeClaims = &ObjectData{}
+		}
+		jsonReport.PersistentVolumeClaims.AddToJsonFormatByState(data, stype)
+	case STORAGECLASSES:
+		if jsonReport.StorageClasses == nil {
+			jsonReport.StorageClasses = &ObjectData{}
+		}
+		jsonReport.StorageClasses.AddToJsonFormatByState(data, stype)
+	case EVENTS:
+		if jsonReport.Events == nil {
+			jsonReport.Events = &ObjectData{}
+		}
+		jsonReport.Events.AddToJsonFormatByState(data, stype)
+	case SERVICEENDPOINTS:
+		if jsonReport.ServiceEndpoints == nil {
+			jsonReport.ServiceEndpoints = &ObjectData{}
+		}
+		jsonReport.ServiceEndpoints.AddToJsonFormatByState(data, stype)
+	case ADMISSIONWEBHOOKS:
+		if jsonReport.AdmissionWebhooks == nil {
+			jsonReport.AdmissionWebhooks = &ObjectData{}
+		}
+		jsonReport.AdmissionWebhooks.AddToJsonFormatByState(data, stype)
+	case CUSTOMRESOURCEDEFINITIONS:
+		if jsonReport.CustomResourceDefinitions == nil {
+			jsonReport.CustomResourceDefinitions = &ObjectData{}
+		}
+		jsonReport.CustomResourceDefinitions.AddToJsonFormatByState(data, stype)
+	case HORIZONTALPODAUTOSCALERS:
+		if jsonReport.HorizontalPodAutoscalers == nil {
+			jsonReport.HorizontalPodAutoscalers = &ObjectData{}
+		}
+		jsonReport.HorizontalPodAutoscalers.AddToJsonFormatByState(data, stype)
+	case PODDISRUPTIONBUDGETS:
+		if jsonReport.PodDisruptionBudgets == nil {
+			jsonReport.PodDisruptionBudgets = &ObjectData{}
+		}
+		jsonReport.PodDisruptionBudgets.AddToJsonFormatByState(data, stype)
+	case CERTIFICATESIGNINGREQUESTS:
+		if jsonReport.CertificateSigningRequests == nil {
+			jsonReport.CertificateSigningRequests = &ObjectData{}
+		}
+		jsonReport.CertificateSigningRequests.AddToJsonFormatByState(data, stype)
+	case PRIORITYCLASSES:
+		if jsonReport.PriorityClasses == nil {
+			jsonReport.PriorityClasses = &ObjectData{}
+		}
+		jsonReport.PriorityClasses.AddToJsonFormatByState(data, stype)
+	case RUNTIMECLASSES:
+		if jsonReport.RuntimeClasses == nil {
+			jsonReport.RuntimeClasses = &ObjectData{}
+		}
+		jsonReport.RuntimeClasses.AddToJsonFormatByState(data, stype)
+	case IMAGES:
+		if jsonReport.Images == nil {
+			jsonReport.Images = &ObjectData{}
+		}
+		jsonReport.Images.AddToJsonFormatByState(data, stype)
 	}
 
 }
 
+// customResourcesMutex guards the customResources section, written by the informer goroutine of each GroupVersionResource
+var customResourcesMutex sync.Mutex
+
+// AddCustomResourceToJsonFormat adds an object to the customResources section, keyed by its GroupVersionResource
+func (jsonReport *jsonFormat) AddCustomResourceToJsonFormat(gvr string, data interface{}, stype StateType) {
+	data = getReportPolicy().apply(data, customResourcesSection, gvr)
+	customResourcesMutex.Lock()
+	defer customResourcesMutex.Unlock()
+	if jsonReport.CustomResources == nil {
+		jsonReport.CustomResources = make(map[string]*ObjectData)
+	}
+	if jsonReport.CustomResources[gvr] == nil {
+		jsonReport.CustomResources[gvr] = &ObjectData{}
+	}
+	jsonReport.CustomResources[gvr].AddToJsonFormatByState(data, stype)
+}
+
+// takeCustomResources returns the not empty custom resources and removes them from the report, the informers keep adding to a new section
+func (jsonReport *jsonFormat) takeCustomResources() map[string]*ObjectData {
+	customResourcesMutex.Lock()
+	defer customResourcesMutex.Unlock()
+	var customResources map[string]*ObjectData
+	for gvr, data := range jsonReport.CustomResources {
+		if data.Len() == 0 {
+			continue
+		}
+		if customResources == nil {
+			customResources = make(map[string]*ObjectData)
+		}
+		customResources[gvr] = data
+	}
+	jsonReport.CustomResources = nil
+	return customResources
+}
+
 func prepareDataToSend(ctx context.Context, wh *WatchHandler) []byte {
+	customResourcesMutex.Lock()
 	jsonReport := wh.jsonReport
+	customResourcesMutex.Unlock()
 	if wh.clusterAPIServerVersion == nil {
 		return nil
 	}
@@ -126,10 +265,12 @@ func prepareDataToSend(ctx context.Context, wh *WatchHandler) []byte {
 		setInstallationData(&jsonReport, *wh.config.ClusterConfig())
 
 		jsonReport.ClusterAPIServerVersion = wh.clusterAPIServerVersion
-		jsonReport.CloudVendor = wh.cloudVendor
+		jsonReport.CloudMetadata = wh.cloudMetadata
+		jsonReport.ClusterIdentity = wh.clusterIdentity
 	} else {
 		jsonReport.ClusterAPIServerVersion = nil
-		jsonReport.CloudVendor = ""
+		jsonReport.CloudMetadata = nil
+		jsonReport.ClusterIdentity = nil
 	}
 	if jsonReport.Nodes.Len() == 0 {
 		jsonReport.Nodes = nil
@@ -149,6 +290,46 @@ func prepareDataToSend(ctx context.Context, wh *WatchHandler) []byte {
 	if jsonReport.Namespace.Len() == 0 {
 		jsonReport.Namespace = nil
 	}
+	if jsonReport.PersistentVolumes.Len() == 0 {
+		jsonReport.PersistentVolumes = nil
+	}
+	if jsonReport.PersistentVolumeClaims.Len() == 0 {
+		jsonReport.PersistentVolumeClaims = nil
+	}
+	if jsonReport.StorageClasses.Len() == 0 {
+		jsonReport.StorageClasses = nil
+	}
+	if jsonReport.Events.Len() == 0 {
+		jsonReport.Events = nil
+	}
+	if jsonReport.ServiceEndpoints.Len() == 0 {
+		jsonReport.ServiceEndpoints = nil
+	}
+	if jsonReport.AdmissionWebhooks.Len() == 0 {
+		jsonReport.AdmissionWebhooks = nil
+	}
+	if jsonReport.CustomResourceDefinitions.Len() == 0 {
+		jsonReport.CustomResourceDefinitions = nil
+	}
+	if jsonReport.HorizontalPodAutoscalers.Len() == 0 {
+		jsonReport.HorizontalPodAutoscalers = nil
+	}
+	if jsonReport.PodDisruptionBudgets.Len() == 0 {
+		jsonReport.PodDisruptionBudgets = nil
+	}
+	if jsonReport.CertificateSigningRequests.Len() == 0 {
+		jsonReport.CertificateSigningRequests = nil
+	}
+	if jsonReport.PriorityClasses.Len() == 0 {
+		jsonReport.PriorityClasses = nil
+	}
+	if jsonReport.RuntimeClasses.Len() == 0 {
+		jsonReport.RuntimeClasses = nil
+	}
+	if jsonReport.Images.Len() == 0 {
+		jsonReport.Images = nil
+	}
+	jsonReport.CustomResources = wh.jsonReport.takeCustomResources()
 	jsonReportToSend, err := json.Marshal(jsonReport)
 	if nil != err {
 		logger.L().Ctx(ctx).Error("In PrepareDataToSend json.Marshal", helpers.Error(err))
@@ -225,6 +406,84 @@ func deleteJsonData(wh *WatchHandler) {
 		deleteObjectData(&jsonReport.Namespace.Deleted)
 		deleteObjectData(&jsonReport.Namespace.Updated)
 	}
+
+	if jsonReport.PersistentVolumes != nil {
+		deleteObjectData(&jsonReport.PersistentVolumes.Created)
+		deleteObjectData(&jsonReport.PersistentVolumes.Deleted)
+		deleteObjectData(&jsonReport.PersistentVolumes.Updated)
+	}
+
+	if jsonReport.PersistentVolumeClaims != nil {
+		deleteObjectData(&jsonReport.PersistentVolumeClaims.Created)
+		deleteObjectData(&jsonReport.PersistentVolumeClaims.Deleted)
+		deleteObjectData(&jsonReport.PersistentVolumeClaims.Updated)
+	}
+
+	if jsonReport.StorageClasses != nil {
+		deleteObjectData(&jsonReport.StorageClasses.Created)
+		deleteObjectData(&jsonReport.StorageClasses.Deleted)
+		deleteObjectData(&jsonReport.StorageClasses.Updated)
+	}
+
+	if jsonReport.Events != nil {
+		deleteObjectData(&jsonReport.Events.Created)
+		deleteObjectData(&jsonReport.Events.Deleted)
+		deleteObjectData(&jsonReport.Events.Updated)
+	}
+
+	if jsonReport.ServiceEndpoints != nil {
+		deleteObjectData(&jsonReport.ServiceEndpoints.Created)
+		deleteObjectData(&jsonReport.ServiceEndpoints.Deleted)
+		deleteObjectData(&jsonReport.ServiceEndpoints.Updated)
+	}
+
+	if jsonReport.AdmissionWebhooks != nil {
+		deleteObjectData(&jsonReport.AdmissionWebhooks.Created)
+		deleteObjectData(&jsonReport.AdmissionWebhooks.Deleted)
+		deleteObjectData(&jsonReport.AdmissionWebhooks.Updated)
+	}
+
+	if jsonReport.CustomResourceDefinitions != nil {
+		deleteObjectData(&jsonReport.CustomResourceDefinitions.Created)
+		deleteObjectData(&jsonReport.CustomResourceDefinitions.Deleted)
+		deleteObjectData(&jsonReport.CustomResourceDefinitions.Updated)
+	}
+
+	if jsonReport.HorizontalPodAutoscalers != nil {
+		deleteObjectData(&jsonReport.HorizontalPodAutoscalers.Created)
+		deleteObjectData(&jsonReport.HorizontalPodAutoscalers.Deleted)
+		deleteObjectData(&jsonReport.HorizontalPodAutoscalers.Updated)
+	}
+
+	if jsonReport.PodDisruptionBudgets != nil {
+		deleteObjectData(&jsonReport.PodDisruptionBudgets.Created)
+		deleteObjectData(&jsonReport.PodDisruptionBudgets.Deleted)
+		deleteObjectData(&jsonReport.PodDisruptionBudgets.Updated)
+	}
+
+	if jsonReport.CertificateSigningRequests != nil {
+		deleteObjectData(&jsonReport.CertificateSigningRequests.Created)
+		deleteObjectData(&jsonReport.CertificateSigningRequests.Deleted)
+		deleteObjectData(&jsonReport.CertificateSigningRequests.Updated)
+	}
+
+	if jsonReport.PriorityClasses != nil {
+		deleteObjectData(&jsonReport.PriorityClasses.Created)
+		deleteObjectData(&jsonReport.PriorityClasses.Deleted)
+		deleteObjectData(&jsonReport.PriorityClasses.Updated)
+	}
+
+	if jsonReport.RuntimeClasses != nil {
+		deleteObjectData(&jsonReport.RuntimeClasses.Created)
+		deleteObjectData(&jsonReport.RuntimeClasses.Deleted)
+		deleteObjectData(&jsonReport.RuntimeClasses.Updated)
+	}
+
+	if jsonReport.Images != nil {
+		deleteObjectData(&jsonReport.Images.Created)
+		deleteObjectData(&jsonReport.Images.Deleted)
+		deleteObjectData(&jsonReport.Images.Updated)
+	}
 }
 
 func setInstallationData(jsonReport *jsonFormat, config armometadata.ClusterConfig) {
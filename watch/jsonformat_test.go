@@ -35,7 +35,7 @@ func TestIsEmptyFirstReport(test *testing.T) {
 	if !isEmptyFirstReport(jsonReportToSend) {
 		test.Errorf("First report is empty")
 	}
-	jsonReport.CloudVendor = "aws"
+	jsonReport.CloudMetadata = &CloudMetadata{Vendor: "AWS"}
 	jsonReportToSend, _ = json.Marshal(jsonReport)
 	if isEmptyFirstReport(jsonReportToSend) {
 		test.Errorf("First report is not empty")
@@ -0,0 +1,148 @@
+package watch
+
+import (
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// MicroServiceRef identifies a microservice reported in the microservice section
+type MicroServiceRef struct {
+	PodSpecId int    `json:"podSpecId"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+}
+
+// microServiceIndex maps the running pods to their microservice. It is updated by the pod watcher and is safe to read from the other watchers
+type microServiceIndex struct {
+	pods      map[string]MicroServiceRef
+	podLabels map[string]labels.Set
+	// podCount the number of pods of each microservice, by podSpecId
+	podCount    map[int]int
+	subscribers map[string]*microServiceSubscriber
+	mutex       sync.RWMutex
+}
+
+// microServiceSubscriber a watcher resolving its objects with the index. It is signaled when the first pod of a microservice is added,
+// the objects it resolved before in those namespaces may miss the microservice
+type microServiceSubscriber struct {
+	changed    chan struct{}
+	namespaces map[string]bool
+}
+
+func newMicroServiceIndex() *microServiceIndex {
+	return &microServiceIndex{
+		pods:        make(map[string]MicroServiceRef),
+		podLabels:   make(map[string]labels.Set),
+		podCount:    make(map[int]int),
+		subscribers: make(map[string]*microServiceSubscriber),
+		mutex:       sync.RWMutex{},
+	}
+}
+
+func podKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func (msi *microServiceIndex) setPod(namespace, podName string, podLabels map[string]string, ref MicroServiceRef) {
+	msi.mutex.Lock()
+	defer msi.mutex.Unlock()
+	key := podKey(namespace, podName)
+	if prev, ok := msi.pods[key]; ok {
+		msi.decreasePodCount(prev.PodSpecId)
+	}
+	msi.pods[key] = ref
+	msi.podLabels[key] = labels.Set(podLabels)
+	msi.podCount[ref.PodSpecId]++
+	if msi.podCount[ref.PodSpecId] == 1 {
+		for _, subscriber := range msi.subscribers {
+			subscriber.namespaces[namespace] = true
+			select {
+			case subscriber.changed <- struct{}{}:
+			default: // a signal is already pending
+			}
+		}
+	}
+}
+
+func (msi *microServiceIndex) removePod(namespace, podName string) {
+	msi.mutex.Lock()
+	defer msi.mutex.Unlock()
+	key := podKey(namespace, podName)
+	if prev, ok := msi.pods[key]; ok {
+		msi.decreasePodCount(prev.PodSpecId)
+	}
+	delete(msi.pods, key)
+	delete(msi.podLabels, key)
+}
+
+func (msi *microServiceIndex) decreasePodCount(podSpecId int) {
+	if msi.podCount[podSpecId]--; msi.podCount[podSpecId] <= 0 {
+		delete(msi.podCount, podSpecId)
+	}
+}
+
+// subscribe returns the channel signaled when the first pod of a microservice is added, the same channel is returned for the same name
+func (msi *microServiceIndex) subscribe(name string) <-chan struct{} {
+	msi.mutex.Lock()
+	defer msi.mutex.Unlock()
+	subscriber, ok := msi.subscribers[name]
+	if !ok {
+		subscriber = &microServiceSubscriber{changed: make(chan struct{}, 1), namespaces: make(map[string]bool)}
+		msi.subscribers[name] = subscriber
+	}
+	return subscriber.changed
+}
+
+// takeNamespaces returns and clears the namespaces where a microservice got its first pod since the last call
+func (msi *microServiceIndex) takeNamespaces(name string) map[string]bool {
+	msi.mutex.Lock()
+	defer msi.mutex.Unlock()
+	subscriber, ok := msi.subscribers[name]
+	if !ok {
+		return nil
+	}
+	namespaces := subscriber.namespaces
+	subscriber.namespaces = make(map[string]bool)
+	return namespaces
+}
+
+// getPod returns the microservice of a pod
+func (msi *microServiceIndex) getPod(namespace, podName string) (MicroServiceRef, bool) {
+	msi.mutex.RLock()
+	defer msi.mutex.RUnlock()
+	ref, ok := msi.pods[podKey(namespace, podName)]
+	return ref, ok
+}
+
+// getByOwner returns the microservice of an uptree owner
+func (msi *microServiceIndex) getByOwner(namespace, kind, name string) (MicroServiceRef, bool) {
+	msi.mutex.RLock()
+	defer msi.mutex.RUnlock()
+	for _, ref := range msi.pods {
+		if ref.Namespace == namespace && ref.Kind == kind && ref.Name == name {
+			return ref, true
+		}
+	}
+	return MicroServiceRef{}, false
+}
+
+// getBySelector returns the microservices of the pods in a namespace which match a label selector, sorted by podSpecId
+func (msi *microServiceIndex) getBySelector(namespace string, selector labels.Selector) []MicroServiceRef {
+	msi.mutex.RLock()
+	defer msi.mutex.RUnlock()
+	found := map[int]MicroServiceRef{}
+	for key, ref := range msi.pods {
+		if ref.Namespace == namespace && selector.Matches(msi.podLabels[key]) {
+			found[ref.PodSpecId] = ref
+		}
+	}
+	refs := make([]MicroServiceRef, 0, len(found))
+	for _, ref := range found {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].PodSpecId < refs[j].PodSpecId })
+	return refs
+}
@@ -71,15 +71,15 @@ func (wh *WatchHandler) NamespaceEventHandler(ctx context.Context, event *watch.
 			wh.namespacedm.init(id)
 			wh.namespacedm.pushBack(id, namespace)
 			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, CREATED)
+			wh.jsonReport.AddToJsonFormat(wh.newNamespaceData(namespace), NAMESPACES, CREATED)
 		case watch.Modified:
 			wh.UpdateNamespace(namespace)
 			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, UPDATED)
+			wh.jsonReport.AddToJsonFormat(wh.newNamespaceData(namespace), NAMESPACES, UPDATED)
 		case watch.Deleted:
 			wh.RemoveNamespace(namespace)
 			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, DELETED)
+			wh.jsonReport.AddToJsonFormat(wh.newNamespaceData(namespace), NAMESPACES, DELETED)
 		case watch.Bookmark: //only the resource version is changed but it's the same object
 			return nil
 		case watch.Error:
@@ -103,11 +103,26 @@ func (wh *WatchHandler) UpdateNamespace(namespace *corev1.Namespace) {
 		if !ok {
 			continue
 		}
-		if strings.Compare(namespaceData.Name, namespaceData.Name) != 0 {
+		if strings.Compare(namespaceData.Name, namespace.Name) != 0 {
 			continue
 		}
+		wh.namespacedm.updateFront(id, namespace)
+		return
+	}
+}
 
+// getNamespace returns the stored namespace by its name
+func (wh *WatchHandler) getNamespace(name string) *corev1.Namespace {
+	for _, id := range wh.namespacedm.getIDs() {
+		front := wh.namespacedm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if namespace, ok := front.Value.(*corev1.Namespace); ok && namespace.Name == name {
+			return namespace
+		}
 	}
+	return nil
 }
 
 // RemoveNamespace update websocket when namespace is removed
@@ -11,19 +11,130 @@ import (
 	"golang.org/x/net/context"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
+const (
+	NodeChangeKubeletVersionUpgraded   = "KubeletVersionUpgraded"
+	NodeChangeKubeletVersionDowngraded = "KubeletVersionDowngraded"
+	NodeChangeOSImageChanged           = "OSImageChanged"
+	NodeChangeKernelVersionChanged     = "KernelVersionChanged"
+	NodeChangeContainerRuntimeChanged  = "ContainerRuntimeChanged"
+	NodeChangeTaintAdded               = "TaintAdded"
+	NodeChangeTaintRemoved             = "TaintRemoved"
+	NodeChangeCordoned                 = "Cordoned"
+	NodeChangeUncordoned               = "Uncordoned"
+)
+
 type NodeData struct {
 	// core.NodeSystemInfo
 	core.NodeStatus `json:",inline"`
-	Name            string `json:"name"`
+	Name            string            `json:"name"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	Taints          []core.Taint      `json:"taints,omitempty"`
+	ProviderID      string            `json:"providerID,omitempty"`
+	PodCIDR         string            `json:"podCIDR,omitempty"`
+	PodCIDRs        []string          `json:"podCIDRs,omitempty"`
+	Unschedulable   bool              `json:"unschedulable"`
+	// Changes the node lifecycle changes since the previous report of the node
+	Changes []NodeChange `json:"changes,omitempty"`
 }
 
-func (updateNode *NodeData) UpdateNodeData(node *core.Node) {
+// NodeChange a classified change of the node spec or node info
+type NodeChange struct {
+	Type  string      `json:"type"`
+	From  string      `json:"from,omitempty"`
+	To    string      `json:"to,omitempty"`
+	Taint *core.Taint `json:"taint,omitempty"`
+}
+
+func newNodeData(node *core.Node) *NodeData {
+	nd := &NodeData{}
+	nd.setNode(node)
+	return nd
+}
+
+func (updateNode *NodeData) setNode(node *core.Node) {
+	removeLastAppliedConfiguration(&node.ObjectMeta)
 	updateNode.Name = node.ObjectMeta.Name
 	updateNode.NodeStatus = node.Status
+	updateNode.Labels = node.Labels
+	updateNode.Annotations = node.Annotations
+	updateNode.Taints = node.Spec.Taints
+	updateNode.ProviderID = node.Spec.ProviderID
+	updateNode.PodCIDR = node.Spec.PodCIDR
+	updateNode.PodCIDRs = node.Spec.PodCIDRs
+	updateNode.Unschedulable = node.Spec.Unschedulable
+}
+
+func (updateNode *NodeData) UpdateNodeData(node *core.Node) {
+	changes := classifyNodeChanges(updateNode, node)
+	updateNode.setNode(node)
+	updateNode.Changes = changes
+}
+
+// classifyNodeChanges returns the lifecycle changes between the reported node and the updated node
+func classifyNodeChanges(previous *NodeData, node *core.Node) []NodeChange {
+	var changes []NodeChange
+	previousInfo, info := &previous.NodeInfo, &node.Status.NodeInfo
+	if previousInfo.KubeletVersion != info.KubeletVersion && previousInfo.KubeletVersion != "" {
+		changeType := NodeChangeKubeletVersionUpgraded
+		if isVersionDowngrade(previousInfo.KubeletVersion, info.KubeletVersion) {
+			changeType = NodeChangeKubeletVersionDowngraded
+		}
+		changes = append(changes, NodeChange{Type: changeType, From: previousInfo.KubeletVersion, To: info.KubeletVersion})
+	}
+	if previousInfo.OSImage != info.OSImage && previousInfo.OSImage != "" {
+		changes = append(changes, NodeChange{Type: NodeChangeOSImageChanged, From: previousInfo.OSImage, To: info.OSImage})
+	}
+	if previousInfo.KernelVersion != info.KernelVersion && previousInfo.KernelVersion != "" {
+		changes = append(changes, NodeChange{Type: NodeChangeKernelVersionChanged, From: previousInfo.KernelVersion, To: info.KernelVersion})
+	}
+	if previousInfo.ContainerRuntimeVersion != info.ContainerRuntimeVersion && previousInfo.ContainerRuntimeVersion != "" {
+		changes = append(changes, NodeChange{Type: NodeChangeContainerRuntimeChanged, From: previousInfo.ContainerRuntimeVersion, To: info.ContainerRuntimeVersion})
+	}
+	for i := range node.Spec.Taints {
+		if !containsTaint(previous.Taints, &node.Spec.Taints[i]) {
+			changes = append(changes, NodeChange{Type: NodeChangeTaintAdded, Taint: &node.Spec.Taints[i]})
+		}
+	}
+	for i := range previous.Taints {
+		if !containsTaint(node.Spec.Taints, &previous.Taints[i]) {
+			changes = append(changes, NodeChange{Type: NodeChangeTaintRemoved, Taint: &previous.Taints[i]})
+		}
+	}
+	if !previous.Unschedulable && node.Spec.Unschedulable {
+		changes = append(changes, NodeChange{Type: NodeChangeCordoned})
+	} else if previous.Unschedulable && !node.Spec.Unschedulable {
+		changes = append(changes, NodeChange{Type: NodeChangeUncordoned})
+	}
+	return changes
+}
+
+// containsTaint returns true if the taints contain a taint with the same key, value and effect
+func containsTaint(taints []core.Taint, taint *core.Taint) bool {
+	for i := range taints {
+		if taints[i].Key == taint.Key && taints[i].Value == taint.Value && taints[i].Effect == taint.Effect {
+			return true
+		}
+	}
+	return false
+}
+
+// isVersionDowngrade returns true if the new version is lower than the previous one. Unparsable versions are not considered a downgrade
+func isVersionDowngrade(previous, current string) bool {
+	previousVersion, err := utilversion.ParseGeneric(previous)
+	if err != nil {
+		return false
+	}
+	currentVersion, err := utilversion.ParseGeneric(current)
+	if err != nil {
+		return false
+	}
+	return currentVersion.LessThan(previousVersion)
 }
 
 func UpdateNode(node *core.Node, ndm map[int]*list.List) *NodeData {
@@ -83,12 +194,12 @@ func (wh *WatchHandler) NodeWatch(ctx context.Context) {
 	newStateChan := make(chan bool)
 	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
 	for {
-		wh.clusterAPIServerVersion = wh.getClusterVersion()
-		wh.cloudVendor = wh.checkInstanceMetadataAPIVendor()
-		if wh.cloudVendor != "" {
-			wh.clusterAPIServerVersion.GitVersion += ";" + wh.cloudVendor
-		}
-		logger.L().Info("K8s Cloud Vendor", helpers.String("cloudVendor", wh.cloudVendor))
+		serverVersion := wh.getClusterVersion()
+		nodes := wh.listNodesSample()
+		wh.clusterIdentity = wh.getClusterIdentity(serverVersion, nodes)
+		wh.cloudMetadata = wh.getCloudMetadata(nodes)
+		wh.clusterAPIServerVersion = serverVersion
+		logger.L().Info("K8s cloud metadata", helpers.Interface("cloudMetadata", wh.cloudMetadata))
 		logger.L().Info("Watching over nodes starting")
 		nodesWatcher, err := wh.RestAPIClient.CoreV1().Nodes().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
 		if err != nil {
@@ -126,16 +237,19 @@ func (wh *WatchHandler) handleNodeWatch(nodesWatcher watch.Interface, newStateCh
 				if wh.ndm[id] == nil {
 					wh.ndm[id] = list.New()
 				}
-				nd := &NodeData{Name: node.ObjectMeta.Name,
-					NodeStatus: node.Status,
-				}
+				nd := newNodeData(node)
 				wh.ndm[id].PushBack(nd)
 				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(nd, NODE, CREATED)
 			case watch.Modified:
 				updateNode := UpdateNode(node, wh.ndm)
+				if updateNode == nil {
+					continue
+				}
+				// the stored node is updated in place, report a copy so the changes are not overridden by the next update
+				reportedNode := *updateNode
 				informNewDataArrive(wh)
-				wh.jsonReport.AddToJsonFormat(updateNode, NODE, UPDATED)
+				wh.jsonReport.AddToJsonFormat(&reportedNode, NODE, UPDATED)
 			case watch.Deleted:
 				name := RemoveNode(node, wh.ndm)
 				informNewDataArrive(wh)
@@ -153,11 +267,6 @@ func (wh *WatchHandler) handleNodeWatch(nodesWatcher watch.Interface, newStateCh
 	}
 }
 
-func (wh *WatchHandler) checkInstanceMetadataAPIVendor() string {
-	res, _ := getInstanceMetadata()
-	return res
-}
-
 func (wh *WatchHandler) getClusterVersion() *version.Info {
 	serverVersion, err := wh.RestAPIClient.Discovery().ServerVersion()
 	if err != nil {
@@ -0,0 +1,69 @@
+package watch
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestNode() *core.Node {
+	return &core.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "node-1",
+			Labels:      map[string]string{"topology.kubernetes.io/zone": "us-east-1a"},
+			Annotations: map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}", "node.alpha.kubernetes.io/ttl": "0"},
+		},
+		Spec: core.NodeSpec{
+			ProviderID: "aws:///us-east-1a/i-0123456789",
+			PodCIDR:    "10.244.1.0/24",
+			PodCIDRs:   []string{"10.244.1.0/24"},
+			Taints:     []core.Taint{{Key: "dedicated", Value: "gpu", Effect: core.TaintEffectNoSchedule}},
+		},
+		Status: core.NodeStatus{NodeInfo: core.NodeSystemInfo{KubeletVersion: "v1.26.5", OSImage: "Ubuntu 22.04", KernelVersion: "5.15.0"}},
+	}
+}
+
+func TestNewNodeData(t *testing.T) {
+	nd := newNodeData(newTestNode())
+	assert.Equal(t, "node-1", nd.Name)
+	assert.Equal(t, "aws:///us-east-1a/i-0123456789", nd.ProviderID)
+	assert.Equal(t, []string{"10.244.1.0/24"}, nd.PodCIDRs)
+	assert.Len(t, nd.Taints, 1)
+	assert.Equal(t, map[string]string{"node.alpha.kubernetes.io/ttl": "0"}, nd.Annotations)
+	assert.Nil(t, nd.Changes)
+}
+
+func TestUpdateNodeChanges(t *testing.T) {
+	ndm := map[int]*list.List{1: list.New()}
+	ndm[1].PushBack(newNodeData(newTestNode()))
+
+	node := newTestNode()
+	node.Status.NodeInfo.KubeletVersion = "v1.27.3"
+	node.Status.NodeInfo.OSImage = "Ubuntu 22.04.3"
+	node.Spec.Unschedulable = true
+	node.Spec.Taints = []core.Taint{{Key: "node.kubernetes.io/unschedulable", Effect: core.TaintEffectNoSchedule}}
+	nd := UpdateNode(node, ndm)
+	changeTypes := []string{}
+	for _, change := range nd.Changes {
+		changeTypes = append(changeTypes, change.Type)
+	}
+	assert.Equal(t, []string{NodeChangeKubeletVersionUpgraded, NodeChangeOSImageChanged, NodeChangeTaintAdded, NodeChangeTaintRemoved, NodeChangeCordoned}, changeTypes)
+	assert.Equal(t, "v1.26.5", nd.Changes[0].From)
+	assert.Equal(t, "v1.27.3", nd.Changes[0].To)
+	assert.Equal(t, "dedicated", nd.Changes[3].Taint.Key)
+
+	// a status only update has no changes
+	nd = UpdateNode(node, ndm)
+	assert.Nil(t, nd.Changes)
+
+	node = newTestNode()
+	node.Status.NodeInfo.KubeletVersion = "v1.25.0"
+	nd = UpdateNode(node, ndm)
+	assert.Equal(t, NodeChangeKubeletVersionDowngraded, nd.Changes[0].Type)
+	assert.Contains(t, nd.Changes, NodeChange{Type: NodeChangeUncordoned})
+
+	assert.Nil(t, UpdateNode(&core.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}, ndm))
+}
@@ -0,0 +1,172 @@
+package watch
+
+import (
+	"expvar"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/kubescape/kollector/consts"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// default owner cache TTL in seconds
+const defaultOwnerCacheTTL = 300
+
+// ownerCacheMetrics the hits, misses and invalidations counters, served by the probes server on /debug/vars
+var ownerCacheMetrics = expvar.NewMap("ownerCache")
+
+type ownerCacheEntry struct {
+	owner OwnerDet
+	// ancestorUID the UID of the resolved owner, used for the invalidation by the workload watch events
+	ancestorUID types.UID
+	expiresAt   time.Time
+}
+
+// ownerCacheStats the owner cache counters
+type ownerCacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+	Size          int
+}
+
+// ownerVersion the fields of an owner used by the ancestor resolution
+type ownerVersion struct {
+	generation      int64
+	labels          map[string]string
+	ownerReferences []metav1.OwnerReference
+}
+
+func newOwnerVersion(owner metav1.Object) ownerVersion {
+	return ownerVersion{generation: owner.GetGeneration(), labels: owner.GetLabels(), ownerReferences: owner.GetOwnerReferences()}
+}
+
+func (version ownerVersion) equal(other ownerVersion) bool {
+	if version.generation != other.generation || !labels.Equals(version.labels, other.labels) {
+		return false
+	}
+	return (len(version.ownerReferences) == 0 && len(other.ownerReferences) == 0) || reflect.DeepEqual(version.ownerReferences, other.ownerReferences)
+}
+
+// ownerCache the resolved ancestors of the pods, keyed by the UID of the pod owner reference
+type ownerCache struct {
+	entries map[types.UID]*ownerCacheEntry
+	// versions the last watched versions of the owners, the status updates do not invalidate the entries
+	versions map[types.UID]ownerVersion
+	ttl      time.Duration
+	stats    ownerCacheStats
+	now      func() time.Time
+	mutex    sync.Mutex
+}
+
+func newOwnerCache() *ownerCache {
+	return &ownerCache{
+		entries:  make(map[types.UID]*ownerCacheEntry),
+		versions: make(map[types.UID]ownerVersion),
+		ttl:      time.Duration(getNumericValueFromEnvVar(consts.OwnerCacheTTLEnvironmentVariable, defaultOwnerCacheTTL)) * time.Second,
+		now:      time.Now,
+	}
+}
+
+// ownerCacheKey returns the UID of the pod owner reference. Pods without a cachable owner are not cached
+func ownerCacheKey(pod *core.Pod) (types.UID, bool) {
+	if len(pod.OwnerReferences) == 0 || pod.OwnerReferences[0].Kind == "Node" || pod.OwnerReferences[0].UID == "" {
+		return "", false
+	}
+	return pod.OwnerReferences[0].UID, true
+}
+
+func (cache *ownerCache) get(uid types.UID) (OwnerDet, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.ttl <= 0 {
+		return OwnerDet{}, false
+	}
+	now := cache.now()
+	entry, ok := cache.entries[uid]
+	if ok && now.After(entry.expiresAt) {
+		delete(cache.entries, uid)
+		ok = false
+	}
+	if !ok {
+		cache.stats.Misses++
+		ownerCacheMetrics.Add("misses", 1)
+		return OwnerDet{}, false
+	}
+	cache.stats.Hits++
+	ownerCacheMetrics.Add("hits", 1)
+	return entry.owner, true
+}
+
+func (cache *ownerCache) set(uid types.UID, owner OwnerDet) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.ttl <= 0 {
+		return
+	}
+	entry := &ownerCacheEntry{owner: owner, expiresAt: cache.now().Add(cache.ttl)}
+	if ownerMeta, ok := owner.OwnerData.(metav1.Object); ok {
+		entry.ancestorUID = ownerMeta.GetUID()
+	}
+	cache.entries[uid] = entry
+}
+
+// invalidate removes the entries of an owner, either the pod owner reference or the resolved ancestor
+func (cache *ownerCache) invalidate(uid types.UID) {
+	if uid == "" {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.invalidateLocked(uid)
+}
+
+func (cache *ownerCache) invalidateLocked(uid types.UID) {
+	for key, entry := range cache.entries {
+		if key == uid || entry.ancestorUID == uid {
+			delete(cache.entries, key)
+			cache.stats.Invalidations++
+			ownerCacheMetrics.Add("invalidations", 1)
+		}
+	}
+}
+
+// update keeps the version of a watched owner. The entries of the owner are invalidated when its generation, labels or owner references
+// are changed since the last watch event, the status updates keep them
+func (cache *ownerCache) update(owner metav1.Object) {
+	uid := owner.GetUID()
+	if uid == "" {
+		return
+	}
+	version := newOwnerVersion(owner)
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	previous, ok := cache.versions[uid]
+	cache.versions[uid] = version
+	if !ok || !previous.equal(version) {
+		cache.invalidateLocked(uid)
+	}
+}
+
+// remove invalidates the entries of a deleted owner
+func (cache *ownerCache) remove(uid types.UID) {
+	if uid == "" {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	delete(cache.versions, uid)
+	cache.invalidateLocked(uid)
+}
+
+func (cache *ownerCache) getStats() ownerCacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	stats := cache.stats
+	stats.Size = len(cache.entries)
+	return stats
+}
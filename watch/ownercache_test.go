@@ -0,0 +1,145 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestOwnerCache(ttl time.Duration, now *time.Time) *ownerCache {
+	return &ownerCache{entries: make(map[types.UID]*ownerCacheEntry), versions: make(map[types.UID]ownerVersion), ttl: ttl, now: func() time.Time { return *now }}
+}
+
+func TestOwnerCache(t *testing.T) {
+	now := time.Now()
+	cache := newTestOwnerCache(time.Minute, &now)
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nginx", UID: "deployment-uid"}}
+	owner := OwnerDet{Name: "nginx", Kind: "Deployment", OwnerData: deployment}
+
+	_, ok := cache.get("replicaset-uid")
+	assert.False(t, ok)
+	cache.set("replicaset-uid", owner)
+	cached, ok := cache.get("replicaset-uid")
+	assert.True(t, ok)
+	assert.Equal(t, owner, cached)
+
+	// expired
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.get("replicaset-uid")
+	assert.False(t, ok)
+
+	// invalidated by the ancestor
+	cache.set("replicaset-uid", owner)
+	cache.set("other-replicaset-uid", OwnerDet{Name: "redis", Kind: "Deployment", OwnerData: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{UID: "other-uid"}}})
+	cache.invalidate("deployment-uid")
+	_, ok = cache.get("replicaset-uid")
+	assert.False(t, ok)
+	_, ok = cache.get("other-replicaset-uid")
+	assert.True(t, ok)
+
+	// invalidated by the key
+	cache.invalidate("other-replicaset-uid")
+	_, ok = cache.get("other-replicaset-uid")
+	assert.False(t, ok)
+
+	stats := cache.getStats()
+	assert.Equal(t, ownerCacheStats{Hits: 2, Misses: 4, Invalidations: 2, Size: 0}, stats)
+}
+
+func TestOwnerCacheUpdate(t *testing.T) {
+	now := time.Now()
+	cache := newTestOwnerCache(time.Minute, &now)
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nginx", UID: "deployment-uid", Generation: 1, Labels: map[string]string{"app": "nginx"}}}
+	cache.update(deployment)
+	cache.set("replicaset-uid", OwnerDet{Name: "nginx", Kind: "Deployment", OwnerData: deployment})
+
+	// a status update keeps the entry
+	status := deployment.DeepCopy()
+	status.Status.ReadyReplicas = 2
+	cache.update(status)
+	_, ok := cache.get("replicaset-uid")
+	assert.True(t, ok)
+
+	// a spec update invalidates it
+	spec := status.DeepCopy()
+	spec.Generation = 2
+	cache.update(spec)
+	_, ok = cache.get("replicaset-uid")
+	assert.False(t, ok)
+
+	cache.set("replicaset-uid", OwnerDet{Name: "nginx", Kind: "Deployment", OwnerData: spec})
+	relabeled := spec.DeepCopy()
+	relabeled.Labels["tier"] = "web"
+	cache.update(relabeled)
+	_, ok = cache.get("replicaset-uid")
+	assert.False(t, ok)
+
+	cache.set("replicaset-uid", OwnerDet{Name: "nginx", Kind: "Deployment", OwnerData: relabeled})
+	cache.remove("deployment-uid")
+	_, ok = cache.get("replicaset-uid")
+	assert.False(t, ok)
+	assert.Empty(t, cache.versions)
+}
+
+func TestOwnerCacheDisabled(t *testing.T) {
+	now := time.Now()
+	cache := newTestOwnerCache(0, &now)
+	cache.set("uid", OwnerDet{Name: "nginx"})
+	_, ok := cache.get("uid")
+	assert.False(t, ok)
+	assert.Equal(t, ownerCacheStats{}, cache.getStats())
+}
+
+func TestGetAncestorOfPodCached(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "nginx-5d8f", Namespace: "default", UID: "replicaset-uid",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "nginx", APIVersion: "apps/v1", UID: "deployment-uid"}}}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "nginx", Namespace: "default", UID: "deployment-uid"}},
+	)
+	now := time.Now()
+	wh := &WatchHandler{RestAPIClient: client, ownerCache: newTestOwnerCache(time.Minute, &now)}
+	newPod := func(name string) *core.Pod {
+		return &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "nginx-5d8f", APIVersion: "apps/v1", UID: "replicaset-uid"}}}}
+	}
+	countGets := func() int {
+		gets := 0
+		for _, action := range client.Actions() {
+			if _, ok := action.(k8stesting.GetAction); ok {
+				gets++
+			}
+		}
+		return gets
+	}
+
+	od, err := GetAncestorOfPod(context.Background(), newPod("nginx-5d8f-a"), wh)
+	assert.NoError(t, err)
+	assert.Equal(t, "nginx", od.Name)
+	assert.Equal(t, "Deployment", od.Kind)
+	gets := countGets()
+	assert.Equal(t, 2, gets)
+
+	chain := od.Chain
+	assert.Equal(t, "nginx-5d8f", chain[0].Name)
+
+	// the second pod of the workload is resolved without calling the API server, with the owner chain
+	od, err = GetAncestorOfPod(context.Background(), newPod("nginx-5d8f-b"), wh)
+	assert.NoError(t, err)
+	assert.Equal(t, "nginx", od.Name)
+	assert.Equal(t, chain, od.Chain)
+	assert.Equal(t, gets, countGets())
+
+	// the deployment is modified
+	wh.ownerCache.invalidate("deployment-uid")
+	_, err = GetAncestorOfPod(context.Background(), newPod("nginx-5d8f-c"), wh)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*gets, countGets())
+}
@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"fmt"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// maximum number of owners followed, protects from owner reference cycles
+const maxOwnerChainDepth = 10
+
+// OwnerChainLink an owner in the owner references chain of a pod
+type OwnerChainLink struct {
+	Kind       string    `json:"kind"`
+	APIVersion string    `json:"apiVersion"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid,omitempty"`
+}
+
+// getOwnerChain follows the controller owner references up to the top-most owner, for any kind. The chain starts with the direct owner.
+// The resolved ancestor of the pod is not fetched again. It is called when the ancestor is resolved, the chain is cached with it
+func (wh *WatchHandler) getOwnerChain(namespace string, ownerReferences []metav1.OwnerReference, ancestor *OwnerDet) []OwnerChainLink {
+	ancestorMeta, _ := ancestor.OwnerData.(metav1.Object)
+	var chain []OwnerChainLink
+	seen := make(map[types.UID]bool)
+	for len(chain) < maxOwnerChainDepth {
+		ref := controllerOwnerReference(ownerReferences)
+		if ref == nil || (ref.UID != "" && seen[ref.UID]) {
+			break
+		}
+		seen[ref.UID] = true
+		chain = append(chain, OwnerChainLink{Kind: ref.Kind, APIVersion: ref.APIVersion, Name: ref.Name, UID: ref.UID})
+		if ancestorMeta != nil && ref.UID != "" && ref.UID == ancestorMeta.GetUID() {
+			ownerReferences = ancestorMeta.GetOwnerReferences()
+			continue
+		}
+		owner, err := wh.getOwnerObject(namespace, ref.APIVersion, ref.Kind, ref.Name)
+		if err != nil {
+			logger.L().Debug("failed to get owner, the owner chain is partial", helpers.String("kind", ref.Kind), helpers.String("name", ref.Name), helpers.String("namespace", namespace), helpers.Error(err))
+			break
+		}
+		ownerReferences = owner.GetOwnerReferences()
+	}
+	return chain
+}
+
+// getOwnerObject gets an owner of any kind using the dynamic client, the resource of the kind is resolved by the discovery
+func (wh *WatchHandler) getOwnerObject(namespace, apiVersion, kind, name string) (*unstructured.Unstructured, error) {
+	if wh.dynamicClient == nil {
+		return nil, fmt.Errorf("dynamic client is not initialized")
+	}
+	resource, ok := wh.apiResources.ResourceForKind(apiVersion, kind)
+	if !ok {
+		return nil, fmt.Errorf("resource of kind %s in %s not found", kind, apiVersion)
+	}
+	var owner *unstructured.Unstructured
+	var err error
+	if resource.Namespaced {
+		owner, err = wh.dynamicClient.Resource(resource.GroupVersionResource).Namespace(namespace).Get(globalHTTPContext, name, metav1.GetOptions{})
+	} else {
+		owner, err = wh.dynamicClient.Resource(resource.GroupVersionResource).Get(globalHTTPContext, name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	owner.SetManagedFields(nil)
+	return owner, nil
+}
+
+// controllerOwnerReference returns the managing controller, or the first owner if none is marked as the controller
+func controllerOwnerReference(ownerReferences []metav1.OwnerReference) *metav1.OwnerReference {
+	if len(ownerReferences) == 0 {
+		return nil
+	}
+	for i := range ownerReferences {
+		if ownerReferences[i].Controller != nil && *ownerReferences[i].Controller {
+			return &ownerReferences[i]
+		}
+	}
+	return &ownerReferences[0]
+}
@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newUnstructuredOwner(apiVersion, kind, namespace, name, uid string, owners ...metav1.OwnerReference) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetUID(types.UID(uid))
+	obj.SetOwnerReferences(owners)
+	return obj
+}
+
+func TestGetOwnerChain(t *testing.T) {
+	isController := true
+	objects := []runtime.Object{
+		newUnstructuredOwner("apps/v1", "ReplicaSet", "default", "web-7d9c", "replicaset-uid",
+			metav1.OwnerReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "web", UID: "rollout-uid", Controller: &isController}),
+		newUnstructuredOwner("argoproj.io/v1alpha1", "Rollout", "default", "web", "rollout-uid"),
+		newUnstructuredOwner("batch/v1", "Job", "default", "build-1", "job-uid",
+			metav1.OwnerReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Workflow", Name: "build", UID: "workflow-uid"}),
+	}
+	gvrs := map[schema.GroupVersionResource]string{
+		{Group: "apps", Version: "v1", Resource: "replicasets"}:            "ReplicaSetList",
+		{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}:  "RolloutList",
+		{Group: "argoproj.io", Version: "v1alpha1", Resource: "workflows"}: "WorkflowList",
+		{Group: "batch", Version: "v1", Resource: "jobs"}:                  "JobList",
+	}
+	wh := &WatchHandler{
+		dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), gvrs, objects...),
+		apiResources: newFakeAPIResourceDiscovery(
+			&metav1.APIResourceList{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{{Name: "replicasets", Kind: "ReplicaSet", Namespaced: true}}},
+			&metav1.APIResourceList{GroupVersion: "batch/v1", APIResources: []metav1.APIResource{{Name: "jobs", Kind: "Job", Namespaced: true}}},
+			&metav1.APIResourceList{GroupVersion: "argoproj.io/v1alpha1", APIResources: []metav1.APIResource{
+				{Name: "rollouts", Kind: "Rollout", Namespaced: true},
+				{Name: "workflows", Kind: "Workflow", Namespaced: true},
+			}},
+		),
+	}
+
+	chain := wh.getOwnerChain("default", []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-7d9c", UID: "replicaset-uid"}}, &OwnerDet{})
+	assert.Equal(t, []OwnerChainLink{
+		{Kind: "ReplicaSet", APIVersion: "apps/v1", Name: "web-7d9c", UID: "replicaset-uid"},
+		{Kind: "Rollout", APIVersion: "argoproj.io/v1alpha1", Name: "web", UID: "rollout-uid"},
+	}, chain)
+
+	// the workflow is not found, the chain is partial
+	chain = wh.getOwnerChain("default", []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "build-1", UID: "job-uid"}}, &OwnerDet{})
+	assert.Equal(t, []OwnerChainLink{
+		{Kind: "Job", APIVersion: "batch/v1", Name: "build-1", UID: "job-uid"},
+		{Kind: "Workflow", APIVersion: "argoproj.io/v1alpha1", Name: "build", UID: "workflow-uid"},
+	}, chain)
+
+	assert.Nil(t, wh.getOwnerChain("default", nil, &OwnerDet{}))
+
+	// the resolved ancestor is not fetched, its owners are followed
+	ancestor := &OwnerDet{OwnerData: newUnstructuredOwner("batch/v1", "Job", "default", "build-2", "job-2-uid",
+		metav1.OwnerReference{APIVersion: "argoproj.io/v1alpha1", Kind: "Workflow", Name: "build", UID: "workflow-uid"})}
+	chain = wh.getOwnerChain("default", []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "build-2", UID: "job-2-uid"}}, ancestor)
+	assert.Equal(t, []OwnerChainLink{
+		{Kind: "Job", APIVersion: "batch/v1", Name: "build-2", UID: "job-2-uid"},
+		{Kind: "Workflow", APIVersion: "argoproj.io/v1alpha1", Name: "build", UID: "workflow-uid"},
+	}, chain)
+
+	owner, ok := GetOwnerData(context.Background(), "web", "Rollout", "argoproj.io/v1alpha1", "default", wh).(*unstructured.Unstructured)
+	assert.True(t, ok, "owners of any kind are reported with their data")
+	assert.Equal(t, "rollout-uid", string(owner.GetUID()))
+}
+
+func TestControllerOwnerReference(t *testing.T) {
+	isController := true
+	refs := []metav1.OwnerReference{{Name: "first"}, {Name: "controller", Controller: &isController}}
+	assert.Equal(t, "controller", controllerOwnerReference(refs).Name)
+	assert.Equal(t, "first", controllerOwnerReference(refs[:1]).Name)
+	assert.Nil(t, controllerOwnerReference(nil))
+}
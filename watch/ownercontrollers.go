@@ -0,0 +1,80 @@
+package watch
+
+import (
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// managingControllers the controllers which manage the built-in workloads, the pods are reported as microservices of the top-most of them:
+// Argo Rollouts (ReplicaSet -> Rollout), OpenShift (ReplicationController -> DeploymentConfig) and Knative (Deployment -> Revision -> Configuration -> Service)
+var managingControllers = map[schema.GroupKind]bool{
+	{Group: "argoproj.io", Kind: "Rollout"}:                true,
+	{Group: "apps.openshift.io", Kind: "DeploymentConfig"}: true,
+	{Group: "serving.knative.dev", Kind: "Revision"}:       true,
+	{Group: "serving.knative.dev", Kind: "Configuration"}:  true,
+	{Group: "serving.knative.dev", Kind: "Service"}:        true,
+}
+
+// resolveManagingController replaces the owner by its managing controllers, up to the top-most one
+func (wh *WatchHandler) resolveManagingController(od OwnerDet, namespace string) OwnerDet {
+	for i := 0; i < maxOwnerChainDepth; i++ {
+		ownerMeta, ok := od.OwnerData.(metav1.Object)
+		if !ok {
+			return od
+		}
+		ref := controllerOwnerReference(ownerMeta.GetOwnerReferences())
+		if ref == nil || !isManagingController(ref) {
+			return od
+		}
+		controller, err := wh.getOwnerObject(namespace, ref.APIVersion, ref.Kind, ref.Name)
+		if err != nil {
+			logger.L().Debug("failed to get the managing controller", helpers.String("kind", ref.Kind), helpers.String("name", ref.Name), helpers.String("namespace", namespace), helpers.Error(err))
+			return od
+		}
+		od = OwnerDet{Name: controller.GetName(), Kind: controller.GetKind(), OwnerData: controller}
+	}
+	return od
+}
+
+func isManagingController(ref *metav1.OwnerReference) bool {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return false
+	}
+	return managingControllers[schema.GroupKind{Group: gv.Group, Kind: ref.Kind}]
+}
+
+// workloadRefTemplate returns the pod template of an Argo Rollout referencing a workload instead of holding its own template,
+// so the pods are grouped by the template. The owner is reported as is
+func (wh *WatchHandler) workloadRefTemplate(namespace string, owner *unstructured.Unstructured) map[string]interface{} {
+	if _, found, _ := unstructured.NestedMap(owner.Object, "spec", "template"); found {
+		return nil
+	}
+	workloadRef, found, _ := unstructured.NestedStringMap(owner.Object, "spec", "workloadRef")
+	if !found || workloadRef["name"] == "" {
+		return nil
+	}
+	workload, err := wh.getOwnerObject(namespace, workloadRef["apiVersion"], workloadRef["kind"], workloadRef["name"])
+	if err != nil {
+		logger.L().Debug("failed to get the referenced workload", helpers.String("kind", workloadRef["kind"]), helpers.String("name", workloadRef["name"]), helpers.String("namespace", namespace), helpers.Error(err))
+		return nil
+	}
+	template, _, _ := unstructured.NestedMap(workload.Object, "spec", "template")
+	return template
+}
+
+// ownerGroupingSpec returns the owner spec which the pods are grouped by, with the template of the referenced workload when the owner has none
+func ownerGroupingSpec(owner *OwnerDet) interface{} {
+	spec := extractPodSpecFromOwner(owner.OwnerData)
+	if owner.Template == nil {
+		return spec
+	}
+	// the spec is decoded from the owner, it is not shared
+	if specMap, ok := spec.(map[string]interface{}); ok {
+		specMap["template"] = owner.Template
+	}
+	return spec
+}
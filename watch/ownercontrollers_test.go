@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newManagingControllersWatchHandler(typed []runtime.Object, dynamic []runtime.Object) *WatchHandler {
+	gvrs := map[schema.GroupVersionResource]string{
+		{Group: "", Version: "v1", Resource: "replicationcontrollers"}:             "ReplicationControllerList",
+		{Group: "apps", Version: "v1", Resource: "deployments"}:                    "DeploymentList",
+		{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}:          "RolloutList",
+		{Group: "apps.openshift.io", Version: "v1", Resource: "deploymentconfigs"}: "DeploymentConfigList",
+		{Group: "serving.knative.dev", Version: "v1", Resource: "revisions"}:       "RevisionList",
+		{Group: "serving.knative.dev", Version: "v1", Resource: "configurations"}:  "ConfigurationList",
+		{Group: "serving.knative.dev", Version: "v1", Resource: "services"}:        "ServiceList",
+	}
+	now := time.Now()
+	return &WatchHandler{
+		RestAPIClient: fake.NewSimpleClientset(typed...),
+		dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), gvrs, dynamic...),
+		apiResources: newFakeAPIResourceDiscovery(
+			&metav1.APIResourceList{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "replicationcontrollers", Kind: "ReplicationController", Namespaced: true}}},
+			&metav1.APIResourceList{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{{Name: "deployments", Kind: "Deployment", Namespaced: true}}},
+			&metav1.APIResourceList{GroupVersion: "argoproj.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "rollouts", Kind: "Rollout", Namespaced: true}}},
+			&metav1.APIResourceList{GroupVersion: "apps.openshift.io/v1", APIResources: []metav1.APIResource{{Name: "deploymentconfigs", Kind: "DeploymentConfig", Namespaced: true}}},
+			&metav1.APIResourceList{GroupVersion: "serving.knative.dev/v1", APIResources: []metav1.APIResource{
+				{Name: "revisions", Kind: "Revision", Namespaced: true},
+				{Name: "configurations", Kind: "Configuration", Namespaced: true},
+				{Name: "services", Kind: "Service", Namespaced: true},
+			}},
+		),
+		ownerCache: newTestOwnerCache(time.Minute, &now),
+	}
+}
+
+func newOwnedPod(name string, owner metav1.OwnerReference) *core.Pod {
+	return &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", OwnerReferences: []metav1.OwnerReference{owner}}}
+}
+
+func TestGetAncestorOfPodKnative(t *testing.T) {
+	isController := true
+	wh := newManagingControllersWatchHandler(
+		[]runtime.Object{
+			&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "hello-00001-deployment-5d8f", Namespace: "default", UID: "replicaset-uid",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "hello-00001-deployment", UID: "deployment-uid"}}}},
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "hello-00001-deployment", Namespace: "default", UID: "deployment-uid",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "serving.knative.dev/v1", Kind: "Revision", Name: "hello-00001", Controller: &isController}}}},
+		},
+		[]runtime.Object{
+			newUnstructuredOwner("serving.knative.dev/v1", "Revision", "default", "hello-00001", "revision-uid",
+				metav1.OwnerReference{APIVersion: "serving.knative.dev/v1", Kind: "Configuration", Name: "hello", Controller: &isController}),
+			newUnstructuredOwner("serving.knative.dev/v1", "Configuration", "default", "hello", "configuration-uid",
+				metav1.OwnerReference{APIVersion: "serving.knative.dev/v1", Kind: "Service", Name: "hello", Controller: &isController}),
+			newUnstructuredOwner("serving.knative.dev/v1", "Service", "default", "hello", "service-uid"),
+		},
+	)
+	od, err := GetAncestorOfPod(context.Background(), newOwnedPod("hello-00001-deployment-5d8f-a", metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "hello-00001-deployment-5d8f", UID: "replicaset-uid"}), wh)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", od.Name)
+	assert.Equal(t, "Service", od.Kind)
+	assert.Equal(t, "serving.knative.dev/v1", od.OwnerData.(*unstructured.Unstructured).GetAPIVersion())
+}
+
+func TestGetAncestorOfPodDeploymentConfig(t *testing.T) {
+	isController := true
+	dc := newUnstructuredOwner("apps.openshift.io/v1", "DeploymentConfig", "default", "frontend", "dc-uid")
+	unstructured.SetNestedField(dc.Object, map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{map[string]interface{}{"name": "frontend", "image": "nginx"}}}}, "spec", "template")
+	wh := newManagingControllersWatchHandler(nil, []runtime.Object{
+		newUnstructuredOwner("v1", "ReplicationController", "default", "frontend-1", "rc-uid",
+			metav1.OwnerReference{APIVersion: "apps.openshift.io/v1", Kind: "DeploymentConfig", Name: "frontend", Controller: &isController}),
+		dc,
+	})
+	od, err := GetAncestorOfPod(context.Background(), newOwnedPod("frontend-1-abcde", metav1.OwnerReference{APIVersion: "v1", Kind: "ReplicationController", Name: "frontend-1", UID: "rc-uid"}), wh)
+	assert.NoError(t, err)
+	assert.Equal(t, "frontend", od.Name)
+	assert.Equal(t, "DeploymentConfig", od.Kind)
+
+	// the pods are grouped by the DeploymentConfig spec
+	spec, ok := extractPodSpecFromOwner(od.OwnerData).(map[string]interface{})
+	assert.True(t, ok)
+	assert.Contains(t, spec, "template")
+
+	assert.False(t, wh.isMicroServiceNeedToBeRemoved(od.OwnerData, od.Kind, "default"))
+	assert.NoError(t, wh.dynamicClient.Resource(schema.GroupVersionResource{Group: "apps.openshift.io", Version: "v1", Resource: "deploymentconfigs"}).Namespace("default").Delete(context.Background(), "frontend", metav1.DeleteOptions{}))
+	assert.True(t, wh.isMicroServiceNeedToBeRemoved(od.OwnerData, od.Kind, "default"))
+}
+
+func TestGetAncestorOfPodRolloutWorkloadRef(t *testing.T) {
+	rollout := newUnstructuredOwner("argoproj.io/v1alpha1", "Rollout", "default", "web", "rollout-uid")
+	unstructured.SetNestedStringMap(rollout.Object, map[string]string{"apiVersion": "apps/v1", "kind": "Deployment", "name": "web-template"}, "spec", "workloadRef")
+	template := newUnstructuredOwner("apps/v1", "Deployment", "default", "web-template", "deployment-uid")
+	unstructured.SetNestedField(template.Object, map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{map[string]interface{}{"name": "web", "image": "nginx:1.25"}}}}, "spec", "template")
+	wh := newManagingControllersWatchHandler(
+		[]runtime.Object{
+			&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web-7d9c", Namespace: "default", UID: "replicaset-uid",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "web", UID: "rollout-uid"}}}},
+		},
+		[]runtime.Object{rollout, template},
+	)
+	od, err := GetAncestorOfPod(context.Background(), newOwnedPod("web-7d9c-a", metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-7d9c", UID: "replicaset-uid"}), wh)
+	assert.NoError(t, err)
+	assert.Equal(t, "web", od.Name)
+	assert.Equal(t, "Rollout", od.Kind)
+	_, found, _ := unstructured.NestedMap(od.OwnerData.(*unstructured.Unstructured).Object, "spec", "template")
+	assert.False(t, found, "the rollout is reported as is")
+	containers, found, _ := unstructured.NestedSlice(od.Template, "spec", "containers")
+	assert.True(t, found, "the template of the referenced workload is resolved")
+	assert.Len(t, containers, 1)
+
+	// the pods are grouped by the template of the referenced workload
+	spec, ok := ownerGroupingSpec(&od).(map[string]interface{})
+	assert.True(t, ok)
+	assert.Contains(t, spec, "template")
+	assert.Contains(t, spec, "workloadRef")
+}
@@ -22,6 +22,7 @@ import (
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/watch"
 )
@@ -30,6 +31,10 @@ type OwnerDet struct {
 	Name      string      `json:"name"`
 	Kind      string      `json:"kind"`
 	OwnerData interface{} `json:"ownerData,omitempty"`
+	// Chain the owner references chain of the pod, resolved with the owner. It is reported by the microservice
+	Chain []OwnerChainLink `json:"-"`
+	// Template the pod template of the workload referenced by the owner, used for grouping the pods only
+	Template map[string]interface{} `json:"-"`
 }
 type CRDOwnerData struct {
 	metav1.TypeMeta
@@ -40,9 +45,15 @@ type OwnerDetNameAndKindOnly struct {
 }
 
 type MicroServiceData struct {
-	*core.Pod `json:",inline"`
-	Owner     OwnerDet `json:"uptreeOwner"`
-	PodSpecId int      `json:"podSpecId"`
+	*core.Pod      `json:",inline"`
+	Owner          OwnerDet             `json:"uptreeOwner"`
+	PodSpecId      int                  `json:"podSpecId"`
+	Storage        []MicroServiceVolume `json:"storage,omitempty"`
+	WorkloadStatus *WorkloadStatus      `json:"workloadStatus,omitempty"`
+	// OwnerChain the owners of the pod up to the top-most controller, starting with the direct owner
+	OwnerChain []OwnerChainLink `json:"ownerChain,omitempty"`
+	// SecuritySummary the security posture of the pod template, set when the microservice is reported
+	SecuritySummary *SecuritySummary `json:"securitySummary,omitempty"`
 }
 
 type PodDataForExistMicroService struct {
@@ -54,12 +65,33 @@ type PodDataForExistMicroService struct {
 	PodStatus         string                  `json:"podStatus"`
 	CreationTimestamp string                  `json:"startedAt"`
 	DeletionTimestamp string                  `json:"terminatedAt,omitempty"`
+	PriorityClassName string                  `json:"priorityClassName,omitempty"`
+	Priority          *int32                  `json:"priority,omitempty"`
+	RuntimeClassName  string                  `json:"runtimeClassName,omitempty"`
+	RuntimeHandler    string                  `json:"runtimeHandler,omitempty"`
 }
 
 type ScanNewImageData struct {
 	Pod        *core.Pod
 	Owner      *OwnerDet
 	PodsNumber int
+	// NotifiedDigests the notified image digests of each container of the workload, by container name.
+	// All of them are kept, the pods of the former template are still running during a rollout
+	NotifiedDigests map[string]map[string]bool
+}
+
+const (
+	ContainerTypeInit      = "initContainer"
+	ContainerTypeContainer = "container"
+	ContainerTypeEphemeral = "ephemeralContainer"
+)
+
+// ChangedContainer a container which its image digest changed since the last scan notification of the workload
+type ChangedContainer struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
 }
 
 var (
@@ -81,6 +113,9 @@ func (wh *WatchHandler) PodWatch(ctx context.Context) {
 	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
 	for {
 		logger.L().Ctx(ctx).Info("Watching over pods starting")
+		if !wh.secretUsage.arePodsSynced() {
+			wh.syncPodSecretReferences(ctx)
+		}
 		podsWatcher, err := wh.RestAPIClient.CoreV1().Pods("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
 		if err != nil {
 			time.Sleep(1 * time.Second)
@@ -123,39 +158,58 @@ func removePodScanNotificationCandidateList(od *OwnerDet, pod *core.Pod) {
 	}
 }
 
-func isContainersIDSChanged(podWithNewState []core.ContainerStatus, oldPod []core.ContainerStatus) bool {
-	if len(podWithNewState) > len(oldPod) {
-		return true
-	}
-
-	length := len(podWithNewState)
-	for i := 0; i < length; i++ {
-		if podWithNewState[i].ImageID != oldPod[i].ImageID {
-			return true
+// changedContainers returns the containers of all the types which their image digest is different from the notified digest. The containers which their image is not resolved yet are ignored
+func changedContainers(pod *core.Pod, notifiedDigests map[string]map[string]bool) []ChangedContainer {
+	var changed []ChangedContainer
+	for _, statuses := range []struct {
+		containerType string
+		statuses      []core.ContainerStatus
+	}{
+		{ContainerTypeInit, pod.Status.InitContainerStatuses},
+		{ContainerTypeContainer, pod.Status.ContainerStatuses},
+		{ContainerTypeEphemeral, pod.Status.EphemeralContainerStatuses},
+	} {
+		for i := range statuses.statuses {
+			status := &statuses.statuses[i]
+			digest := imageDigest(status.ImageID)
+			if digest == "" {
+				digest = status.ImageID
+			}
+			if digest == "" || notifiedDigests[status.Name][digest] {
+				continue
+			}
+			changed = append(changed, ChangedContainer{Name: status.Name, Type: statuses.containerType, Image: status.Image, Digest: digest})
 		}
 	}
-	return false
-}
-
-func isPodIsTheNewOne(pod *core.Pod) bool {
-	return pod.CreationTimestamp.Time.Equal(pod.CreationTimestamp.Time) || pod.CreationTimestamp.After(pod.CreationTimestamp.Time)
+	return changed
 }
 
-func checkNotificationCandidateList(pod *core.Pod, od *OwnerDet, podStatus string) bool {
-	if podStatus != "Running" {
-		return false
+// checkNotificationCandidateList returns the containers of a running pod which their image was not notified yet for the workload.
+// Terminating pods are ignored, they run the former images
+func checkNotificationCandidateList(pod *core.Pod, od *OwnerDet, podStatus string) []ChangedContainer {
+	if podStatus != "Running" || pod.DeletionTimestamp != nil {
+		return nil
 	}
 	for i, data := range scanNotificationCandidateList {
 		if pod.GetNamespace() == data.Pod.GetNamespace() && data.Owner.Name == od.Name && data.Owner.Kind == od.Kind {
-			if isPodIsTheNewOne(data.Pod) && isContainersIDSChanged(pod.Status.ContainerStatuses, data.Pod.Status.ContainerStatuses) {
-				scanNotificationCandidateList[i].Pod = pod
-				return true
-			} else {
-				return false
+			changed := changedContainers(pod, data.NotifiedDigests)
+			if len(changed) == 0 {
+				return nil
 			}
+			if data.NotifiedDigests == nil {
+				scanNotificationCandidateList[i].NotifiedDigests = make(map[string]map[string]bool)
+			}
+			for _, container := range changed {
+				if scanNotificationCandidateList[i].NotifiedDigests[container.Name] == nil {
+					scanNotificationCandidateList[i].NotifiedDigests[container.Name] = make(map[string]bool)
+				}
+				scanNotificationCandidateList[i].NotifiedDigests[container.Name][container.Digest] = true
+			}
+			scanNotificationCandidateList[i].Pod = pod
+			return changed
 		}
 	}
-	return false
+	return nil
 }
 
 func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
@@ -169,6 +223,9 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				*lastWatchEventCreationTime = time.Now()
 				return
 			}
+		case <-wh.claimChanges.changed:
+			wh.refreshMicroServiceStorage(wh.claimChanges.takePending())
+			continue
 		case <-newStateChan:
 			podsWatcher.Stop()
 			*lastWatchEventCreationTime = time.Now()
@@ -202,6 +259,9 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 		}
 		switch event.Type {
 		case watch.Added:
+			// the inventory is updated also for the already reported pods, only the changes are reported
+			wh.reportImageDeltas(wh.images.setPod(pod, newImageWorkload(pod, &od)))
+			wh.secretUsage.notify(wh.secretUsage.setPod(pod, newImageWorkload(pod, &od)))
 			if pod.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
 				continue
 			}
@@ -210,11 +270,22 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 			if runningPodNum <= 1 {
 				// when a new pod microservice (a new pod that is running first in the cluster) is found
 				// we want to scan its vulnerabilities so we will use the trigger mechanism to do it
-				wh.pdm[id] = list.New()
-				nms := MicroServiceData{Pod: pod, Owner: od, PodSpecId: id}
-				wh.pdm[id].PushBack(nms)
+				// the workload watchers may have reported the owner already, its id is kept
+				var reported bool
+				id, reported = wh.workloadIDs.claim(ownerUID(&od), id)
+				nms := MicroServiceData{Pod: pod, Owner: od, PodSpecId: id, Storage: wh.getMicroServiceStorage(pod.Namespace, &pod.Spec), OwnerChain: od.Chain}
+				if wh.pdm[id] == nil || wh.pdm[id].Len() == 0 {
+					wh.pdm[id] = list.New()
+					wh.pdm[id].PushBack(nms)
+				} else { // the pod template of the workload was changed, the pods of the former template are kept
+					wh.pdm[id].Front().Value = nms
+				}
 				if wh.isNamespaceWatched(pod.Namespace) {
-					wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
+					action := CREATED
+					if reported {
+						action = UPDATED
+					}
+					wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, action)
 				}
 
 			} else { // Check if pod is already reported
@@ -246,7 +317,9 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				PodStatus:         podStatus,
 				CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339),
 			}
+			wh.setPodClasses(&newPod, pod)
 			wh.pdm[id].PushBack(newPod)
+			wh.microServices.setPod(pod.Namespace, podName, pod.Labels, MicroServiceRef{PodSpecId: id, Namespace: pod.Namespace, Kind: od.Kind, Name: od.Name})
 			if wh.isNamespaceWatched(pod.Namespace) {
 				wh.jsonReport.AddToJsonFormat(newPod, PODS, CREATED)
 				informNewDataArrive(wh)
@@ -255,14 +328,16 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				addPodScanNotificationCandidateList(ctx, &od, pod)
 			}
 		case watch.Modified:
-			if checkNotificationCandidateList(pod, &od, podStatus) {
-				if err := wh.notifyUpdates.notifyNewMicroServiceCreatedInTheCluster(pod.Namespace, od.Kind, od.Name); err != nil {
+			if changed := checkNotificationCandidateList(pod, &od, podStatus); len(changed) > 0 {
+				if err := wh.notifyUpdates.notifyNewMicroServiceCreatedInTheCluster(pod.Namespace, od.Kind, od.Name, changed); err != nil {
 					logger.L().Ctx(ctx).Error("failed to notify updates", helpers.Error(err))
 				}
 			}
 			if !wh.isNamespaceWatched(pod.Namespace) {
 				continue
 			}
+			wh.reportImageDeltas(wh.images.setPod(pod, newImageWorkload(pod, &od)))
+			wh.secretUsage.notify(wh.secretUsage.setPod(pod, newImageWorkload(pod, &od)))
 			if pod.DeletionTimestamp != nil { // the pod is terminating
 				*lastWatchEventCreationTime = time.Now()
 				break
@@ -287,6 +362,8 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				continue
 			}
 			wh.DeletePod(ctx, pod, podName)
+			wh.reportImageDeltas(wh.images.removePod(pod.Namespace, pod.Name))
+			wh.secretUsage.notify(wh.secretUsage.removePod(pod.Namespace, pod.Name))
 		case watch.Bookmark:
 			logger.L().Ctx(ctx).Debug("Pod Bookmark", helpers.String("name", podName), helpers.String("status", podStatus), helpers.String("namespace", pod.Namespace), helpers.String("node", pod.Spec.NodeName))
 		case watch.Error:
@@ -373,15 +450,20 @@ func (wh *WatchHandler) DeletePod(ctx context.Context, pod *core.Pod, podName st
 	if podSpecID == -1 {
 		return
 	}
+	wh.microServices.removePod(pod.Namespace, pod.ObjectMeta.Name)
 	logger.L().Ctx(ctx).Debug("Pod Deleted", helpers.String("name", podName), helpers.String("status", podStatus), helpers.String("namespace", pod.Namespace), helpers.String("node", pod.Spec.NodeName))
 	np := PodDataForExistMicroService{PodName: pod.ObjectMeta.Name, NodeName: pod.Spec.NodeName, PodIP: pod.Status.PodIP, Namespace: pod.ObjectMeta.Namespace, Owner: OwnerDetNameAndKindOnly{Name: owner.Name, Kind: owner.Kind}, PodStatus: podStatus, CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339)}
+	wh.setPodClasses(&np, pod)
 	if pod.DeletionTimestamp != nil {
 		np.DeletionTimestamp = pod.DeletionTimestamp.Time.UTC().Format(time.RFC3339)
 	}
 	wh.jsonReport.AddToJsonFormat(np, PODS, DELETED)
 	if removeMicroServiceAsWell {
-		nms := MicroServiceData{Pod: pod, Owner: owner, PodSpecId: podSpecID}
-		wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, DELETED)
+		// the workload watchers may have reported the owner as deleted already
+		if _, reported := wh.workloadIDs.release(ownerUID(&owner)); reported {
+			nms := MicroServiceData{Pod: pod, Owner: owner, PodSpecId: podSpecID}
+			wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, DELETED)
+		}
 	}
 	informNewDataArrive(wh)
 }
@@ -426,13 +508,13 @@ func extractPodSpecFromOwner(ownerData interface{}) interface{} {
 }
 
 func isPodSpecAlreadyExist(podOwner *OwnerDet, namespace string, pdm map[int]*list.List) (int, int) {
-	newSpec := extractPodSpecFromOwner(podOwner.OwnerData)
+	newSpec := ownerGroupingSpec(podOwner)
 	for _, v := range pdm {
 		if v == nil || v.Len() <= 1 {
 			continue
 		}
 		p := v.Front().Value.(MicroServiceData)
-		existsSpec := extractPodSpecFromOwner(p.Owner.OwnerData)
+		existsSpec := ownerGroupingSpec(&p.Owner)
 		// In addition, in case we didn't change the podspec of the OwnerReference of the pod, we cant count on the owner labels changes
 		//  but on the labels / volumes of the actual pod we got to identify the changes
 		if p.ObjectMeta.Namespace == namespace && reflect.DeepEqual(newSpec, existsSpec) {
@@ -513,22 +595,14 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return podDet
 
 	default:
-		if wh.extensionsClient == nil {
-			return nil
+		if owner, err := wh.getOwnerObject(namespace, apiVersion, kind, name); err == nil {
+			return owner
 		}
-		options := metav1.ListOptions{}
-		crds, err := wh.extensionsClient.CustomResourceDefinitions().List(context.Background(), options)
-		if err != nil {
-			logger.L().Ctx(ctx).Error("GetOwnerData CustomResourceDefinitions", helpers.Error(err))
-			return nil
-		}
-		for crdIdx := range crds.Items {
-			if crds.Items[crdIdx].Status.AcceptedNames.Kind == kind {
-				return CRDOwnerData{
-					metav1.TypeMeta{Kind: crds.Items[crdIdx].Kind,
-						APIVersion: apiVersion,
-					}}
-			}
+		if _, ok := wh.apiResources.ResourceForKind(apiVersion, kind); ok {
+			return CRDOwnerData{
+				metav1.TypeMeta{Kind: kind,
+					APIVersion: apiVersion,
+				}}
 		}
 	}
 
@@ -552,7 +626,23 @@ func GetAncestorFromLocalPodsList(pod *core.Pod, wh *WatchHandler) (*OwnerDet, e
 	return nil, fmt.Errorf("error getting owner reference")
 }
 
+// GetAncestorOfPod returns the top level owner of the pod. The owners are cached by the pod owner reference, so the pods of the same workload are resolved once
 func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (OwnerDet, error) {
+	key, cachable := ownerCacheKey(pod)
+	if cachable {
+		if od, ok := wh.ownerCache.get(key); ok {
+			return od, nil
+		}
+	}
+	od, err := resolveAncestorOfPod(ctx, pod, wh)
+	// a failed owner lookup is not cached
+	if err == nil && cachable && od.OwnerData != nil {
+		wh.ownerCache.set(key, od)
+	}
+	return od, err
+}
+
+func resolveAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (OwnerDet, error) {
 	od := OwnerDet{}
 
 	if pod.OwnerReferences != nil {
@@ -648,6 +738,11 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 			od.Kind = crd.Kind
 		}
 	}
+	od = wh.resolveManagingController(od, pod.ObjectMeta.Namespace)
+	if owner, ok := od.OwnerData.(*unstructured.Unstructured); ok {
+		od.Template = wh.workloadRefTemplate(pod.ObjectMeta.Namespace, owner)
+	}
+	od.Chain = wh.getOwnerChain(pod.ObjectMeta.Namespace, pod.OwnerReferences, &od)
 	return od, nil
 }
 
@@ -673,6 +768,7 @@ func (wh *WatchHandler) updatePod(pod *core.Pod, pdm map[int]*list.List, podStat
 					id = -1
 				}
 				podDataForExistMicroService = PodDataForExistMicroService{PodName: pod.ObjectMeta.Name, NodeName: pod.Spec.NodeName, PodIP: pod.Status.PodIP, Namespace: pod.ObjectMeta.Namespace, PodStatus: podStatus, CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339)}
+				wh.setPodClasses(&podDataForExistMicroService, pod)
 
 				DeepCopy(element.Value.(PodDataForExistMicroService).Owner, &podDataForExistMicroService.Owner)
 				DeepCopyObj(podDataForExistMicroService, element.Value.(PodDataForExistMicroService))
@@ -733,6 +829,14 @@ func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kin
 		if errors.IsNotFound(err) {
 			return true
 		}
+	default:
+		// owners of any other kind, e.g. Argo Rollouts, OpenShift DeploymentConfigs and Knative Services
+		if owner, ok := ownerData.(*unstructured.Unstructured); ok {
+			_, err := wh.getOwnerObject(namespace, owner.GetAPIVersion(), owner.GetKind(), owner.GetName())
+			if errors.IsNotFound(err) {
+				return true
+			}
+		}
 	}
 
 	return false
@@ -6,9 +6,11 @@ import (
 
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 //go:embed testdata/pod.json
@@ -87,7 +89,7 @@ func TestCheckNotificationCandidateList(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 }
 
 /*
@@ -122,7 +124,7 @@ func TestNewMicroserviceCreated(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 }
 
 /*
@@ -157,7 +159,7 @@ func TestNewMicroserviceCreatedWithBadConfiguration(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.False(t, checkNotificationCandidateList(&runningPod, &runningOd, "Failed"), "pod should not be reported")
+	assert.Empty(t, checkNotificationCandidateList(&runningPod, &runningOd, "Failed"), "pod should not be reported")
 
 	removePodScanNotificationCandidateList(&runningOd, &runningPod)
 	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
@@ -197,7 +199,7 @@ func TestMicroserviceChangedItsImage(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 
 	addPodScanNotificationCandidateList(ctx, &od, &pod)
 	exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
@@ -214,7 +216,7 @@ func TestMicroserviceChangedItsImage(t *testing.T) {
 
 	runningNewPod.Status.ContainerStatuses[0].Image = "nginx:perl"
 	runningNewPod.Status.ContainerStatuses[0].ImageID = "nginx:perlImageID"
-	assert.True(t, checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Running"), "pod should be reported")
 
 	removePodScanNotificationCandidateList(&od, &pod)
 	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
@@ -253,7 +255,7 @@ func TestMicroserviceChangedItsImageWithBadConfig(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 
 	addPodScanNotificationCandidateList(ctx, &od, &pod)
 	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
@@ -270,7 +272,7 @@ func TestMicroserviceChangedItsImageWithBadConfig(t *testing.T) {
 
 	runningNewPod.Status.ContainerStatuses[0].Image = "nginx:perl"
 	runningNewPod.Status.ContainerStatuses[0].ImageID = "nginx:perlImageID"
-	assert.False(t, checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Failed"), "pod should not be reported")
+	assert.Empty(t, checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Failed"), "pod should not be reported")
 
 	removePodScanNotificationCandidateList(&od, &pod)
 	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
@@ -309,7 +311,7 @@ func TestMicroserviceChangedSomethingButItsImage(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 
 	addPodScanNotificationCandidateList(ctx, &od, &pod)
 	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
@@ -325,9 +327,95 @@ func TestMicroserviceChangedSomethingButItsImage(t *testing.T) {
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
 	runningNewPod.Spec.Containers[0].ImagePullPolicy = "IfNotPresent"
-	assert.False(t, checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Running"), "pod should not be reported")
+	assert.Empty(t, checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Running"), "pod should not be reported")
 
 	removePodScanNotificationCandidateList(&od, &pod)
 	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 }
+
+func newScanCandidatePod(statuses ...core.ContainerStatus) *core.Pod {
+	pod := &core.Pod{}
+	pod.Namespace = "default"
+	for _, status := range statuses {
+		switch status.Name {
+		case "init":
+			pod.Status.InitContainerStatuses = append(pod.Status.InitContainerStatuses, status)
+		case "debugger":
+			pod.Status.EphemeralContainerStatuses = append(pod.Status.EphemeralContainerStatuses, status)
+		default:
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, status)
+		}
+	}
+	return pod
+}
+
+func TestCheckNotificationCandidateListPerContainer(t *testing.T) {
+	scanNotificationCandidateList = []*ScanNewImageData{}
+	od := OwnerDet{Name: "web", Kind: "Deployment"}
+	ctx := context.Background()
+
+	initStatus := core.ContainerStatus{Name: "init", Image: "busybox", ImageID: "docker-pullable://busybox@sha256:b1"}
+	appStatus := core.ContainerStatus{Name: "app", Image: "nginx", ImageID: "docker-pullable://nginx@sha256:n1"}
+	sidecarStatus := core.ContainerStatus{Name: "istio-proxy", Image: "istio/proxyv2", ImageID: "docker-pullable://istio/proxyv2@sha256:p1"}
+
+	pod := newScanCandidatePod(initStatus, appStatus, sidecarStatus)
+	addPodScanNotificationCandidateList(ctx, &od, pod)
+	assert.Equal(t, []ChangedContainer{
+		{Name: "init", Type: ContainerTypeInit, Image: "busybox", Digest: "sha256:b1"},
+		{Name: "app", Type: ContainerTypeContainer, Image: "nginx", Digest: "sha256:n1"},
+		{Name: "istio-proxy", Type: ContainerTypeContainer, Image: "istio/proxyv2", Digest: "sha256:p1"},
+	}, checkNotificationCandidateList(pod, &od, "Running"))
+
+	// the sidecar is injected first, the containers are compared by name
+	assert.Empty(t, checkNotificationCandidateList(newScanCandidatePod(initStatus, sidecarStatus, appStatus), &od, "Running"))
+
+	// only the init container image changed
+	initStatus.ImageID = "docker-pullable://busybox@sha256:b2"
+	assert.Equal(t, []ChangedContainer{{Name: "init", Type: ContainerTypeInit, Image: "busybox", Digest: "sha256:b2"}},
+		checkNotificationCandidateList(newScanCandidatePod(initStatus, appStatus, sidecarStatus), &od, "Running"))
+
+	// an ephemeral container is attached
+	debugger := core.ContainerStatus{Name: "debugger", Image: "busybox", ImageID: "docker-pullable://busybox@sha256:b2"}
+	assert.Equal(t, []ChangedContainer{{Name: "debugger", Type: ContainerTypeEphemeral, Image: "busybox", Digest: "sha256:b2"}},
+		checkNotificationCandidateList(newScanCandidatePod(initStatus, appStatus, sidecarStatus, debugger), &od, "Running"))
+
+	// the image of the other workload is not notified yet
+	otherOd := OwnerDet{Name: "api", Kind: "Deployment"}
+	addPodScanNotificationCandidateList(ctx, &otherOd, pod)
+	assert.Len(t, checkNotificationCandidateList(newScanCandidatePod(appStatus), &otherOd, "Running"), 1)
+}
+
+func TestCheckNotificationCandidateListRollout(t *testing.T) {
+	scanNotificationCandidateList = []*ScanNewImageData{}
+	od := OwnerDet{Name: "web", Kind: "Deployment"}
+	ctx := context.Background()
+
+	oldStatus := core.ContainerStatus{Name: "app", Image: "nginx:1.24", ImageID: "docker-pullable://nginx@sha256:n1"}
+	newStatus := core.ContainerStatus{Name: "app", Image: "nginx:1.25", ImageID: "docker-pullable://nginx@sha256:n2"}
+	oldPod := newScanCandidatePod(oldStatus)
+	addPodScanNotificationCandidateList(ctx, &od, oldPod)
+	assert.Len(t, checkNotificationCandidateList(oldPod, &od, "Running"), 1)
+
+	// the pods of both templates are modified alternately during the rollout
+	newPod := newScanCandidatePod(newStatus)
+	addPodScanNotificationCandidateList(ctx, &od, newPod)
+	assert.Equal(t, []ChangedContainer{{Name: "app", Type: ContainerTypeContainer, Image: "nginx:1.25", Digest: "sha256:n2"}},
+		checkNotificationCandidateList(newPod, &od, "Running"))
+	assert.Empty(t, checkNotificationCandidateList(oldPod, &od, "Running"))
+	assert.Empty(t, checkNotificationCandidateList(newPod, &od, "Running"))
+
+	// a terminating pod is ignored
+	terminating := newScanCandidatePod(core.ContainerStatus{Name: "app", Image: "nginx:1.23", ImageID: "docker-pullable://nginx@sha256:n0"})
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	assert.Empty(t, checkNotificationCandidateList(terminating, &od, "Running"))
+	assert.Empty(t, checkNotificationCandidateList(oldPod, &od, "Running"))
+}
+
+func TestCreateNotificationPostJson(t *testing.T) {
+	notifier := newClusterNotifierImpl("customer", "cluster", "gateway")
+	body, err := notifier.createNotificationPostJson("default", "Deployment", "web", []ChangedContainer{{Name: "app", Type: ContainerTypeContainer, Image: "nginx", Digest: "sha256:n1"}})
+	assert.NoError(t, err)
+	assert.Contains(t, body.String(), `"wlid":"wlid://cluster-cluster/namespace-default/Deployment-web"`)
+	assert.Contains(t, body.String(), `"args":{"containers":[{"name":"app","type":"container","image":"nginx","digest":"sha256:n1"}]}`)
+}
@@ -0,0 +1,222 @@
+package watch
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/consts"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// defaultRedactedArgumentsPatterns matches the flags which their value is a credential, e.g. --password, --db-token or --api-key
+var defaultRedactedArgumentsPatterns = []string{`(?i)^(.*[-_.])?(password|passwd|pwd|secret|token|api-?key|access-?key|credentials?)$`}
+
+// unstructuredPodSpecPaths the paths of the pod specs in the owners fetched by the dynamic client
+var unstructuredPodSpecPaths = [][]string{
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// redactor replaces the literal environment variable values and the credential arguments of the reported containers with their keyed hash.
+// The names of the variables and the valueFrom references are kept
+type redactor struct {
+	argumentsPatterns  []*regexp.Regexp
+	excludedNamespaces map[string]bool
+}
+
+var (
+	envRedactor     *redactor
+	envRedactorOnce sync.Once
+)
+
+// getRedactor returns the redactor configured by the environment variables
+func getRedactor() *redactor {
+	envRedactorOnce.Do(func() {
+		envRedactor = newRedactor(
+			getStringSliceFromEnvVar(consts.RedactArgumentsPatternsEnvironmentVariable, defaultRedactedArgumentsPatterns),
+			getStringSliceFromEnvVar(consts.RedactExcludedNamespacesEnvironmentVariable, nil))
+	})
+	return envRedactor
+}
+
+func newRedactor(argumentsPatterns, excludedNamespaces []string) *redactor {
+	r := &redactor{excludedNamespaces: make(map[string]bool, len(excludedNamespaces))}
+	for _, pattern := range argumentsPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.L().Error("invalid arguments redaction pattern", helpers.String("pattern", pattern), helpers.Error(err))
+			continue
+		}
+		r.argumentsPatterns = append(r.argumentsPatterns, re)
+	}
+	for _, namespace := range excludedNamespaces {
+		r.excludedNamespaces[namespace] = true
+	}
+	return r
+}
+
+// redactedValue returns the keyed hash of the value, changes of the value are still detected but short values cannot be guessed by hashing candidates
+func redactedValue(value string) string {
+	return keyedHash([]byte(value))
+}
+
+// redactMicroService returns a copy of a reported microservice with the pod and the owner redacted, the stored microservice is not changed
+func (r *redactor) redactMicroService(data interface{}) interface{} {
+	msd, ok := data.(MicroServiceData)
+	if !ok || msd.Pod == nil || r.excludedNamespaces[msd.Pod.Namespace] {
+		return data
+	}
+	msd.Pod = msd.Pod.DeepCopy()
+	delete(msd.Pod.Annotations, lastAppliedConfigAnnotation)
+	r.redactPodSpec(&msd.Pod.Spec)
+	msd.Owner.OwnerData = r.redactOwner(msd.Owner.OwnerData)
+	return msd
+}
+
+// redactOwner returns a redacted copy of an owner returned by GetOwnerData
+func (r *redactor) redactOwner(owner interface{}) interface{} {
+	switch o := owner.(type) {
+	case *appsv1.Deployment:
+		o = o.DeepCopy()
+		r.redactPodTemplate(o.Annotations, &o.Spec.Template)
+		return o
+	case *appsv1.StatefulSet:
+		o = o.DeepCopy()
+		r.redactPodTemplate(o.Annotations, &o.Spec.Template)
+		return o
+	case *appsv1.DaemonSet:
+		o = o.DeepCopy()
+		r.redactPodTemplate(o.Annotations, &o.Spec.Template)
+		return o
+	case *appsv1.ReplicaSet:
+		o = o.DeepCopy()
+		r.redactPodTemplate(o.Annotations, &o.Spec.Template)
+		return o
+	case *batchv1.Job:
+		o = o.DeepCopy()
+		r.redactPodTemplate(o.Annotations, &o.Spec.Template)
+		return o
+	case *batchv1.CronJob:
+		o = o.DeepCopy()
+		r.redactPodTemplate(o.Annotations, &o.Spec.JobTemplate.Spec.Template)
+		return o
+	case *core.Pod:
+		o = o.DeepCopy()
+		delete(o.Annotations, lastAppliedConfigAnnotation)
+		r.redactPodSpec(&o.Spec)
+		return o
+	case *unstructured.Unstructured:
+		o = o.DeepCopy()
+		unstructured.RemoveNestedField(o.Object, "metadata", "annotations", lastAppliedConfigAnnotation)
+		for _, path := range unstructuredPodSpecPaths {
+			r.redactUnstructuredPodSpec(o.Object, path)
+		}
+		return o
+	}
+	return owner
+}
+
+func (r *redactor) redactPodTemplate(annotations map[string]string, template *core.PodTemplateSpec) {
+	delete(annotations, lastAppliedConfigAnnotation)
+	r.redactPodSpec(&template.Spec)
+}
+
+func (r *redactor) redactPodSpec(spec *core.PodSpec) {
+	for i := range spec.InitContainers {
+		r.redactContainer(spec.InitContainers[i].Env, spec.InitContainers[i].Command, spec.InitContainers[i].Args)
+	}
+	for i := range spec.Containers {
+		r.redactContainer(spec.Containers[i].Env, spec.Containers[i].Command, spec.Containers[i].Args)
+	}
+	for i := range spec.EphemeralContainers {
+		r.redactContainer(spec.EphemeralContainers[i].Env, spec.EphemeralContainers[i].Command, spec.EphemeralContainers[i].Args)
+	}
+}
+
+func (r *redactor) redactContainer(env []core.EnvVar, command, args []string) {
+	for i := range env {
+		if env[i].Value != "" {
+			env[i].Value = redactedValue(env[i].Value)
+		}
+	}
+	// the value of a flag at the end of the command can be the first argument
+	r.redactArguments(args, r.redactArguments(command, false))
+}
+
+// redactArguments redacts the values of the flags matching the patterns, both --flag=value and --flag value.
+// It returns true when the last argument is a matching flag which its value is the next argument
+func (r *redactor) redactArguments(args []string, redactFirst bool) bool {
+	redactNext := redactFirst
+	for i, arg := range args {
+		if redactNext && !strings.HasPrefix(arg, "-") {
+			args[i] = redactedValue(arg)
+			redactNext = false
+			continue
+		}
+		redactNext = false
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !r.isRedactedArgument(strings.TrimLeft(name, "-")) {
+			continue
+		}
+		if hasValue {
+			args[i] = name + "=" + redactedValue(value)
+		} else {
+			redactNext = true
+		}
+	}
+	return redactNext
+}
+
+func (r *redactor) isRedactedArgument(name string) bool {
+	for _, re := range r.argumentsPatterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) redactUnstructuredPodSpec(obj map[string]interface{}, path []string) {
+	for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		containers, found, err := unstructured.NestedSlice(obj, append(path, field)...)
+		if !found || err != nil {
+			continue
+		}
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if env, ok := container["env"].([]interface{}); ok {
+				for _, e := range env {
+					if envVar, ok := e.(map[string]interface{}); ok {
+						if value, ok := envVar["value"].(string); ok && value != "" {
+							envVar["value"] = redactedValue(value)
+						}
+					}
+				}
+			}
+			command, _, _ := unstructured.NestedStringSlice(container, "command")
+			args, _, _ := unstructured.NestedStringSlice(container, "args")
+			r.redactArguments(args, r.redactArguments(command, false))
+			if command != nil {
+				unstructured.SetNestedStringSlice(container, command, "command")
+			}
+			if args != nil {
+				unstructured.SetNestedStringSlice(container, args, "args")
+			}
+		}
+		unstructured.SetNestedSlice(obj, containers, append(path, field)...)
+	}
+}
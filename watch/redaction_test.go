@@ -0,0 +1,78 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newRedactionPodSpec() core.PodSpec {
+	return core.PodSpec{Containers: []core.Container{{
+		Name:    "db",
+		Command: []string{"postgres", "--password"},
+		Args:    []string{"s3cret", "--port=5432", "--api-key=abc", "--token-file", "/var/run/token"},
+		Env: []core.EnvVar{
+			{Name: "DB_PASSWORD", Value: "s3cret"},
+			{Name: "DB_USER", ValueFrom: &core.EnvVarSource{SecretKeyRef: &core.SecretKeySelector{Key: "user", LocalObjectReference: core.LocalObjectReference{Name: "db"}}}},
+			{Name: "EMPTY"},
+		},
+	}}}
+}
+
+func TestRedactMicroService(t *testing.T) {
+	r := newRedactor(defaultRedactedArgumentsPatterns, []string{"kube-system"})
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Annotations: map[string]string{lastAppliedConfigAnnotation: "{}", "team": "data"}},
+		Spec:       appsv1.DeploymentSpec{Template: core.PodTemplateSpec{Spec: newRedactionPodSpec()}},
+	}
+	msd := MicroServiceData{
+		Pod:   &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}, Spec: newRedactionPodSpec()},
+		Owner: OwnerDet{Name: "db", Kind: "Deployment", OwnerData: deployment},
+	}
+
+	redacted := r.redactMicroService(msd).(MicroServiceData)
+	container := redacted.Pod.Spec.Containers[0]
+	assert.Equal(t, []string{"postgres", "--password"}, container.Command)
+	assert.Equal(t, []string{redactedValue("s3cret"), "--port=5432", "--api-key=" + redactedValue("abc"), "--token-file", "/var/run/token"}, container.Args)
+	assert.Equal(t, redactedValue("s3cret"), container.Env[0].Value)
+	assert.Equal(t, "DB_PASSWORD", container.Env[0].Name)
+	assert.Equal(t, "db", container.Env[1].ValueFrom.SecretKeyRef.Name)
+	assert.Equal(t, "", container.Env[2].Value)
+
+	redactedDeployment := redacted.Owner.OwnerData.(*appsv1.Deployment)
+	assert.Equal(t, redactedValue("s3cret"), redactedDeployment.Spec.Template.Spec.Containers[0].Env[0].Value)
+	assert.Equal(t, map[string]string{"team": "data"}, redactedDeployment.Annotations)
+
+	// the stored microservice is not changed
+	assert.Equal(t, "s3cret", msd.Pod.Spec.Containers[0].Env[0].Value)
+	assert.Equal(t, "s3cret", msd.Pod.Spec.Containers[0].Args[0])
+	assert.Equal(t, "s3cret", deployment.Spec.Template.Spec.Containers[0].Env[0].Value)
+	assert.Contains(t, deployment.Annotations, lastAppliedConfigAnnotation)
+
+	// opted out namespace
+	msd.Pod.Namespace = "kube-system"
+	assert.Equal(t, "s3cret", r.redactMicroService(msd).(MicroServiceData).Pod.Spec.Containers[0].Env[0].Value)
+}
+
+func TestRedactUnstructuredOwner(t *testing.T) {
+	r := newRedactor([]string{"(?i)^secret$"}, nil)
+	owner := newUnstructuredOwner("argoproj.io/v1alpha1", "Rollout", "default", "web", "rollout-uid")
+	unstructured.SetNestedField(owner.Object, map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{map[string]interface{}{
+		"name": "web",
+		"args": []interface{}{"--secret", "value", "--password=kept"},
+		"env":  []interface{}{map[string]interface{}{"name": "TOKEN", "value": "abc"}},
+	}}}}, "spec", "template")
+
+	redacted := r.redactOwner(owner).(*unstructured.Unstructured)
+	containers, _, _ := unstructured.NestedSlice(redacted.Object, "spec", "template", "spec", "containers")
+	container := containers[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{"--secret", redactedValue("value"), "--password=kept"}, container["args"])
+	assert.Equal(t, redactedValue("abc"), container["env"].([]interface{})[0].(map[string]interface{})["value"])
+
+	containers, _, _ = unstructured.NestedSlice(owner.Object, "spec", "template", "spec", "containers")
+	assert.Equal(t, "abc", containers[0].(map[string]interface{})["env"].([]interface{})[0].(map[string]interface{})["value"])
+}
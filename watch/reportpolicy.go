@@ -0,0 +1,386 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/consts"
+	"sigs.k8s.io/yaml"
+)
+
+// allSectionsPolicyKey the section key of the rules applied to all the sections
+const allSectionsPolicyKey = "*"
+
+// jsonTypeSections the report sections of the json types, as named in the report
+var jsonTypeSections = map[JsonType]string{
+	NODE:                       "node",
+	SERVICES:                   "service",
+	MICROSERVICES:              "microservice",
+	PODS:                       "pod",
+	SECRETS:                    "secret",
+	NAMESPACES:                 "namespace",
+	PERSISTENTVOLUMES:          "persistentVolume",
+	PERSISTENTVOLUMECLAIMS:     "persistentVolumeClaim",
+	STORAGECLASSES:             "storageClass",
+	EVENTS:                     "events",
+	SERVICEENDPOINTS:           "serviceEndpoints",
+	ADMISSIONWEBHOOKS:          "admissionWebhookConfiguration",
+	CUSTOMRESOURCEDEFINITIONS:  "customResourceDefinition",
+	HORIZONTALPODAUTOSCALERS:   "horizontalPodAutoscaler",
+	PODDISRUPTIONBUDGETS:       "podDisruptionBudget",
+	CERTIFICATESIGNINGREQUESTS: "certificateSigningRequest",
+	PRIORITYCLASSES:            "priorityClass",
+	RUNTIMECLASSES:             "runtimeClass",
+	IMAGES:                     "images",
+}
+
+// customResourcesSection the section key of the rules applied to all the custom resources, the rules of a single resource are keyed by its group/version/resource
+const customResourcesSection = "customResources"
+
+// ReportPolicyFile the policy file format, e.g.
+//
+//	sections:
+//	  "*":
+//	    drop: ["$.metadata.annotations"]
+//	  microservice:
+//	    drop: ["$.metadata.labels['example.com/*']"]
+//	    redact: ["$.spec.containers[*].image"]
+type ReportPolicyFile struct {
+	Sections map[string]SectionPolicy `json:"sections"`
+}
+
+// SectionPolicy the JSONPath expressions of the fields to keep exclusively, to drop and to redact, applied in this order
+type SectionPolicy struct {
+	Keep   []string `json:"keep,omitempty"`
+	Drop   []string `json:"drop,omitempty"`
+	Redact []string `json:"redact,omitempty"`
+}
+
+type sectionRules struct {
+	keep   []jsonPath
+	drop   []jsonPath
+	redact []jsonPath
+}
+
+// reportPolicy projects and redacts the reported objects by the rules of their section
+type reportPolicy struct {
+	sections map[string]*sectionRules
+}
+
+// envReportPolicy the policy of the file set by the environment variable, an empty policy when it is not set
+var envReportPolicy = &reportPolicy{}
+
+func getReportPolicy() *reportPolicy {
+	return envReportPolicy
+}
+
+// loadEnvReportPolicy loads the policy of the file set by the environment variable. It fails when the file cannot be loaded,
+// the collector does not start rather than reporting the objects without the policy
+func loadEnvReportPolicy() error {
+	path := os.Getenv(consts.ReportPolicyFileEnvironmentVariable)
+	if path == "" {
+		return nil
+	}
+	policy, err := loadReportPolicy(path)
+	if err != nil {
+		return fmt.Errorf("failed to load the report policy %s: %w", path, err)
+	}
+	envReportPolicy = policy
+	logger.L().Info("report policy loaded", helpers.String("path", path), helpers.Int("sections", len(policy.sections)))
+	return nil
+}
+
+func loadReportPolicy(path string) (*reportPolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := ReportPolicyFile{}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+	return newReportPolicy(&file)
+}
+
+func newReportPolicy(file *ReportPolicyFile) (*reportPolicy, error) {
+	policy := &reportPolicy{sections: make(map[string]*sectionRules, len(file.Sections))}
+	for section, sectionPolicy := range file.Sections {
+		rules := &sectionRules{}
+		var err error
+		if rules.keep, err = parseJSONPaths(sectionPolicy.Keep); err != nil {
+			return nil, fmt.Errorf("section %s: %w", section, err)
+		}
+		for i, path := range rules.keep {
+			// the kept items of an array would not keep their indexes, the other items would be reported as nulls
+			if path.hasIndex() {
+				return nil, fmt.Errorf("section %s: keep JSONPath %q: array indexes are not supported, use [*]", section, sectionPolicy.Keep[i])
+			}
+		}
+		if rules.drop, err = parseJSONPaths(sectionPolicy.Drop); err != nil {
+			return nil, fmt.Errorf("section %s: %w", section, err)
+		}
+		if rules.redact, err = parseJSONPaths(sectionPolicy.Redact); err != nil {
+			return nil, fmt.Errorf("section %s: %w", section, err)
+		}
+		policy.sections[section] = rules
+	}
+	return policy, nil
+}
+
+// rules returns the rules of the sections, the keep rules of the most specific section take precedence
+func (policy *reportPolicy) rules(sections ...string) *sectionRules {
+	var rules *sectionRules
+	for _, section := range append([]string{allSectionsPolicyKey}, sections...) {
+		sectionPolicy, ok := policy.sections[section]
+		if !ok {
+			continue
+		}
+		if rules == nil {
+			rules = &sectionRules{}
+		}
+		if len(sectionPolicy.keep) > 0 {
+			rules.keep = sectionPolicy.keep
+		}
+		rules.drop = append(rules.drop, sectionPolicy.drop...)
+		rules.redact = append(rules.redact, sectionPolicy.redact...)
+	}
+	return rules
+}
+
+// apply returns the object as a generic JSON object with the rules of the sections applied.
+// The object itself is returned when there are no rules or when it is not encoded as a JSON object
+func (policy *reportPolicy) apply(data interface{}, sections ...string) interface{} {
+	rules := policy.rules(sections...)
+	if rules == nil {
+		return data
+	}
+	content, err := json.Marshal(data)
+	if err != nil {
+		logger.L().Error("failed to apply the report policy", helpers.String("section", sections[len(sections)-1]), helpers.Error(err))
+		return data
+	}
+	var obj interface{}
+	if err := json.Unmarshal(content, &obj); err != nil {
+		logger.L().Error("failed to apply the report policy", helpers.String("section", sections[len(sections)-1]), helpers.Error(err))
+		return data
+	}
+	if _, ok := obj.(map[string]interface{}); !ok {
+		// not an object, e.g. the name of a deleted node
+		return data
+	}
+	if len(rules.keep) > 0 {
+		var kept interface{}
+		for _, path := range rules.keep {
+			kept = keepPath(kept, obj, path)
+		}
+		if kept == nil {
+			kept = map[string]interface{}{}
+		}
+		obj = kept
+	}
+	for _, path := range rules.drop {
+		obj = dropPath(obj, path)
+	}
+	for _, path := range rules.redact {
+		obj = redactPath(obj, path)
+	}
+	return obj
+}
+
+// jsonPath a JSONPath expression subset: $.field, ['field'], [*], [index] and * in the field names, e.g. $.metadata.labels['example.com/*']
+type jsonPath []jsonPathSegment
+
+type jsonPathSegment struct {
+	field *regexp.Regexp
+	index int
+	any   bool
+}
+
+// hasIndex returns true if the path selects an array item by its index
+func (path jsonPath) hasIndex() bool {
+	for _, segment := range path {
+		if !segment.any && segment.field == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (segment *jsonPathSegment) matchField(field string) bool {
+	return segment.any || (segment.field != nil && segment.field.MatchString(field))
+}
+
+func (segment *jsonPathSegment) matchIndex(index int) bool {
+	return segment.any || (segment.field == nil && segment.index == index)
+}
+
+func parseJSONPaths(expressions []string) ([]jsonPath, error) {
+	paths := make([]jsonPath, 0, len(expressions))
+	for _, expression := range expressions {
+		path, err := parseJSONPath(expression)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func parseJSONPath(expression string) (jsonPath, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(expression), "$")
+	path := jsonPath{}
+	for rest != "" {
+		var name string
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name, rest = rest[:end], rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q: missing ]", expression)
+			}
+			name, rest = rest[1:end], rest[end+1:]
+			if name != "*" && !isQuoted(name) {
+				index, err := strconv.Atoi(name)
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSONPath %q: invalid index %s", expression, name)
+				}
+				path = append(path, jsonPathSegment{index: index})
+				continue
+			}
+			name = strings.Trim(name, `'"`)
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q", expression)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid JSONPath %q: empty field", expression)
+		}
+		if name == "*" {
+			path = append(path, jsonPathSegment{any: true})
+			continue
+		}
+		path = append(path, jsonPathSegment{field: globToRegexp(name)})
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("invalid JSONPath %q: empty path", expression)
+	}
+	return path, nil
+}
+
+func isQuoted(name string) bool {
+	return len(name) >= 2 && (name[0] == '\'' || name[0] == '"') && name[len(name)-1] == name[0]
+}
+
+// globToRegexp converts a field name where * matches any characters to a regular expression
+func globToRegexp(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// keepPath copies the fields of src matching the path to dst, with their parents
+func keepPath(dst, src interface{}, path jsonPath) interface{} {
+	if len(path) == 0 {
+		return src
+	}
+	segment := path[0]
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			d = make(map[string]interface{})
+		}
+		for field, value := range s {
+			if segment.matchField(field) {
+				d[field] = keepPath(d[field], value, path[1:])
+			}
+		}
+		return d
+	case []interface{}:
+		d, ok := dst.([]interface{})
+		if !ok {
+			d = make([]interface{}, len(s))
+		}
+		for i, value := range s {
+			if segment.matchIndex(i) {
+				d[i] = keepPath(d[i], value, path[1:])
+			}
+		}
+		return d
+	}
+	return dst
+}
+
+// dropPath removes the fields matching the path
+func dropPath(obj interface{}, path jsonPath) interface{} {
+	segment := path[0]
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for field, value := range o {
+			if !segment.matchField(field) {
+				continue
+			}
+			if len(path) == 1 {
+				delete(o, field)
+			} else {
+				o[field] = dropPath(value, path[1:])
+			}
+		}
+	case []interface{}:
+		if len(path) == 1 {
+			kept := make([]interface{}, 0, len(o))
+			for i, value := range o {
+				if !segment.matchIndex(i) {
+					kept = append(kept, value)
+				}
+			}
+			return kept
+		}
+		for i, value := range o {
+			if segment.matchIndex(i) {
+				o[i] = dropPath(value, path[1:])
+			}
+		}
+	}
+	return obj
+}
+
+// redactPath replaces the values matching the path with their hash, a string value is hashed as is and any other value by its JSON encoding
+func redactPath(obj interface{}, path jsonPath) interface{} {
+	if len(path) == 0 {
+		if value, ok := obj.(string); ok {
+			return redactedValue(value)
+		}
+		content, _ := json.Marshal(obj)
+		return redactedValue(string(content))
+	}
+	segment := path[0]
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for field, value := range o {
+			if segment.matchField(field) {
+				o[field] = redactPath(value, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, value := range o {
+			if segment.matchIndex(i) {
+				o[i] = redactPath(value, path[1:])
+			}
+		}
+	}
+	return obj
+}
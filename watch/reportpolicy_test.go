@@ -0,0 +1,122 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kubescape/kollector/consts"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	path, err := parseJSONPath("$.metadata.labels['example.com/*']")
+	assert.NoError(t, err)
+	assert.Len(t, path, 3)
+	assert.True(t, path[2].matchField("example.com/team"))
+	assert.False(t, path[2].matchField("app"))
+
+	path, err = parseJSONPath(".spec.containers[0].env[*]")
+	assert.NoError(t, err)
+	assert.Len(t, path, 5)
+	assert.True(t, path[2].matchIndex(0))
+	assert.False(t, path[2].matchIndex(1))
+	assert.True(t, path[4].matchIndex(3))
+
+	for _, invalid := range []string{"", "$", "$.spec[", "$.spec[x]", "$..spec", "spec"} {
+		_, err = parseJSONPath(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func newPolicyTestService() *core.Service {
+	return &core.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Labels:      map[string]string{"app": "web", "example.com/team": "payments", "example.com/owner": "jane"},
+			Annotations: map[string]string{"description": "internal"},
+		},
+		Spec: core.ServiceSpec{ClusterIP: "10.0.0.1", Ports: []core.ServicePort{{Name: "http", Port: 80}, {Name: "https", Port: 443}}},
+	}
+}
+
+func TestReportPolicyApply(t *testing.T) {
+	policy, err := newReportPolicy(&ReportPolicyFile{Sections: map[string]SectionPolicy{
+		"*":       {Drop: []string{"$.metadata.annotations"}},
+		"service": {Drop: []string{"$.metadata.labels['example.com/*']"}, Redact: []string{"$.spec.clusterIP", "$.spec.ports[1]"}},
+	}})
+	assert.NoError(t, err)
+
+	obj := policy.apply(newPolicyTestService(), "service").(map[string]interface{})
+	metadata := obj["metadata"].(map[string]interface{})
+	assert.NotContains(t, metadata, "annotations")
+	assert.Equal(t, map[string]interface{}{"app": "web"}, metadata["labels"])
+	spec := obj["spec"].(map[string]interface{})
+	assert.Equal(t, redactedValue("10.0.0.1"), spec["clusterIP"])
+	ports := spec["ports"].([]interface{})
+	assert.Equal(t, "http", ports[0].(map[string]interface{})["name"])
+	assert.Equal(t, redactedValue(`{"name":"https","port":443,"targetPort":0}`), ports[1])
+
+	// the sections without rules of their own get the rules of all the sections
+	obj = policy.apply(newPolicyTestService(), "node").(map[string]interface{})
+	assert.NotContains(t, obj["metadata"], "annotations")
+	assert.Contains(t, obj["metadata"].(map[string]interface{})["labels"], "example.com/team")
+
+	// no rules, the object is reported as is
+	empty, _ := newReportPolicy(&ReportPolicyFile{})
+	service := newPolicyTestService()
+	assert.Equal(t, service, empty.apply(service, "service"))
+}
+
+func TestReportPolicyKeep(t *testing.T) {
+	policy, err := newReportPolicy(&ReportPolicyFile{Sections: map[string]SectionPolicy{
+		"service": {Keep: []string{"$.metadata.name", "$.metadata.namespace", "$.spec.ports[*].port"}, Redact: []string{"$.metadata.name"}},
+	}})
+	assert.NoError(t, err)
+	obj := policy.apply(newPolicyTestService(), "service")
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{"name": redactedValue("web"), "namespace": "default"},
+		"spec": map[string]interface{}{"ports": []interface{}{
+			map[string]interface{}{"port": float64(80)},
+			map[string]interface{}{"port": float64(443)},
+		}},
+	}, obj)
+
+	// the array items are not kept by their index
+	_, err = newReportPolicy(&ReportPolicyFile{Sections: map[string]SectionPolicy{"service": {Keep: []string{"$.spec.ports[1].port"}}}})
+	assert.Error(t, err)
+
+	// the identifiers of the deleted objects are not objects
+	assert.Equal(t, "node-1", policy.apply("node-1", "service"))
+	assert.Equal(t, []string{"a"}, policy.apply([]string{"a"}, "service"))
+}
+
+func TestLoadReportPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+sections:
+  customResources:
+    drop: ["$.status"]
+  networking.istio.io/v1beta1/virtualservices:
+    keep: ["$.metadata", "$.status"]
+`), 0600))
+	policy, err := loadReportPolicy(path)
+	assert.NoError(t, err)
+	obj := policy.apply(map[string]interface{}{"metadata": map[string]interface{}{"name": "vs"}, "spec": "x", "status": "ok"},
+		customResourcesSection, "networking.istio.io/v1beta1/virtualservices")
+	assert.Equal(t, map[string]interface{}{"metadata": map[string]interface{}{"name": "vs"}}, obj)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`sections: {pod: {drop: ["$.spec["]}}`), 0600))
+	_, err = loadReportPolicy(path)
+	assert.Error(t, err)
+
+	// the collector does not start with an invalid or a missing policy
+	t.Setenv(consts.ReportPolicyFileEnvironmentVariable, path)
+	assert.Error(t, loadEnvReportPolicy())
+	t.Setenv(consts.ReportPolicyFileEnvironmentVariable, filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, loadEnvReportPolicy())
+	assert.Empty(t, getReportPolicy().sections)
+}
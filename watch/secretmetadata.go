@@ -0,0 +1,152 @@
+package watch
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SecretMetadata the metadata derived from the secret data before it is removed, the values are never reported
+type SecretMetadata struct {
+	Keys []SecretKey `json:"keys,omitempty"`
+	// ContentHash the keyed hash of the keys and the values, changed when any of them is changed
+	ContentHash   string            `json:"contentHash,omitempty"`
+	Certificates  []CertificateInfo `json:"certificates,omitempty"`
+	RegistryHosts []string          `json:"registryHosts,omitempty"`
+}
+
+// SecretKey a key of the secret data and the size of its value in bytes
+type SecretKey struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// CertificateInfo a certificate of a TLS secret
+type CertificateInfo struct {
+	Key          string   `json:"key"`
+	Subject      string   `json:"subject"`
+	Issuer       string   `json:"issuer"`
+	SerialNumber string   `json:"serialNumber"`
+	DNSNames     []string `json:"dnsNames,omitempty"`
+	IPAddresses  []string `json:"ipAddresses,omitempty"`
+	IsCA         bool     `json:"isCA"`
+	NotBefore    string   `json:"notBefore"`
+	NotAfter     string   `json:"notAfter"`
+}
+
+// tlsCertificateKeys the keys of the certificates in a TLS secret, the private key is not parsed
+var tlsCertificateKeys = []string{corev1.TLSCertKey, corev1.ServiceAccountRootCAKey}
+
+// newSecretMetadata returns the metadata of the secret data, nil when the secret has no data
+func newSecretMetadata(secret *corev1.Secret) *SecretMetadata {
+	if len(secret.Data) == 0 {
+		return nil
+	}
+	metadata := &SecretMetadata{Keys: make([]SecretKey, 0, len(secret.Data))}
+	for key, value := range secret.Data {
+		metadata.Keys = append(metadata.Keys, SecretKey{Name: key, Size: len(value)})
+	}
+	sort.Slice(metadata.Keys, func(i, j int) bool { return metadata.Keys[i].Name < metadata.Keys[j].Name })
+	metadata.ContentHash = secretContentHash(secret.Data, metadata.Keys)
+
+	switch secret.Type {
+	case corev1.SecretTypeTLS:
+		for _, key := range tlsCertificateKeys {
+			metadata.Certificates = append(metadata.Certificates, parseCertificates(key, secret.Data[key])...)
+		}
+	case corev1.SecretTypeDockerConfigJson:
+		metadata.RegistryHosts = dockerConfigRegistryHosts(secret.Data[corev1.DockerConfigJsonKey], true)
+	case corev1.SecretTypeDockercfg:
+		metadata.RegistryHosts = dockerConfigRegistryHosts(secret.Data[corev1.DockerConfigKey], false)
+	}
+	return metadata
+}
+
+// secretContentHash hashes the sorted keys with the length prefixed values by the installation key, so low entropy values cannot be guessed from the hash
+func secretContentHash(data map[string][]byte, keys []SecretKey) string {
+	content := []byte{}
+	for _, key := range keys {
+		content = append(content, key.Name...)
+		content = append(content, 0)
+		content = append(content, strconv.Itoa(key.Size)...)
+		content = append(content, 0)
+		content = append(content, data[key.Name]...)
+	}
+	return keyedHash(content)
+}
+
+// parseCertificates returns the certificates of the PEM blocks of a value, the value is ignored when it is not PEM encoded
+func parseCertificates(key string, value []byte) []CertificateInfo {
+	var certificates []CertificateInfo
+	for {
+		var block *pem.Block
+		block, value = pem.Decode(value)
+		if block == nil {
+			return certificates
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		info := CertificateInfo{
+			Key:          key,
+			Subject:      certificate.Subject.String(),
+			Issuer:       certificate.Issuer.String(),
+			SerialNumber: certificate.SerialNumber.String(),
+			DNSNames:     certificate.DNSNames,
+			IsCA:         certificate.IsCA,
+			NotBefore:    certificate.NotBefore.UTC().Format(time.RFC3339),
+			NotAfter:     certificate.NotAfter.UTC().Format(time.RFC3339),
+		}
+		for _, ip := range certificate.IPAddresses {
+			info.IPAddresses = append(info.IPAddresses, ip.String())
+		}
+		certificates = append(certificates, info)
+	}
+}
+
+// dockerConfigRegistryHosts returns the sorted registry hosts of a .dockerconfigjson ({"auths": {...}}) or a legacy .dockercfg value
+func dockerConfigRegistryHosts(value []byte, auths bool) []string {
+	config := map[string]json.RawMessage{}
+	if auths {
+		dockerConfig := struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}{}
+		if err := json.Unmarshal(value, &dockerConfig); err != nil {
+			return nil
+		}
+		config = dockerConfig.Auths
+	} else if err := json.Unmarshal(value, &config); err != nil {
+		return nil
+	}
+	unique := make(map[string]bool, len(config))
+	hosts := make([]string, 0, len(config))
+	for registry := range config {
+		if host := registryHost(registry); !unique[host] {
+			unique[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// registryHost returns the host of a registry key, which can be a URL, e.g. https://index.docker.io/v1/
+func registryHost(registry string) string {
+	if i := strings.Index(registry, "://"); i >= 0 {
+		registry = registry[i+3:]
+	}
+	if i := strings.Index(registry, "/"); i >= 0 {
+		registry = registry[:i]
+	}
+	return registry
+}
@@ -0,0 +1,575 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	SecretReferenceVolume          = "volume"
+	SecretReferenceProjectedVolume = "projectedVolume"
+	SecretReferenceEnvFrom         = "envFrom"
+	SecretReferenceSecretKeyRef    = "secretKeyRef"
+	SecretReferenceImagePull       = "imagePullSecret"
+)
+
+// SecretUsage the microservices and the service accounts referencing a secret
+type SecretUsage struct {
+	Workloads       []SecretConsumer `json:"workloads,omitempty"`
+	ServiceAccounts []string         `json:"serviceAccounts,omitempty"`
+	// Missing the secret is referenced but does not exist
+	Missing bool `json:"missing"`
+	// Unused the secret exists but is not referenced
+	Unused bool `json:"unused"`
+}
+
+// SecretConsumer a microservice referencing a secret, with its pods and the ways they reference the secret
+type SecretConsumer struct {
+	Kind       string   `json:"kind"`
+	Name       string   `json:"name"`
+	Pods       []string `json:"pods"`
+	References []string `json:"references"`
+}
+
+type podSecretReferences struct {
+	workload ImageWorkload
+	pod      string
+	// secrets the names of the referenced secrets and the ways they are referenced
+	secrets map[string][]string
+}
+
+// secretUsageIndex the secrets referenced by the pods and the service accounts, updated by their watchers
+type secretUsageIndex struct {
+	pods            map[string]*podSecretReferences
+	serviceAccounts map[string]map[string]bool
+	secrets         map[string]bool
+	// missing the last reported usage of the referenced secrets which do not exist
+	missing map[string]SecretUsage
+	// synced the existing secrets are listed, the missing secrets are not reported before
+	synced bool
+	// podsSynced and serviceAccountsSynced the references of the existing pods and service accounts are known, the unused secrets are not reported before
+	podsSynced            bool
+	serviceAccountsSynced bool
+	// pending the keys of the secrets which their usage is changed, reported by the secret watcher when changed is signaled
+	pending map[string]bool
+	changed chan struct{}
+	mutex   sync.Mutex
+}
+
+func newSecretUsageIndex() *secretUsageIndex {
+	return &secretUsageIndex{
+		pods:            make(map[string]*podSecretReferences),
+		serviceAccounts: make(map[string]map[string]bool),
+		secrets:         make(map[string]bool),
+		missing:         make(map[string]SecretUsage),
+		pending:         make(map[string]bool),
+		changed:         make(chan struct{}, 1),
+	}
+}
+
+// notify queues the keys of the secrets which their usage is changed. The usage is reported by the secret watcher,
+// so the stored secrets are updated by a single goroutine
+func (index *secretUsageIndex) notify(keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	index.mutex.Lock()
+	for _, key := range keys {
+		index.pending[key] = true
+	}
+	index.mutex.Unlock()
+	select {
+	case index.changed <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// takePending returns the queued keys, sorted
+func (index *secretUsageIndex) takePending() []string {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	keys := make([]string, 0, len(index.pending))
+	for key := range index.pending {
+		keys = append(keys, key)
+	}
+	index.pending = make(map[string]bool)
+	sort.Strings(keys)
+	return keys
+}
+
+func secretKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// setPod sets the secrets referenced by a pod, returns the keys of the secrets which their usage is changed
+func (index *secretUsageIndex) setPod(pod *corev1.Pod, workload ImageWorkload) []string {
+	refs := &podSecretReferences{workload: workload, pod: pod.Name, secrets: podSecretReferenceTypes(pod)}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	key := podKey(pod.Namespace, pod.Name)
+	previous := index.pods[key]
+	if len(refs.secrets) == 0 {
+		delete(index.pods, key)
+	} else {
+		index.pods[key] = refs
+	}
+	if previous != nil && reflect.DeepEqual(previous, refs) {
+		return nil
+	}
+	return changedSecretKeys(pod.Namespace, previous, refs)
+}
+
+// removePod removes the references of a deleted pod
+func (index *secretUsageIndex) removePod(namespace, name string) []string {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	key := podKey(namespace, name)
+	previous := index.pods[key]
+	delete(index.pods, key)
+	return changedSecretKeys(namespace, previous, nil)
+}
+
+func changedSecretKeys(namespace string, refs ...*podSecretReferences) []string {
+	keys := []string{}
+	unique := make(map[string]bool)
+	for _, r := range refs {
+		if r == nil {
+			continue
+		}
+		for name := range r.secrets {
+			if key := secretKey(namespace, name); !unique[key] {
+				unique[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setServiceAccount sets the secrets listed by a service account, returns the keys of the secrets which their usage is changed
+func (index *secretUsageIndex) setServiceAccount(serviceAccount *corev1.ServiceAccount) []string {
+	secrets := make(map[string]bool)
+	for i := range serviceAccount.Secrets {
+		if serviceAccount.Secrets[i].Name != "" {
+			secrets[serviceAccount.Secrets[i].Name] = true
+		}
+	}
+	for i := range serviceAccount.ImagePullSecrets {
+		if serviceAccount.ImagePullSecrets[i].Name != "" {
+			secrets[serviceAccount.ImagePullSecrets[i].Name] = true
+		}
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	return index.updateServiceAccount(serviceAccount.Namespace, serviceAccount.Name, secrets)
+}
+
+// removeServiceAccount removes the secrets listed by a deleted service account
+func (index *secretUsageIndex) removeServiceAccount(namespace, name string) []string {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	return index.updateServiceAccount(namespace, name, nil)
+}
+
+func (index *secretUsageIndex) updateServiceAccount(namespace, name string, secrets map[string]bool) []string {
+	key := secretKey(namespace, name)
+	previous := index.serviceAccounts[key]
+	if len(secrets) == 0 {
+		delete(index.serviceAccounts, key)
+	} else {
+		index.serviceAccounts[key] = secrets
+	}
+	if reflect.DeepEqual(previous, secrets) || (len(previous) == 0 && len(secrets) == 0) {
+		return nil
+	}
+	keys := []string{}
+	for _, listed := range []map[string]bool{previous, secrets} {
+		for secret := range listed {
+			if previous[secret] != secrets[secret] {
+				keys = append(keys, secretKey(namespace, secret))
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setSecret marks a secret as existing or deleted. It returns the usage of the missing secret which was reported for an existing secret
+func (index *secretUsageIndex) setSecret(namespace, name string, exists bool) (SecretUsage, bool) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	key := secretKey(namespace, name)
+	if !exists {
+		delete(index.secrets, key)
+		return SecretUsage{}, false
+	}
+	index.secrets[key] = true
+	// the existing secret is reported instead of the missing one
+	missing, reported := index.missing[key]
+	delete(index.missing, key)
+	return missing, reported
+}
+
+// setSynced marks the existing secrets as listed, returns the keys of the referenced secrets so the missing ones are reported
+func (index *secretUsageIndex) setSynced() []string {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	index.synced = true
+	keys := []string{}
+	unique := make(map[string]bool)
+	add := func(key string) {
+		if !unique[key] {
+			unique[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, refs := range index.pods {
+		for name := range refs.secrets {
+			add(secretKey(refs.workload.Namespace, name))
+		}
+	}
+	for key, secrets := range index.serviceAccounts {
+		namespace, _, _ := strings.Cut(key, "/")
+		for name := range secrets {
+			add(secretKey(namespace, name))
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setPodsSynced marks the references of the existing pods as known, returns the keys of the existing secrets once all the references are known
+func (index *secretUsageIndex) setPodsSynced() []string {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	index.podsSynced = true
+	return index.referencesSyncedKeys()
+}
+
+// setServiceAccountsSynced marks the references of the existing service accounts as known, returns the keys of the existing secrets once all the references are known
+func (index *secretUsageIndex) setServiceAccountsSynced() []string {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	index.serviceAccountsSynced = true
+	return index.referencesSyncedKeys()
+}
+
+func (index *secretUsageIndex) arePodsSynced() bool {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	return index.podsSynced
+}
+
+// referencesSyncedKeys returns the keys of the existing secrets when all the references are known, so the unused ones are reported
+func (index *secretUsageIndex) referencesSyncedKeys() []string {
+	if !index.podsSynced || !index.serviceAccountsSynced {
+		return nil
+	}
+	keys := make([]string, 0, len(index.secrets))
+	for key := range index.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// usage returns the usage of a secret, the consumers are sorted by kind and name
+func (index *secretUsageIndex) usage(namespace, name string) SecretUsage {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	return index.secretUsage(namespace, name)
+}
+
+func (index *secretUsageIndex) secretUsage(namespace, name string) SecretUsage {
+	usage := SecretUsage{}
+	consumers := make(map[ImageWorkload]*SecretConsumer)
+	references := make(map[ImageWorkload]map[string]bool)
+	for _, refs := range index.pods {
+		types, ok := refs.secrets[name]
+		if !ok || refs.workload.Namespace != namespace {
+			continue
+		}
+		consumer, ok := consumers[refs.workload]
+		if !ok {
+			consumer = &SecretConsumer{Kind: refs.workload.Kind, Name: refs.workload.Name}
+			consumers[refs.workload] = consumer
+			references[refs.workload] = make(map[string]bool)
+		}
+		consumer.Pods = append(consumer.Pods, refs.pod)
+		for _, t := range types {
+			if !references[refs.workload][t] {
+				references[refs.workload][t] = true
+				consumer.References = append(consumer.References, t)
+			}
+		}
+	}
+	for _, consumer := range consumers {
+		sort.Strings(consumer.Pods)
+		sort.Strings(consumer.References)
+		usage.Workloads = append(usage.Workloads, *consumer)
+	}
+	sort.Slice(usage.Workloads, func(i, j int) bool {
+		if usage.Workloads[i].Kind != usage.Workloads[j].Kind {
+			return usage.Workloads[i].Kind < usage.Workloads[j].Kind
+		}
+		return usage.Workloads[i].Name < usage.Workloads[j].Name
+	})
+	prefix := namespace + "/"
+	for key, secrets := range index.serviceAccounts {
+		if strings.HasPrefix(key, prefix) && secrets[name] {
+			usage.ServiceAccounts = append(usage.ServiceAccounts, strings.TrimPrefix(key, prefix))
+		}
+	}
+	sort.Strings(usage.ServiceAccounts)
+	referenced := len(usage.Workloads) > 0 || len(usage.ServiceAccounts) > 0
+	exists := index.secrets[secretKey(namespace, name)]
+	usage.Missing = referenced && !exists
+	// a secret is not known as unused before the references of all the pods and service accounts are known
+	usage.Unused = !referenced && exists && index.podsSynced && index.serviceAccountsSynced
+	return usage
+}
+
+// missingSecretDelta returns the state to report of a secret which does not exist, false when there is nothing to report
+func (index *secretUsageIndex) missingSecretDelta(namespace, name string) (SecretUsage, StateType, bool) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	key := secretKey(namespace, name)
+	if !index.synced || index.secrets[key] {
+		return SecretUsage{}, 0, false
+	}
+	usage := index.secretUsage(namespace, name)
+	previous, reported := index.missing[key]
+	switch {
+	case usage.Missing && !reported:
+		index.missing[key] = usage
+		return usage, CREATED, true
+	case usage.Missing && !reflect.DeepEqual(previous, usage):
+		index.missing[key] = usage
+		return usage, UPDATED, true
+	case !usage.Missing && reported:
+		delete(index.missing, key)
+		return previous, DELETED, true
+	}
+	return SecretUsage{}, 0, false
+}
+
+// podSecretReferenceTypes returns the secrets referenced by a pod and the ways they are referenced, sorted
+func podSecretReferenceTypes(pod *corev1.Pod) map[string][]string {
+	refs := make(map[string]map[string]bool)
+	add := func(name, referenceType string) {
+		if name == "" {
+			return
+		}
+		if refs[name] == nil {
+			refs[name] = make(map[string]bool)
+		}
+		refs[name][referenceType] = true
+	}
+	for i := range pod.Spec.Volumes {
+		volume := &pod.Spec.Volumes[i]
+		if volume.Secret != nil {
+			add(volume.Secret.SecretName, SecretReferenceVolume)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					add(source.Secret.Name, SecretReferenceProjectedVolume)
+				}
+			}
+		}
+	}
+	for _, imagePullSecret := range pod.Spec.ImagePullSecrets {
+		add(imagePullSecret.Name, SecretReferenceImagePull)
+	}
+	addContainer := func(envFrom []corev1.EnvFromSource, env []corev1.EnvVar) {
+		for _, source := range envFrom {
+			if source.SecretRef != nil {
+				add(source.SecretRef.Name, SecretReferenceEnvFrom)
+			}
+		}
+		for _, envVar := range env {
+			if envVar.ValueFrom != nil && envVar.ValueFrom.SecretKeyRef != nil {
+				add(envVar.ValueFrom.SecretKeyRef.Name, SecretReferenceSecretKeyRef)
+			}
+		}
+	}
+	for i := range pod.Spec.InitContainers {
+		addContainer(pod.Spec.InitContainers[i].EnvFrom, pod.Spec.InitContainers[i].Env)
+	}
+	for i := range pod.Spec.Containers {
+		addContainer(pod.Spec.Containers[i].EnvFrom, pod.Spec.Containers[i].Env)
+	}
+	for i := range pod.Spec.EphemeralContainers {
+		addContainer(pod.Spec.EphemeralContainers[i].EnvFrom, pod.Spec.EphemeralContainers[i].Env)
+	}
+	secrets := make(map[string][]string, len(refs))
+	for name, types := range refs {
+		for t := range types {
+			secrets[name] = append(secrets[name], t)
+		}
+		sort.Strings(secrets[name])
+	}
+	return secrets
+}
+
+// reportSecretUsage reports the secrets which their usage is changed, the referenced secrets which do not exist are reported with their name and usage only.
+// It is called by the secret watcher only, the other watchers queue the keys by notify
+func (wh *WatchHandler) reportSecretUsage(keys []string) {
+	reported := false
+	for _, key := range keys {
+		namespace, name, _ := strings.Cut(key, "/")
+		if !wh.isNamespaceWatched(namespace) {
+			continue
+		}
+		if id, secretdm, ok := wh.findSecret(namespace, name); ok {
+			usage := wh.secretUsage.usage(namespace, name)
+			if secretdm.Usage != nil && reflect.DeepEqual(*secretdm.Usage, usage) {
+				continue
+			}
+			secretdm.Usage = &usage
+			wh.secretdm.updateFront(id, secretdm)
+			wh.jsonReport.AddToJsonFormat(secretdm, SECRETS, UPDATED)
+			reported = true
+			continue
+		}
+		if usage, stype, ok := wh.secretUsage.missingSecretDelta(namespace, name); ok {
+			wh.jsonReport.AddToJsonFormat(newMissingSecretData(namespace, name, usage), SECRETS, stype)
+			reported = true
+		}
+	}
+	if reported {
+		informNewDataArrive(wh)
+	}
+}
+
+func newMissingSecretData(namespace, name string, usage SecretUsage) secretData {
+	return secretData{
+		Secret: &corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		},
+		Usage: &usage,
+	}
+}
+
+// findSecret returns the stored secret and its id
+func (wh *WatchHandler) findSecret(namespace, name string) (int, secretData, bool) {
+	for _, id := range wh.secretdm.getIDs() {
+		front := wh.secretdm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		secretdm, ok := front.Value.(secretData)
+		if !ok || secretdm.Secret == nil {
+			continue
+		}
+		if secretdm.Secret.Namespace == namespace && secretdm.Secret.Name == name {
+			return id, secretdm, true
+		}
+	}
+	return 0, secretData{}, false
+}
+
+// ServiceAccountWatch watch over service accounts and report the usage changes of the secrets they list
+func (wh *WatchHandler) ServiceAccountWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER ServiceAccountWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over service accounts starting")
+		serviceAccounts, err := wh.RestAPIClient.CoreV1().ServiceAccounts("").List(globalHTTPContext, metav1.ListOptions{})
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed listing service accounts", helpers.Error(err))
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		// the unused secrets are reported only once the references of all the existing service accounts are known
+		for i := range serviceAccounts.Items {
+			wh.serviceAccountEventHandler(&watch.Event{Type: watch.Added, Object: &serviceAccounts.Items[i]})
+		}
+		wh.secretUsage.notify(wh.secretUsage.setServiceAccountsSynced())
+		serviceAccountsWatcher, err := wh.RestAPIClient.CoreV1().ServiceAccounts("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true, ResourceVersion: serviceAccounts.ResourceVersion})
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over service accounts", helpers.Error(err))
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		serviceAccountsChan := serviceAccountsWatcher.ResultChan()
+		logger.L().Info("Watching over service accounts started")
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-serviceAccountsChan:
+			case <-newStateChan:
+				serviceAccountsWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("service accounts watch chan loop", helpers.Interface("error", event.Object))
+				serviceAccountsWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.serviceAccountEventHandler(&event); err != nil {
+				break ChanLoop
+			}
+		}
+		logger.L().Debug("Watching over service accounts ended - timeout")
+	}
+}
+
+// syncPodSecretReferences sets the secret references of the existing pods, so the unused secrets are reported only once they are known.
+// It is called by the pod watcher before it starts watching
+func (wh *WatchHandler) syncPodSecretReferences(ctx context.Context) {
+	pods, err := wh.RestAPIClient.CoreV1().Pods("").List(globalHTTPContext, metav1.ListOptions{})
+	if err != nil {
+		logger.L().Ctx(ctx).Error("Failed listing pods for the secret references", helpers.Error(err))
+		return
+	}
+	var keys []string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !wh.isNamespaceWatched(pod.Namespace) {
+			continue
+		}
+		od, err := GetAncestorOfPod(ctx, pod, wh)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, wh.secretUsage.setPod(pod, newImageWorkload(pod, &od))...)
+	}
+	wh.secretUsage.notify(append(keys, wh.secretUsage.setPodsSynced()...))
+}
+
+func (wh *WatchHandler) serviceAccountEventHandler(event *watch.Event) error {
+	serviceAccount, ok := event.Object.(*corev1.ServiceAccount)
+	if !ok {
+		return fmt.Errorf("got unexpected service account from chan")
+	}
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		wh.secretUsage.notify(wh.secretUsage.setServiceAccount(serviceAccount))
+	case watch.Deleted:
+		wh.secretUsage.notify(wh.secretUsage.removeServiceAccount(serviceAccount.Namespace, serviceAccount.Name))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newSecretsPod(name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+			Volumes: []corev1.Volume{
+				{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}}},
+				{Name: "projected", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+					{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}}},
+				}}}},
+			},
+			InitContainers: []corev1.Container{{Name: "init", EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}}}}}},
+			Containers: []corev1.Container{{Name: "app", Env: []corev1.EnvVar{
+				{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"}}},
+				{Name: "MODE", Value: "production"},
+			}}},
+		},
+	}
+}
+
+func TestPodSecretReferenceTypes(t *testing.T) {
+	assert.Equal(t, map[string][]string{
+		"registry": {SecretReferenceImagePull},
+		"tls":      {SecretReferenceVolume},
+		"db":       {SecretReferenceEnvFrom, SecretReferenceProjectedVolume, SecretReferenceSecretKeyRef},
+	}, podSecretReferenceTypes(newSecretsPod("web-a")))
+}
+
+func TestSecretUsageIndex(t *testing.T) {
+	index := newSecretUsageIndex()
+	workload := ImageWorkload{Namespace: "default", Kind: "Deployment", Name: "web"}
+	index.setSecret("default", "db", true)
+	index.setSecret("default", "unused", true)
+
+	assert.Equal(t, []string{"default/db", "default/registry", "default/tls"}, index.setPod(newSecretsPod("web-a"), workload))
+	assert.Empty(t, index.setPod(newSecretsPod("web-a"), workload), "the same references are not changed")
+	index.setPod(newSecretsPod("web-b"), workload)
+	assert.Equal(t, []string{"default/registry"}, index.setServiceAccount(&corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "builder", Namespace: "default"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+	}))
+
+	assert.Equal(t, SecretUsage{Workloads: []SecretConsumer{{
+		Kind:       "Deployment",
+		Name:       "web",
+		Pods:       []string{"web-a", "web-b"},
+		References: []string{SecretReferenceEnvFrom, SecretReferenceProjectedVolume, SecretReferenceSecretKeyRef},
+	}}}, index.usage("default", "db"))
+	registry := index.usage("default", "registry")
+	assert.Equal(t, []string{"builder"}, registry.ServiceAccounts)
+	assert.True(t, registry.Missing)
+	assert.False(t, index.usage("default", "unused").Unused, "the references are not known yet")
+	assert.Empty(t, index.setPodsSynced())
+	assert.Equal(t, []string{"default/db", "default/unused"}, index.setServiceAccountsSynced())
+	assert.True(t, index.usage("default", "unused").Unused)
+	assert.False(t, index.usage("other", "db").Missing, "the secrets are referenced in their namespace only")
+
+	assert.Equal(t, []string{"default/registry"}, index.removeServiceAccount("default", "builder"))
+	index.removePod("default", "web-a")
+	assert.Equal(t, []string{"default/db", "default/registry", "default/tls"}, index.removePod("default", "web-b"))
+	assert.True(t, index.usage("default", "db").Unused)
+	assert.Empty(t, index.pods)
+	assert.Empty(t, index.serviceAccounts)
+}
+
+func TestReportSecretUsage(t *testing.T) {
+	wh := &WatchHandler{secretdm: newResourceMap(), secretUsage: newSecretUsageIndex(), includeNamespaces: []string{""}, aggregateFirstDataFlag: true}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", CreationTimestamp: metav1.Now()}}
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: watch.Added, Object: secret.DeepCopy()}, time.Time{}))
+	assert.False(t, wh.jsonReport.Secret.Created[0].(secretData).Usage.Unused, "the references of the pods and the service accounts are not known yet")
+
+	// the secret is unused once the references are known
+	wh.reportSecretUsage(wh.secretUsage.setPodsSynced())
+	assert.Empty(t, wh.jsonReport.Secret.Updated)
+	wh.reportSecretUsage(wh.secretUsage.setServiceAccountsSynced())
+	assert.Len(t, wh.jsonReport.Secret.Updated, 1)
+	assert.True(t, wh.jsonReport.Secret.Updated[0].(secretData).Usage.Unused)
+
+	workload := ImageWorkload{Namespace: "default", Kind: "Deployment", Name: "web"}
+	wh.reportSecretUsage(wh.secretUsage.setPod(newSecretsPod("web-a"), workload))
+	// the existing secret is updated, the secrets which do not exist are not reported until all the secrets are listed
+	assert.Len(t, wh.jsonReport.Secret.Updated, 2)
+	updated := wh.jsonReport.Secret.Updated[1].(secretData)
+	assert.Equal(t, "db", updated.Name)
+	assert.False(t, updated.Usage.Unused)
+	assert.Len(t, wh.jsonReport.Secret.Created, 1)
+
+	// the referenced secrets which do not exist are reported as missing
+	wh.reportSecretUsage(wh.secretUsage.setSynced())
+	assert.Len(t, wh.jsonReport.Secret.Updated, 2)
+	assert.Len(t, wh.jsonReport.Secret.Created, 3)
+	for _, created := range wh.jsonReport.Secret.Created[1:] {
+		assert.True(t, created.(secretData).Usage.Missing)
+		assert.Contains(t, []string{"registry", "tls"}, created.(secretData).Name)
+	}
+
+	// no change, nothing is reported
+	wh.reportSecretUsage(wh.secretUsage.setPod(newSecretsPod("web-a"), workload))
+	assert.Len(t, wh.jsonReport.Secret.Updated, 2)
+
+	// the missing secret is created, the missing secret is deleted
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: watch.Added, Object: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default", CreationTimestamp: metav1.Now()}}}, time.Time{}))
+	assert.False(t, wh.jsonReport.Secret.Created[3].(secretData).Usage.Missing)
+	assert.Len(t, wh.jsonReport.Secret.Deleted, 1)
+	assert.Equal(t, "tls", wh.jsonReport.Secret.Deleted[0].(secretData).Name)
+	assert.True(t, wh.jsonReport.Secret.Deleted[0].(secretData).Usage.Missing)
+
+	// the referenced secret is deleted, it is reported as missing
+	assert.NoError(t, wh.secretEventHandler(&watch.Event{Type: watch.Deleted, Object: secret.DeepCopy()}, time.Time{}))
+	assert.Len(t, wh.jsonReport.Secret.Deleted, 2)
+	assert.True(t, wh.jsonReport.Secret.Created[4].(secretData).Usage.Missing)
+
+	// the pod is deleted, the missing secrets are not referenced anymore
+	wh.reportSecretUsage(wh.secretUsage.removePod("default", "web-a"))
+	assert.Len(t, wh.jsonReport.Secret.Deleted, 4)
+}
+
+func TestSecretUsageNotify(t *testing.T) {
+	index := newSecretUsageIndex()
+	index.notify(nil)
+	assert.Len(t, index.changed, 0)
+
+	// the keys are queued for the secret watcher, a single signal is kept
+	index.notify([]string{"default/tls", "default/db"})
+	index.notify([]string{"default/db"})
+	assert.Len(t, index.changed, 1)
+	<-index.changed
+	assert.Equal(t, []string{"default/db", "default/tls"}, index.takePending())
+	assert.Empty(t, index.takePending())
+}
+
+func TestSyncPodSecretReferences(t *testing.T) {
+	pod := newSecretsPod("web-a")
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d8f", APIVersion: "apps/v1", UID: "replicaset-uid"}}
+	wh := &WatchHandler{
+		RestAPIClient: fake.NewSimpleClientset(pod,
+			&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "web-5d8f", Namespace: "default", UID: "replicaset-uid",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", APIVersion: "apps/v1", UID: "deployment-uid"}}}},
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "deployment-uid"}},
+		),
+		secretUsage:       newSecretUsageIndex(),
+		ownerCache:        newOwnerCache(),
+		includeNamespaces: []string{""},
+	}
+	wh.syncPodSecretReferences(context.Background())
+	assert.True(t, wh.secretUsage.arePodsSynced())
+	assert.Equal(t, []string{"default/db", "default/registry", "default/tls"}, wh.secretUsage.takePending())
+	assert.Equal(t, "web", wh.secretUsage.usage("default", "db").Workloads[0].Name)
+}
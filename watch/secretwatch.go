@@ -14,9 +14,11 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 )
 
-// secretData -
+// secretData a secret without its data, with the metadata derived from the data
 type secretData struct {
-	Secret *corev1.Secret `json:",inline"`
+	*corev1.Secret
+	Metadata *SecretMetadata `json:"secretMetadata,omitempty"`
+	Usage    *SecretUsage    `json:"usage,omitempty"`
 }
 
 // SecretWatch watch over secrets
@@ -32,7 +34,17 @@ func (wh *WatchHandler) SecretWatch(ctx context.Context) {
 WatchLoop:
 	for {
 		logger.L().Info("Watching over secrets starting")
-		secretsWatcher, err := wh.RestAPIClient.CoreV1().Secrets("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		secrets, err := wh.RestAPIClient.CoreV1().Secrets("").List(globalHTTPContext, metav1.ListOptions{})
+		if err != nil {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		// the referenced secrets are reported as missing only once all the existing secrets are known
+		for i := range secrets.Items {
+			wh.secretEventHandler(&watch.Event{Type: watch.Added, Object: &secrets.Items[i]}, lastWatchEventCreationTime)
+		}
+		wh.reportSecretUsage(wh.secretUsage.setSynced())
+		secretsWatcher, err := wh.RestAPIClient.CoreV1().Secrets("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true, ResourceVersion: secrets.ResourceVersion})
 		if err != nil {
 			time.Sleep(1 * time.Second)
 			continue
@@ -44,6 +56,9 @@ WatchLoop:
 			var event watch.Event
 			select {
 			case event = <-secretsChan:
+			case <-wh.secretUsage.changed:
+				wh.reportSecretUsage(wh.secretUsage.takePending())
+				continue
 			case <-newStateChan:
 				secretsWatcher.Stop()
 				continue WatchLoop
@@ -66,26 +81,37 @@ func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCre
 			return nil
 		}
 		secret.ManagedFields = []metav1.ManagedFieldsEntry{}
+		secretdm := secretData{Secret: secret, Metadata: newSecretMetadata(secret)}
 		removeSecretData(secret)
+		if event.Type == watch.Added || event.Type == watch.Modified {
+			if missing, reported := wh.secretUsage.setSecret(secret.Namespace, secret.Name, true); reported {
+				wh.jsonReport.AddToJsonFormat(newMissingSecretData(secret.Namespace, secret.Name, missing), SECRETS, DELETED)
+				informNewDataArrive(wh)
+			}
+			usage := wh.secretUsage.usage(secret.Namespace, secret.Name)
+			secretdm.Usage = &usage
+		}
 		switch event.Type {
 		case watch.Added:
 			if secret.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
 				return nil
 			}
-			secretdm := secretData{Secret: secret}
 			id := CreateID()
 			wh.secretdm.init(id)
 			wh.secretdm.pushBack(id, secretdm)
 			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(secret, SECRETS, CREATED)
+			wh.jsonReport.AddToJsonFormat(secretdm, SECRETS, CREATED)
 		case watch.Modified:
-			wh.updateSecret(secret)
+			wh.updateSecret(secretdm)
 			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(secret, SECRETS, UPDATED)
+			wh.jsonReport.AddToJsonFormat(secretdm, SECRETS, UPDATED)
 		case watch.Deleted:
 			wh.removeSecret(secret)
 			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(secret, SECRETS, DELETED)
+			wh.jsonReport.AddToJsonFormat(secretdm, SECRETS, DELETED)
+			// the secret is reported as missing if it is still referenced
+			wh.secretUsage.setSecret(secret.Namespace, secret.Name, false)
+			wh.reportSecretUsage([]string{secretKey(secret.Namespace, secret.Name)})
 		case watch.Bookmark: //only the resource version is changed but it's the same workload
 			return nil
 		case watch.Error:
@@ -98,7 +124,8 @@ func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCre
 }
 
 // UpdateSecret update websocket when secret is updated
-func (wh *WatchHandler) updateSecret(secret *corev1.Secret) {
+func (wh *WatchHandler) updateSecret(secretdm secretData) {
+	secret := secretdm.Secret
 	for _, id := range wh.secretdm.getIDs() {
 		front := wh.secretdm.front(id)
 		if front == nil || front.Value == nil {
@@ -111,12 +138,12 @@ func (wh *WatchHandler) updateSecret(secret *corev1.Secret) {
 		if strings.Compare(secretData.Secret.Namespace, secret.Namespace) != 0 {
 			continue
 		}
-		if strings.Compare(secretData.Secret.ObjectMeta.Name, secret.ObjectMeta.Name) == 0 {
-			*secretData.Secret = *secret
-			break
-		}
-		if strings.Compare(secretData.Secret.ObjectMeta.GenerateName, secret.ObjectMeta.Name) == 0 {
+		if strings.Compare(secretData.Secret.ObjectMeta.Name, secret.ObjectMeta.Name) == 0 ||
+			strings.Compare(secretData.Secret.ObjectMeta.GenerateName, secret.ObjectMeta.Name) == 0 {
 			*secretData.Secret = *secret
+			secretData.Metadata = secretdm.Metadata
+			secretData.Usage = secretdm.Usage
+			wh.secretdm.updateFront(id, secretData)
 			break
 		}
 	}
@@ -0,0 +1,252 @@
+package watch
+
+import (
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	RiskPrivileged               = "Privileged"
+	RiskAddedCapabilities        = "AddedCapabilities"
+	RiskRunAsRoot                = "RunAsRoot"
+	RiskRunAsUserUnknown         = "RunAsUserUnknown"
+	RiskAllowPrivilegeEscalation = "AllowPrivilegeEscalation"
+	RiskWritableRootFilesystem   = "WritableRootFilesystem"
+	RiskSeccompUnconfined        = "SeccompUnconfined"
+	RiskAppArmorUnconfined       = "AppArmorUnconfined"
+	RiskHostPID                  = "HostPID"
+	RiskHostNetwork              = "HostNetwork"
+	RiskHostIPC                  = "HostIPC"
+	RiskHostPathMount            = "HostPathMount"
+
+	appArmorAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+	// the beta annotation values
+	appArmorAnnotationUnconfined     = "unconfined"
+	appArmorAnnotationRuntimeDefault = "runtime/default"
+	appArmorAnnotationLocalhost      = "localhost/"
+	// the reported profiles, in the format of the seccomp profiles
+	appArmorProfileUnconfined     = "Unconfined"
+	appArmorProfileRuntimeDefault = "RuntimeDefault"
+	appArmorProfileLocalhost      = "Localhost"
+)
+
+// SecuritySummary the security posture of a microservice, computed from its pod template
+type SecuritySummary struct {
+	HostPID     bool `json:"hostPID"`
+	HostNetwork bool `json:"hostNetwork"`
+	HostIPC     bool `json:"hostIPC"`
+	// HostPathVolumes the host path volumes mounted by the containers
+	HostPathVolumes []HostPathVolume    `json:"hostPathVolumes,omitempty"`
+	Containers      []ContainerSecurity `json:"containers,omitempty"`
+	// Risks the risky settings found in the pod or in any of the containers, sorted
+	Risks []string `json:"risks,omitempty"`
+}
+
+type HostPathVolume struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+// ContainerSecurity the effective security context of a container, the container settings override the pod settings
+type ContainerSecurity struct {
+	Name              string   `json:"name"`
+	Type              string   `json:"type"`
+	Privileged        bool     `json:"privileged"`
+	AddedCapabilities []string `json:"addedCapabilities,omitempty"`
+	// RunAsUser the user of the security context, nil when the user of the image is used
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+	// RunAsRoot the user of the security context is root
+	RunAsRoot bool `json:"runAsRoot"`
+	// RunAsUserUnknown the user of the image is used and may be root, runAsNonRoot is not set
+	RunAsUserUnknown         bool   `json:"runAsUserUnknown"`
+	AllowPrivilegeEscalation bool   `json:"allowPrivilegeEscalation"`
+	ReadOnlyRootFilesystem   bool   `json:"readOnlyRootFilesystem"`
+	SeccompProfile           string `json:"seccompProfile,omitempty"`
+	AppArmorProfile          string `json:"appArmorProfile,omitempty"`
+}
+
+// newSecuritySummary computes the security summary of a pod spec. The annotations are used for the AppArmor profiles
+func newSecuritySummary(spec *core.PodSpec, annotations map[string]string) *SecuritySummary {
+	summary := &SecuritySummary{HostPID: spec.HostPID, HostNetwork: spec.HostNetwork, HostIPC: spec.HostIPC}
+	risks := make(map[string]bool)
+	if spec.HostPID {
+		risks[RiskHostPID] = true
+	}
+	if spec.HostNetwork {
+		risks[RiskHostNetwork] = true
+	}
+	if spec.HostIPC {
+		risks[RiskHostIPC] = true
+	}
+
+	hostPaths := make(map[string]string)
+	for i := range spec.Volumes {
+		if spec.Volumes[i].HostPath != nil {
+			hostPaths[spec.Volumes[i].Name] = spec.Volumes[i].HostPath.Path
+		}
+	}
+	mounted := make(map[string]bool)
+	addContainer := func(container *core.Container, containerType string) {
+		for _, mount := range container.VolumeMounts {
+			path, ok := hostPaths[mount.Name]
+			if !ok || mounted[mount.Name] {
+				continue
+			}
+			mounted[mount.Name] = true
+			summary.HostPathVolumes = append(summary.HostPathVolumes, HostPathVolume{Name: mount.Name, Path: path, ReadOnly: mount.ReadOnly})
+			risks[RiskHostPathMount] = true
+		}
+		containerSecurity := newContainerSecurity(container, containerType, spec.SecurityContext, annotations)
+		for _, risk := range containerSecurity.risks() {
+			risks[risk] = true
+		}
+		summary.Containers = append(summary.Containers, containerSecurity)
+	}
+	for i := range spec.InitContainers {
+		addContainer(&spec.InitContainers[i], ContainerTypeInit)
+	}
+	for i := range spec.Containers {
+		addContainer(&spec.Containers[i], ContainerTypeContainer)
+	}
+	for i := range spec.EphemeralContainers {
+		addContainer((*core.Container)(&spec.EphemeralContainers[i].EphemeralContainerCommon), ContainerTypeEphemeral)
+	}
+
+	for risk := range risks {
+		summary.Risks = append(summary.Risks, risk)
+	}
+	sort.Strings(summary.Risks)
+	return summary
+}
+
+func newContainerSecurity(container *core.Container, containerType string, podContext *core.PodSecurityContext, annotations map[string]string) ContainerSecurity {
+	containerSecurity := ContainerSecurity{
+		Name:                     container.Name,
+		Type:                     containerType,
+		AllowPrivilegeEscalation: true,
+		AppArmorProfile:          appArmorAnnotationProfile(annotations[appArmorAnnotationPrefix+container.Name]),
+	}
+	var runAsUser *int64
+	var runAsNonRoot *bool
+	if podContext != nil {
+		runAsUser, runAsNonRoot = podContext.RunAsUser, podContext.RunAsNonRoot
+		containerSecurity.SeccompProfile = seccompProfile(podContext.SeccompProfile)
+	}
+	if sc := container.SecurityContext; sc != nil {
+		containerSecurity.Privileged = sc.Privileged != nil && *sc.Privileged
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Add {
+				containerSecurity.AddedCapabilities = append(containerSecurity.AddedCapabilities, string(capability))
+			}
+		}
+		if sc.AllowPrivilegeEscalation != nil {
+			containerSecurity.AllowPrivilegeEscalation = *sc.AllowPrivilegeEscalation
+		}
+		containerSecurity.ReadOnlyRootFilesystem = sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem
+		if sc.RunAsUser != nil {
+			runAsUser = sc.RunAsUser
+		}
+		if sc.RunAsNonRoot != nil {
+			runAsNonRoot = sc.RunAsNonRoot
+		}
+		if profile := seccompProfile(sc.SeccompProfile); profile != "" {
+			containerSecurity.SeccompProfile = profile
+		}
+	}
+	if containerSecurity.Privileged {
+		// a privileged container can always escalate
+		containerSecurity.AllowPrivilegeEscalation = true
+	}
+	containerSecurity.RunAsUser = runAsUser
+	containerSecurity.RunAsRoot = runAsUser != nil && *runAsUser == 0
+	// without an explicit user the image user is used, the kubelet only rejects root when runAsNonRoot is set
+	containerSecurity.RunAsUserUnknown = runAsUser == nil && (runAsNonRoot == nil || !*runAsNonRoot)
+	return containerSecurity
+}
+
+func (containerSecurity *ContainerSecurity) risks() []string {
+	var risks []string
+	if containerSecurity.Privileged {
+		risks = append(risks, RiskPrivileged)
+	}
+	if len(containerSecurity.AddedCapabilities) > 0 {
+		risks = append(risks, RiskAddedCapabilities)
+	}
+	if containerSecurity.RunAsRoot {
+		risks = append(risks, RiskRunAsRoot)
+	}
+	if containerSecurity.RunAsUserUnknown {
+		risks = append(risks, RiskRunAsUserUnknown)
+	}
+	if containerSecurity.AllowPrivilegeEscalation {
+		risks = append(risks, RiskAllowPrivilegeEscalation)
+	}
+	if !containerSecurity.ReadOnlyRootFilesystem {
+		risks = append(risks, RiskWritableRootFilesystem)
+	}
+	if containerSecurity.SeccompProfile == "" || containerSecurity.SeccompProfile == string(core.SeccompProfileTypeUnconfined) {
+		risks = append(risks, RiskSeccompUnconfined)
+	}
+	if containerSecurity.AppArmorProfile == appArmorProfileUnconfined {
+		risks = append(risks, RiskAppArmorUnconfined)
+	}
+	return risks
+}
+
+// seccompProfile returns the profile type, with the path of a localhost profile
+func seccompProfile(profile *core.SeccompProfile) string {
+	if profile == nil {
+		return ""
+	}
+	if profile.Type == core.SeccompProfileTypeLocalhost && profile.LocalhostProfile != nil {
+		return string(profile.Type) + "/" + strings.TrimPrefix(*profile.LocalhostProfile, "/")
+	}
+	return string(profile.Type)
+}
+
+// appArmorAnnotationProfile returns the profile of a beta annotation value in the format of the seccomp profiles
+func appArmorAnnotationProfile(value string) string {
+	switch {
+	case value == appArmorAnnotationUnconfined:
+		return appArmorProfileUnconfined
+	case value == appArmorAnnotationRuntimeDefault:
+		return appArmorProfileRuntimeDefault
+	case strings.HasPrefix(value, appArmorAnnotationLocalhost):
+		return appArmorProfileLocalhost + "/" + strings.TrimPrefix(value, appArmorAnnotationLocalhost)
+	}
+	return value
+}
+
+// microServiceTemplateAnnotations returns the pod template annotations of a workload microservice, or the pod annotations
+func microServiceTemplateAnnotations(msd *MicroServiceData) map[string]string {
+	switch owner := msd.Owner.OwnerData.(type) {
+	case *appsv1.Deployment:
+		return owner.Spec.Template.Annotations
+	case *appsv1.StatefulSet:
+		return owner.Spec.Template.Annotations
+	case *appsv1.DaemonSet:
+		return owner.Spec.Template.Annotations
+	case *appsv1.ReplicaSet:
+		return owner.Spec.Template.Annotations
+	case *batchv1.Job:
+		return owner.Spec.Template.Annotations
+	case *batchv1.CronJob:
+		return owner.Spec.JobTemplate.Spec.Template.Annotations
+	}
+	return msd.Pod.Annotations
+}
+
+// setSecuritySummary sets the security summary of a reported microservice
+func setSecuritySummary(data interface{}) interface{} {
+	msd, ok := data.(MicroServiceData)
+	if !ok || msd.Pod == nil {
+		return data
+	}
+	msd.SecuritySummary = newSecuritySummary(&msd.Pod.Spec, microServiceTemplateAnnotations(&msd))
+	return msd
+}
@@ -0,0 +1,117 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewSecuritySummary(t *testing.T) {
+	privileged, noEscalation, readOnly, nonRoot := true, false, true, true
+	root, user := int64(0), int64(1000)
+	localhostProfile := "profiles/audit.json"
+	spec := &core.PodSpec{
+		HostNetwork: true,
+		SecurityContext: &core.PodSecurityContext{
+			RunAsNonRoot:   &nonRoot,
+			RunAsUser:      &user,
+			SeccompProfile: &core.SeccompProfile{Type: core.SeccompProfileTypeRuntimeDefault},
+		},
+		Volumes: []core.Volume{
+			{Name: "docker-sock", VolumeSource: core.VolumeSource{HostPath: &core.HostPathVolumeSource{Path: "/var/run/docker.sock"}}},
+			{Name: "cache", VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}}},
+		},
+		InitContainers: []core.Container{{Name: "init", SecurityContext: &core.SecurityContext{RunAsUser: &root}}},
+		Containers: []core.Container{
+			{Name: "app", VolumeMounts: []core.VolumeMount{{Name: "cache"}}, SecurityContext: &core.SecurityContext{
+				AllowPrivilegeEscalation: &noEscalation,
+				ReadOnlyRootFilesystem:   &readOnly,
+			}},
+			{Name: "agent", VolumeMounts: []core.VolumeMount{{Name: "docker-sock", ReadOnly: true}}, SecurityContext: &core.SecurityContext{
+				Privileged:     &privileged,
+				Capabilities:   &core.Capabilities{Add: []core.Capability{"NET_ADMIN", "SYS_PTRACE"}},
+				SeccompProfile: &core.SeccompProfile{Type: core.SeccompProfileTypeLocalhost, LocalhostProfile: &localhostProfile},
+			}},
+		},
+	}
+	summary := newSecuritySummary(spec, map[string]string{appArmorAnnotationPrefix + "agent": "unconfined"})
+
+	assert.True(t, summary.HostNetwork)
+	assert.False(t, summary.HostPID)
+	assert.Equal(t, []HostPathVolume{{Name: "docker-sock", Path: "/var/run/docker.sock", ReadOnly: true}}, summary.HostPathVolumes)
+	assert.Len(t, summary.Containers, 3)
+
+	assert.Equal(t, ContainerSecurity{
+		Name:                     "init",
+		Type:                     ContainerTypeInit,
+		RunAsUser:                &root,
+		RunAsRoot:                true,
+		AllowPrivilegeEscalation: true,
+		SeccompProfile:           "RuntimeDefault",
+	}, summary.Containers[0])
+	assert.Equal(t, ContainerSecurity{
+		Name:                   "app",
+		Type:                   ContainerTypeContainer,
+		RunAsUser:              &user,
+		ReadOnlyRootFilesystem: true,
+		SeccompProfile:         "RuntimeDefault",
+	}, summary.Containers[1])
+	assert.Empty(t, summary.Containers[1].risks())
+	assert.Equal(t, ContainerSecurity{
+		Name:                     "agent",
+		Type:                     ContainerTypeContainer,
+		Privileged:               true,
+		AddedCapabilities:        []string{"NET_ADMIN", "SYS_PTRACE"},
+		RunAsUser:                &user,
+		AllowPrivilegeEscalation: true,
+		SeccompProfile:           "Localhost/profiles/audit.json",
+		AppArmorProfile:          "Unconfined",
+	}, summary.Containers[2])
+
+	assert.Equal(t, []string{
+		RiskAddedCapabilities,
+		RiskAllowPrivilegeEscalation,
+		RiskAppArmorUnconfined,
+		RiskHostNetwork,
+		RiskHostPathMount,
+		RiskPrivileged,
+		RiskRunAsRoot,
+		RiskWritableRootFilesystem,
+	}, summary.Risks)
+}
+
+func TestNewSecuritySummaryDefaults(t *testing.T) {
+	summary := newSecuritySummary(&core.PodSpec{Containers: []core.Container{{Name: "nginx"}}}, nil)
+	assert.Equal(t, []string{RiskAllowPrivilegeEscalation, RiskRunAsUserUnknown, RiskSeccompUnconfined, RiskWritableRootFilesystem}, summary.Risks)
+	assert.False(t, summary.Containers[0].RunAsRoot, "the user of the image is not known")
+	assert.Nil(t, summary.Containers[0].RunAsUser)
+}
+
+func TestAppArmorAnnotationProfile(t *testing.T) {
+	assert.Equal(t, "Unconfined", appArmorAnnotationProfile("unconfined"))
+	assert.Equal(t, "RuntimeDefault", appArmorAnnotationProfile("runtime/default"))
+	assert.Equal(t, "Localhost/k8s-nginx", appArmorAnnotationProfile("localhost/k8s-nginx"))
+	assert.Equal(t, "", appArmorAnnotationProfile(""))
+}
+
+func TestAddToJsonFormatSecuritySummary(t *testing.T) {
+	deployment := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: core.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{appArmorAnnotationPrefix + "nginx": "unconfined"}},
+	}}}
+	msd := MicroServiceData{
+		Pod:   &core.Pod{Spec: core.PodSpec{HostPID: true, Containers: []core.Container{{Name: "nginx"}}}},
+		Owner: OwnerDet{Name: "nginx", Kind: "Deployment", OwnerData: deployment},
+	}
+	jsonReport := &jsonFormat{}
+	jsonReport.AddToJsonFormat(msd, MICROSERVICES, CREATED)
+	reported := jsonReport.MicroServices.Created[0].(MicroServiceData)
+	assert.NotNil(t, reported.SecuritySummary)
+	assert.Contains(t, reported.SecuritySummary.Risks, RiskHostPID)
+	assert.Equal(t, "Unconfined", reported.SecuritySummary.Containers[0].AppArmorProfile)
+
+	jsonReport.AddToJsonFormat(msd, MICROSERVICES, DELETED)
+	assert.Nil(t, jsonReport.MicroServices.Deleted[0].(MicroServiceData).SecuritySummary)
+}
@@ -0,0 +1,572 @@
+package watch
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	volumeTypeHostPath  = "hostPath"
+	volumeTypeNFS       = "nfs"
+	volumeTypeCSI       = "csi"
+	volumeTypePVC       = "persistentVolumeClaim"
+	volumeTypeEphemeral = "ephemeral"
+	volumeTypeLocal     = "local"
+	volumeTypeUnknown   = "unknown"
+)
+
+// MicroServiceVolume describes a persistent volume mounted by a microservice and what backs it
+type MicroServiceVolume struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	ClaimName    string `json:"claimName,omitempty"`
+	VolumeName   string `json:"volumeName,omitempty"`
+	StorageClass string `json:"storageClassName,omitempty"`
+	Driver       string `json:"driver,omitempty"`
+	Path         string `json:"path,omitempty"`
+	Server       string `json:"server,omitempty"`
+}
+
+// claimChangeIndex the persistent volume claims changed since the microservices were resolved, by namespace/name.
+// The storage watchers notify the changes and the pod watcher resolves the microservices again, so the microservices are updated by a single goroutine
+type claimChangeIndex struct {
+	pending map[string]bool
+	changed chan struct{}
+	mutex   sync.Mutex
+}
+
+func newClaimChangeIndex() *claimChangeIndex {
+	return &claimChangeIndex{
+		pending: make(map[string]bool),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// notify queues a changed claim
+func (index *claimChangeIndex) notify(namespace, name string) {
+	index.mutex.Lock()
+	index.pending[podKey(namespace, name)] = true
+	index.mutex.Unlock()
+	select {
+	case index.changed <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// takePending returns and clears the queued claims
+func (index *claimChangeIndex) takePending() map[string]bool {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	pending := index.pending
+	index.pending = make(map[string]bool)
+	return pending
+}
+
+// refreshMicroServiceStorage resolves again the storage of the microservices mounting the changed claims, a claim may be bound or
+// its volume may be known only after the microservice was reported
+func (wh *WatchHandler) refreshMicroServiceStorage(claims map[string]bool) {
+	for _, pods := range wh.pdm {
+		if pods == nil || pods.Front() == nil {
+			continue
+		}
+		msd, ok := pods.Front().Value.(MicroServiceData)
+		if !ok || msd.Pod == nil || !mountsClaim(msd.Pod.Namespace, &msd.Pod.Spec, claims) {
+			continue
+		}
+		storage := wh.getMicroServiceStorage(msd.Pod.Namespace, &msd.Pod.Spec)
+		if reflect.DeepEqual(msd.Storage, storage) {
+			continue
+		}
+		msd.Storage = storage
+		pods.Front().Value = msd
+		if wh.isNamespaceWatched(msd.Pod.Namespace) {
+			wh.jsonReport.AddToJsonFormat(msd, MICROSERVICES, UPDATED)
+			informNewDataArrive(wh)
+		}
+	}
+}
+
+func mountsClaim(namespace string, podSpec *core.PodSpec, claims map[string]bool) bool {
+	for i := range podSpec.Volumes {
+		if claim := podSpec.Volumes[i].PersistentVolumeClaim; claim != nil && claims[podKey(namespace, claim.ClaimName)] {
+			return true
+		}
+	}
+	return false
+}
+
+// PersistentVolumeWatch watch over persistent volumes
+func (wh *WatchHandler) PersistentVolumeWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER PersistentVolumeWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	var lastWatchEventCreationTime time.Time
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over persistent volumes starting")
+		pvWatcher, err := wh.RestAPIClient.CoreV1().PersistentVolumes().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over persistent volumes", helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		pvChan := pvWatcher.ResultChan()
+		logger.L().Info("Watching over persistent volumes started")
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-pvChan:
+			case <-newStateChan:
+				pvWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("persistent volumes watch chan loop", helpers.Interface("error", event.Object))
+				pvWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.persistentVolumeEventHandler(&event, lastWatchEventCreationTime); err != nil {
+				break ChanLoop
+			}
+		}
+		lastWatchEventCreationTime = time.Now()
+	}
+}
+
+func (wh *WatchHandler) persistentVolumeEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+	pv, ok := event.Object.(*core.PersistentVolume)
+	if !ok {
+		return fmt.Errorf("got unexpected persistent volume from chan")
+	}
+	pv.ManagedFields = []metav1.ManagedFieldsEntry{}
+	removeLastAppliedConfiguration(&pv.ObjectMeta)
+	defer func() {
+		// the claim bound to the volume is resolved again once the volume is stored
+		if pv.Spec.ClaimRef != nil && event.Type != watch.Bookmark {
+			wh.claimChanges.notify(pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name)
+		}
+	}()
+	switch event.Type {
+	case watch.Added:
+		if pv.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
+			return nil
+		}
+		id := CreateID()
+		wh.persistentvolumedm.init(id)
+		wh.persistentvolumedm.pushBack(id, pv)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(pv, PERSISTENTVOLUMES, CREATED)
+	case watch.Modified:
+		updateClusterScopedObject(wh.persistentvolumedm, pv.Name, pv)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(pv, PERSISTENTVOLUMES, UPDATED)
+	case watch.Deleted:
+		removeClusterScopedObject(wh.persistentvolumedm, pv.Name)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(pv, PERSISTENTVOLUMES, DELETED)
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	case watch.Error:
+		return fmt.Errorf("while watching over persistent volumes we got an error")
+	}
+	return nil
+}
+
+// PersistentVolumeClaimWatch watch over persistent volume claims
+func (wh *WatchHandler) PersistentVolumeClaimWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER PersistentVolumeClaimWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	var lastWatchEventCreationTime time.Time
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over persistent volume claims starting")
+		pvcWatcher, err := wh.RestAPIClient.CoreV1().PersistentVolumeClaims("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over persistent volume claims", helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		pvcChan := pvcWatcher.ResultChan()
+		logger.L().Info("Watching over persistent volume claims started")
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-pvcChan:
+			case <-newStateChan:
+				pvcWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("persistent volume claims watch chan loop", helpers.Interface("error", event.Object))
+				pvcWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.persistentVolumeClaimEventHandler(&event, lastWatchEventCreationTime); err != nil {
+				break ChanLoop
+			}
+		}
+		lastWatchEventCreationTime = time.Now()
+	}
+}
+
+func (wh *WatchHandler) persistentVolumeClaimEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+	pvc, ok := event.Object.(*core.PersistentVolumeClaim)
+	if !ok {
+		return fmt.Errorf("got unexpected persistent volume claim from chan")
+	}
+	if !wh.isNamespaceWatched(pvc.Namespace) {
+		return nil
+	}
+	pvc.ManagedFields = []metav1.ManagedFieldsEntry{}
+	removeLastAppliedConfiguration(&pvc.ObjectMeta)
+	defer func() {
+		if event.Type != watch.Bookmark {
+			wh.claimChanges.notify(pvc.Namespace, pvc.Name)
+		}
+	}()
+	switch event.Type {
+	case watch.Added:
+		if pvc.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
+			return nil
+		}
+		id := CreateID()
+		wh.persistentvolumeclaimdm.init(id)
+		wh.persistentvolumeclaimdm.pushBack(id, pvc)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(pvc, PERSISTENTVOLUMECLAIMS, CREATED)
+	case watch.Modified:
+		wh.updatePersistentVolumeClaim(pvc)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(pvc, PERSISTENTVOLUMECLAIMS, UPDATED)
+	case watch.Deleted:
+		wh.removePersistentVolumeClaim(pvc)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(pvc, PERSISTENTVOLUMECLAIMS, DELETED)
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	case watch.Error:
+		return fmt.Errorf("while watching over persistent volume claims we got an error")
+	}
+	return nil
+}
+
+// StorageClassWatch watch over storage classes
+func (wh *WatchHandler) StorageClassWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER StorageClassWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	var lastWatchEventCreationTime time.Time
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+WatchLoop:
+	for {
+		logger.L().Info("Watching over storage classes starting")
+		scWatcher, err := wh.RestAPIClient.StorageV1().StorageClasses().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Failed watching over storage classes", helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		scChan := scWatcher.ResultChan()
+		logger.L().Info("Watching over storage classes started")
+	ChanLoop:
+		for {
+			var event watch.Event
+			select {
+			case event = <-scChan:
+			case <-newStateChan:
+				scWatcher.Stop()
+				continue WatchLoop
+			}
+
+			if event.Type == watch.Error {
+				logger.L().Ctx(ctx).Error("storage classes watch chan loop", helpers.Interface("error", event.Object))
+				scWatcher.Stop()
+				break ChanLoop
+			}
+			if err := wh.storageClassEventHandler(&event, lastWatchEventCreationTime); err != nil {
+				break ChanLoop
+			}
+		}
+		lastWatchEventCreationTime = time.Now()
+	}
+}
+
+func (wh *WatchHandler) storageClassEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
+	sc, ok := event.Object.(*storagev1.StorageClass)
+	if !ok {
+		return fmt.Errorf("got unexpected storage class from chan")
+	}
+	sc.ManagedFields = []metav1.ManagedFieldsEntry{}
+	removeLastAppliedConfiguration(&sc.ObjectMeta)
+	switch event.Type {
+	case watch.Added:
+		if sc.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
+			return nil
+		}
+		id := CreateID()
+		wh.storageclassdm.init(id)
+		wh.storageclassdm.pushBack(id, sc)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(sc, STORAGECLASSES, CREATED)
+	case watch.Modified:
+		updateClusterScopedObject(wh.storageclassdm, sc.Name, sc)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(sc, STORAGECLASSES, UPDATED)
+	case watch.Deleted:
+		removeClusterScopedObject(wh.storageclassdm, sc.Name)
+		informNewDataArrive(wh)
+		wh.jsonReport.AddToJsonFormat(sc, STORAGECLASSES, DELETED)
+	case watch.Bookmark: //only the resource version is changed but it's the same object
+		return nil
+	case watch.Error:
+		return fmt.Errorf("while watching over storage classes we got an error")
+	}
+	return nil
+}
+
+// updateClusterScopedObject replace the stored object with the same name
+func updateClusterScopedObject(rm *resourceMap, name string, obj metav1.Object) {
+	for _, id := range rm.getIDs() {
+		front := rm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		stored, ok := front.Value.(metav1.Object)
+		if !ok {
+			continue
+		}
+		if strings.Compare(stored.GetName(), name) == 0 {
+			rm.updateFront(id, obj)
+			return
+		}
+	}
+}
+
+// removeClusterScopedObject remove the stored object with the same name
+func removeClusterScopedObject(rm *resourceMap, name string) string {
+	for _, id := range rm.getIDs() {
+		front := rm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		stored, ok := front.Value.(metav1.Object)
+		if !ok {
+			continue
+		}
+		if strings.Compare(stored.GetName(), name) == 0 {
+			rm.remove(id)
+			return name
+		}
+	}
+	return ""
+}
+
+func (wh *WatchHandler) updatePersistentVolumeClaim(pvc *core.PersistentVolumeClaim) {
+	for _, id := range wh.persistentvolumeclaimdm.getIDs() {
+		front := wh.persistentvolumeclaimdm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		stored, ok := front.Value.(*core.PersistentVolumeClaim)
+		if !ok {
+			continue
+		}
+		if stored.Namespace == pvc.Namespace && stored.Name == pvc.Name {
+			wh.persistentvolumeclaimdm.updateFront(id, pvc)
+			return
+		}
+	}
+}
+
+func (wh *WatchHandler) removePersistentVolumeClaim(pvc *core.PersistentVolumeClaim) string {
+	for _, id := range wh.persistentvolumeclaimdm.getIDs() {
+		front := wh.persistentvolumeclaimdm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		stored, ok := front.Value.(*core.PersistentVolumeClaim)
+		if !ok {
+			continue
+		}
+		if stored.Namespace == pvc.Namespace && stored.Name == pvc.Name {
+			wh.persistentvolumeclaimdm.remove(id)
+			return pvc.Name
+		}
+	}
+	return ""
+}
+
+func (wh *WatchHandler) getPersistentVolumeClaim(namespace, name string) *core.PersistentVolumeClaim {
+	for _, id := range wh.persistentvolumeclaimdm.getIDs() {
+		front := wh.persistentvolumeclaimdm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if pvc, ok := front.Value.(*core.PersistentVolumeClaim); ok && pvc.Namespace == namespace && pvc.Name == name {
+			return pvc
+		}
+	}
+	return nil
+}
+
+func (wh *WatchHandler) getPersistentVolume(name string) *core.PersistentVolume {
+	for _, id := range wh.persistentvolumedm.getIDs() {
+		front := wh.persistentvolumedm.front(id)
+		if front == nil || front.Value == nil {
+			continue
+		}
+		if pv, ok := front.Value.(*core.PersistentVolume); ok && pv.Name == name {
+			return pv
+		}
+	}
+	return nil
+}
+
+// getMicroServiceStorage returns the persistent volumes mounted by the pod spec, resolving claims to their backing volumes
+func (wh *WatchHandler) getMicroServiceStorage(namespace string, podSpec *core.PodSpec) []MicroServiceVolume {
+	var volumes []MicroServiceVolume
+	for i := range podSpec.Volumes {
+		volume := &podSpec.Volumes[i]
+		msv, ok := volumeSourceToMicroServiceVolume(volume.Name, &volume.VolumeSource)
+		if !ok {
+			continue
+		}
+		if msv.Type == volumeTypePVC {
+			wh.resolvePersistentVolumeClaim(namespace, &msv)
+		}
+		volumes = append(volumes, msv)
+	}
+	return volumes
+}
+
+// resolvePersistentVolumeClaim fills the claim's bound volume and its backing type, in case they are known
+func (wh *WatchHandler) resolvePersistentVolumeClaim(namespace string, msv *MicroServiceVolume) {
+	pvc := wh.getPersistentVolumeClaim(namespace, msv.ClaimName)
+	if pvc == nil {
+		return
+	}
+	msv.VolumeName = pvc.Spec.VolumeName
+	if pvc.Spec.StorageClassName != nil {
+		msv.StorageClass = *pvc.Spec.StorageClassName
+	}
+	if msv.VolumeName == "" {
+		return
+	}
+	pv := wh.getPersistentVolume(msv.VolumeName)
+	if pv == nil {
+		return
+	}
+	msv.Type, msv.Driver, msv.Path, msv.Server = persistentVolumeSourceType(&pv.Spec.PersistentVolumeSource)
+	if msv.StorageClass == "" {
+		msv.StorageClass = pv.Spec.StorageClassName
+	}
+}
+
+// volumeSourceToMicroServiceVolume converts a pod volume to a MicroServiceVolume. Volumes which don't persist data (emptyDir, configMap, etc.) are ignored
+func volumeSourceToMicroServiceVolume(name string, source *core.VolumeSource) (MicroServiceVolume, bool) {
+	msv := MicroServiceVolume{Name: name}
+	switch {
+	case source.PersistentVolumeClaim != nil:
+		msv.Type = volumeTypePVC
+		msv.ClaimName = source.PersistentVolumeClaim.ClaimName
+	case source.Ephemeral != nil:
+		msv.Type = volumeTypeEphemeral
+		if source.Ephemeral.VolumeClaimTemplate != nil && source.Ephemeral.VolumeClaimTemplate.Spec.StorageClassName != nil {
+			msv.StorageClass = *source.Ephemeral.VolumeClaimTemplate.Spec.StorageClassName
+		}
+	case source.HostPath != nil:
+		msv.Type = volumeTypeHostPath
+		msv.Path = source.HostPath.Path
+	case source.NFS != nil:
+		msv.Type = volumeTypeNFS
+		msv.Server = source.NFS.Server
+		msv.Path = source.NFS.Path
+	case source.CSI != nil:
+		msv.Type = volumeTypeCSI
+		msv.Driver = source.CSI.Driver
+	case source.AWSElasticBlockStore != nil:
+		msv.Type = "awsElasticBlockStore"
+	case source.GCEPersistentDisk != nil:
+		msv.Type = "gcePersistentDisk"
+	case source.AzureDisk != nil:
+		msv.Type = "azureDisk"
+	case source.AzureFile != nil:
+		msv.Type = "azureFile"
+	case source.ISCSI != nil:
+		msv.Type = "iscsi"
+	case source.CephFS != nil:
+		msv.Type = "cephfs"
+	case source.RBD != nil:
+		msv.Type = "rbd"
+	case source.Glusterfs != nil:
+		msv.Type = "glusterfs"
+	default:
+		return msv, false
+	}
+	return msv, true
+}
+
+// persistentVolumeSourceType returns the type, CSI driver, path and server of the volume backing a persistent volume
+func persistentVolumeSourceType(source *core.PersistentVolumeSource) (string, string, string, string) {
+	switch {
+	case source.HostPath != nil:
+		return volumeTypeHostPath, "", source.HostPath.Path, ""
+	case source.NFS != nil:
+		return volumeTypeNFS, "", source.NFS.Path, source.NFS.Server
+	case source.CSI != nil:
+		return volumeTypeCSI, source.CSI.Driver, "", ""
+	case source.Local != nil:
+		return volumeTypeLocal, "", source.Local.Path, ""
+	case source.AWSElasticBlockStore != nil:
+		return "awsElasticBlockStore", "", "", ""
+	case source.GCEPersistentDisk != nil:
+		return "gcePersistentDisk", "", "", ""
+	case source.AzureDisk != nil:
+		return "azureDisk", "", "", ""
+	case source.AzureFile != nil:
+		return "azureFile", "", "", ""
+	case source.ISCSI != nil:
+		return "iscsi", "", "", ""
+	case source.CephFS != nil:
+		return "cephfs", "", "", ""
+	case source.RBD != nil:
+		return "rbd", "", "", ""
+	case source.Glusterfs != nil:
+		return "glusterfs", "", "", ""
+	}
+	return volumeTypeUnknown, "", "", ""
+}
+
+func removeLastAppliedConfiguration(meta *metav1.ObjectMeta) {
+	if meta.Annotations != nil {
+		delete(meta.Annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	}
+}
@@ -0,0 +1,106 @@
+package watch
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestGetMicroServiceStorage(t *testing.T) {
+	storageClass := "standard"
+	wh := WatchHandler{
+		persistentvolumedm:      newResourceMap(),
+		persistentvolumeclaimdm: newResourceMap(),
+	}
+
+	pvc := &core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+		Spec:       core.PersistentVolumeClaimSpec{VolumeName: "pv-data", StorageClassName: &storageClass},
+	}
+	id := CreateID()
+	wh.persistentvolumeclaimdm.init(id)
+	wh.persistentvolumeclaimdm.pushBack(id, pvc)
+
+	pv := &core.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-data"},
+		Spec: core.PersistentVolumeSpec{
+			PersistentVolumeSource: core.PersistentVolumeSource{CSI: &core.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com"}},
+		},
+	}
+	id = CreateID()
+	wh.persistentvolumedm.init(id)
+	wh.persistentvolumedm.pushBack(id, pv)
+
+	podSpec := core.PodSpec{
+		Volumes: []core.Volume{
+			{Name: "data", VolumeSource: core.VolumeSource{PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+			{Name: "missing", VolumeSource: core.VolumeSource{PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: "missing"}}},
+			{Name: "host", VolumeSource: core.VolumeSource{HostPath: &core.HostPathVolumeSource{Path: "/var/run"}}},
+			{Name: "share", VolumeSource: core.VolumeSource{NFS: &core.NFSVolumeSource{Server: "10.0.0.1", Path: "/exports"}}},
+			{Name: "cache", VolumeSource: core.VolumeSource{EmptyDir: &core.EmptyDirVolumeSource{}}},
+			{Name: "config", VolumeSource: core.VolumeSource{ConfigMap: &core.ConfigMapVolumeSource{}}},
+		},
+	}
+
+	volumes := wh.getMicroServiceStorage("default", &podSpec)
+	assert.Equal(t, []MicroServiceVolume{
+		{Name: "data", Type: volumeTypeCSI, ClaimName: "data", VolumeName: "pv-data", StorageClass: "standard", Driver: "ebs.csi.aws.com"},
+		{Name: "missing", Type: volumeTypePVC, ClaimName: "missing"},
+		{Name: "host", Type: volumeTypeHostPath, Path: "/var/run"},
+		{Name: "share", Type: volumeTypeNFS, Path: "/exports", Server: "10.0.0.1"},
+	}, volumes)
+
+	assert.Empty(t, wh.getMicroServiceStorage("other", &core.PodSpec{Volumes: podSpec.Volumes[4:]}))
+}
+
+func TestRefreshMicroServiceStorage(t *testing.T) {
+	wh := WatchHandler{
+		persistentvolumedm:      newResourceMap(),
+		persistentvolumeclaimdm: newResourceMap(),
+		pdm:                     make(map[int]*list.List),
+		claimChanges:            newClaimChangeIndex(),
+		includeNamespaces:       []string{""},
+		aggregateFirstDataFlag:  true,
+	}
+	pod := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "default"},
+		Spec: core.PodSpec{Volumes: []core.Volume{
+			{Name: "data", VolumeSource: core.VolumeSource{PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}},
+		}},
+	}
+	// the microservice is reported before the claim is known
+	msd := MicroServiceData{Pod: pod, PodSpecId: 7, Storage: wh.getMicroServiceStorage(pod.Namespace, &pod.Spec)}
+	wh.pdm[7] = list.New()
+	wh.pdm[7].PushBack(msd)
+
+	pvc := &core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+		Spec:       core.PersistentVolumeClaimSpec{VolumeName: "pv-data"},
+	}
+	assert.NoError(t, wh.persistentVolumeClaimEventHandler(&watch.Event{Type: watch.Added, Object: pvc}, time.Time{}))
+	pv := &core.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-data"},
+		Spec: core.PersistentVolumeSpec{
+			PersistentVolumeSource: core.PersistentVolumeSource{CSI: &core.CSIPersistentVolumeSource{Driver: "ebs.csi.aws.com"}},
+			ClaimRef:               &core.ObjectReference{Namespace: "default", Name: "data"},
+		},
+	}
+	assert.NoError(t, wh.persistentVolumeEventHandler(&watch.Event{Type: watch.Added, Object: pv}, time.Time{}))
+	assert.Len(t, wh.claimChanges.changed, 1)
+	<-wh.claimChanges.changed
+	wh.refreshMicroServiceStorage(wh.claimChanges.takePending())
+
+	assert.Len(t, wh.jsonReport.MicroServices.Updated, 1)
+	expected := []MicroServiceVolume{{Name: "data", Type: volumeTypeCSI, ClaimName: "data", VolumeName: "pv-data", Driver: "ebs.csi.aws.com"}}
+	assert.Equal(t, expected, wh.jsonReport.MicroServices.Updated[0].(MicroServiceData).Storage)
+	assert.Equal(t, expected, wh.pdm[7].Front().Value.(MicroServiceData).Storage)
+
+	// nothing changed, nothing is reported
+	wh.refreshMicroServiceStorage(map[string]bool{"default/data": true})
+	assert.Len(t, wh.jsonReport.MicroServices.Updated, 1)
+}
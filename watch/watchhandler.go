@@ -13,8 +13,9 @@ import (
 	restclient "k8s.io/client-go/rest"
 
 	beClientV1 "github.com/kubescape/backend/pkg/client/v1"
-	apixv1beta1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
+	apixv1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -89,13 +90,16 @@ func (rm *resourceMap) indexLen(index int) int {
 }
 
 type WatchHandler struct {
-	extensionsClient apixv1beta1client.ApiextensionsV1beta1Interface
+	extensionsClient apixv1client.ApiextensionsV1Interface
 	RestAPIClient    kubernetes.Interface
 	K8sApi           *k8sinterface.KubernetesApi
 	WebSocketHandle  *WebSocketHandler
 	// cluster info
 	clusterAPIServerVersion *version.Info
-	cloudVendor             string
+	cloudMetadata           *CloudMetadata
+	cloudMetadataDetected   bool
+	clusterIdentity         *ClusterIdentity
+	clusterIdentityDetected bool
 	// pods list
 	pdm map[int]*list.List
 	// node list
@@ -108,6 +112,49 @@ type WatchHandler struct {
 	secretdm *resourceMap
 	// namespaces list
 	namespacedm *resourceMap
+	// persistent volumes list
+	persistentvolumedm *resourceMap
+	// persistent volume claims list
+	persistentvolumeclaimdm *resourceMap
+	// storage classes list
+	storageclassdm *resourceMap
+	// validating and mutating webhook configurations list
+	admissionwebhookdm *resourceMap
+	// resource quotas and limit ranges of the namespaces
+	namespaceGovernance *namespaceGovernanceStore
+	// horizontal pod autoscalers list
+	hpadm *resourceMap
+	// pod disruption budgets list
+	pdbdm *resourceMap
+	// certificate signing requests list
+	csrdm *resourceMap
+	// priority classes list
+	priorityclassdm *resourceMap
+	// runtime classes list
+	runtimeclassdm *resourceMap
+	// custom resource definitions list
+	crddm *resourceMap
+	// API resources served by the API server
+	apiResources *apiResourceDiscovery
+	// dynamic client, used for getting owners of any kind
+	dynamicClient dynamic.Interface
+	// dynamic watchers over configurable GroupVersionResources
+	customResources *customResourceCollector
+	// running pods to microservices, shared with the non-pod watchers
+	microServices *microServiceIndex
+	// microservice ids of the workloads, shared by the pod watcher and the workload watchers
+	workloadIDs *workloadIDIndex
+	// images of the running containers
+	images *imageInventory
+	// secrets referenced by the pods and the service accounts
+	secretUsage *secretUsageIndex
+	// persistent volume claims to resolve again in the microservices
+	claimChanges *claimChangeIndex
+	// resolved owners of the pods
+	ownerCache *ownerCache
+	// reported cluster events
+	events       *eventsStore
+	eventsFilter *eventsFilter
 
 	jsonReport             jsonFormat
 	informNewDataChannel   chan int
@@ -129,13 +176,20 @@ func CreateWatchHandler(config config.IConfig) (*WatchHandler, error) {
 		return nil, fmt.Errorf("failed to parse args: %s", err.Error())
 	}
 
+	if err := loadEnvReportPolicy(); err != nil {
+		return nil, err
+	}
+	if err := loadEnvHashKey(); err != nil {
+		return nil, err
+	}
+
 	// create the clientset
 	k8sAPiObj := k8sinterface.NewKubernetesApi()
 
 	restclient.SetDefaultWarningHandler(restclient.NoWarnings{})
-	extensionsClientSet, err := apixv1beta1client.NewForConfig(k8sinterface.GetK8sConfig())
+	extensionsClientSet, err := apixv1client.NewForConfig(k8sinterface.GetK8sConfig())
 	if err != nil {
-		return nil, fmt.Errorf("apiV1beta1client.NewForConfig failed: %s", err.Error())
+		return nil, fmt.Errorf("apixv1client.NewForConfig failed: %s", err.Error())
 	}
 
 	erURL, err := beClientV1.GetReporterClusterReportsWebsocketUrl(config.EventReceiverWebsocketURL(), config.AccountID(), config.ClusterName())
@@ -154,6 +208,29 @@ func CreateWatchHandler(config config.IConfig) (*WatchHandler, error) {
 		config:           config,
 		secretdm:         newResourceMap(),
 		namespacedm:      newResourceMap(),
+
+		persistentvolumedm:      newResourceMap(),
+		persistentvolumeclaimdm: newResourceMap(),
+		storageclassdm:          newResourceMap(),
+		admissionwebhookdm:      newResourceMap(),
+		namespaceGovernance:     newNamespaceGovernanceStore(),
+		hpadm:                   newResourceMap(),
+		pdbdm:                   newResourceMap(),
+		csrdm:                   newResourceMap(),
+		priorityclassdm:         newResourceMap(),
+		runtimeclassdm:          newResourceMap(),
+		crddm:                   newResourceMap(),
+		apiResources:            newAPIResourceDiscovery(k8sAPiObj.DiscoveryClient),
+		dynamicClient:           k8sAPiObj.DynamicClient,
+		customResources:         newCustomResourceCollector(k8sAPiObj.DynamicClient),
+		microServices:           newMicroServiceIndex(),
+		workloadIDs:             newWorkloadIDIndex(),
+		images:                  newImageInventory(),
+		secretUsage:             newSecretUsageIndex(),
+		claimChanges:            newClaimChangeIndex(),
+		ownerCache:              newOwnerCache(),
+		events:                  newEventsStore(),
+		eventsFilter:            newEventsFilter(),
 		jsonReport: jsonFormat{
 			FirstReport: true,
 		},
@@ -187,6 +264,23 @@ func (wh *WatchHandler) SetFirstReportFlag(first bool) {
 		wh.cjm = make(map[int]*list.List)
 		wh.secretdm = newResourceMap()
 		wh.namespacedm = newResourceMap()
+		wh.persistentvolumedm = newResourceMap()
+		wh.persistentvolumeclaimdm = newResourceMap()
+		wh.storageclassdm = newResourceMap()
+		wh.admissionwebhookdm = newResourceMap()
+		wh.namespaceGovernance = newNamespaceGovernanceStore()
+		wh.hpadm = newResourceMap()
+		wh.pdbdm = newResourceMap()
+		wh.csrdm = newResourceMap()
+		wh.priorityclassdm = newResourceMap()
+		wh.runtimeclassdm = newResourceMap()
+		wh.crddm = newResourceMap()
+		wh.microServices = newMicroServiceIndex()
+		wh.workloadIDs = newWorkloadIDIndex()
+		wh.images = newImageInventory()
+		wh.secretUsage = newSecretUsageIndex()
+		wh.claimChanges = newClaimChangeIndex()
+		wh.events = newEventsStore()
 		for chanIdx := range wh.newStateReportChans {
 			wh.newStateReportChans[chanIdx] <- true
 		}
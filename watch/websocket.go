@@ -8,6 +8,7 @@ import (
 	"os"
 	"runtime/debug"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -230,3 +231,18 @@ func getNumericValueFromEnvVar(envVar string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getStringSliceFromEnvVar returns the comma separated values of an environment variable
+func getStringSliceFromEnvVar(envVar string, defaultValue []string) []string {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return defaultValue
+	}
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,422 @@
+package watch
+
+import (
+	"runtime/debug"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"golang.org/x/net/context"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	RolloutStatusComplete     = "Complete"
+	RolloutStatusProgressing  = "Progressing"
+	RolloutStatusFailed       = "Failed"
+	RolloutStatusScaledToZero = "ScaledToZero"
+	RolloutStatusSuspended    = "Suspended"
+)
+
+// WorkloadStatus replicas, rollout status and conditions of a workload controller
+type WorkloadStatus struct {
+	DesiredReplicas   int32               `json:"desiredReplicas"`
+	Replicas          int32               `json:"replicas"`
+	ReadyReplicas     int32               `json:"readyReplicas"`
+	UpdatedReplicas   int32               `json:"updatedReplicas"`
+	AvailableReplicas int32               `json:"availableReplicas"`
+	Active            int32               `json:"active,omitempty"`
+	Succeeded         int32               `json:"succeeded,omitempty"`
+	Failed            int32               `json:"failed,omitempty"`
+	RolloutStatus     string              `json:"rolloutStatus"`
+	Conditions        []WorkloadCondition `json:"conditions,omitempty"`
+}
+
+type WorkloadCondition struct {
+	Type               string `json:"type"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+// workloadObject the parts of a workload controller which are reported as a microservice
+type workloadObject struct {
+	typeMeta   metav1.TypeMeta
+	objectMeta metav1.ObjectMeta
+	template   *core.PodTemplateSpec
+	status     *WorkloadStatus
+	owner      interface{}
+}
+
+// workloadIDIndex the microservice ids of the workloads by their UID, shared by the pod watcher and the workload watchers
+// so a workload is reported once, by whichever of them sees it first
+type workloadIDIndex struct {
+	mutex sync.Mutex
+	ids   map[string]int
+	// versions the last watched versions of the workloads, the status updates are not reported
+	versions map[string]ownerVersion
+}
+
+func newWorkloadIDIndex() *workloadIDIndex {
+	return &workloadIDIndex{ids: make(map[string]int), versions: make(map[string]ownerVersion)}
+}
+
+// observe stores the watched version of the workload and returns whether it changed since the last one,
+// a workload without a UID or a generation is always considered changed
+func (index *workloadIDIndex) observe(uid string, workload metav1.Object) bool {
+	if uid == "" || workload.GetGeneration() == 0 {
+		return true
+	}
+	version := newOwnerVersion(workload)
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if last, ok := index.versions[uid]; ok && last.equal(version) {
+		return false
+	}
+	index.versions[uid] = version
+	return true
+}
+
+// claim returns the id of the workload and whether it was already reported, the given id is assigned when it was not.
+// A workload without a UID is never shared
+func (index *workloadIDIndex) claim(uid string, id int) (int, bool) {
+	if uid == "" {
+		return id, false
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if reportedID, ok := index.ids[uid]; ok {
+		return reportedID, true
+	}
+	index.ids[uid] = id
+	return id, false
+}
+
+// release removes the workload and returns its id, false when it was already removed and should not be reported as deleted again
+func (index *workloadIDIndex) release(uid string) (int, bool) {
+	if uid == "" {
+		return 0, true
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	id, ok := index.ids[uid]
+	delete(index.ids, uid)
+	delete(index.versions, uid)
+	return id, ok
+}
+
+// ownerUID returns the UID of the owner data, empty when it is not a Kubernetes object
+func ownerUID(owner *OwnerDet) string {
+	if obj, ok := owner.OwnerData.(metav1.Object); ok {
+		return string(obj.GetUID())
+	}
+	return ""
+}
+
+// DeploymentWatch watch over deployments
+func (wh *WatchHandler) DeploymentWatch(ctx context.Context) {
+	wh.workloadWatch(ctx, "Deployment", func() (watch.Interface, error) {
+		return wh.RestAPIClient.AppsV1().Deployments("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+// StatefulSetWatch watch over statefulsets
+func (wh *WatchHandler) StatefulSetWatch(ctx context.Context) {
+	wh.workloadWatch(ctx, "StatefulSet", func() (watch.Interface, error) {
+		return wh.RestAPIClient.AppsV1().StatefulSets("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+// DaemonSetWatch watch over daemonsets
+func (wh *WatchHandler) DaemonSetWatch(ctx context.Context) {
+	wh.workloadWatch(ctx, "DaemonSet", func() (watch.Interface, error) {
+		return wh.RestAPIClient.AppsV1().DaemonSets("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+// JobWatch watch over jobs. Jobs created by a CronJob are reported by the CronJobWatch
+func (wh *WatchHandler) JobWatch(ctx context.Context) {
+	wh.workloadWatch(ctx, "Job", func() (watch.Interface, error) {
+		return wh.RestAPIClient.BatchV1().Jobs("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+	})
+}
+
+func (wh *WatchHandler) workloadWatch(ctx context.Context, kind string, watchFunc func() (watch.Interface, error)) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER workloadWatch", helpers.String("kind", kind), helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	var lastWatchEventCreationTime time.Time
+	newStateChan := make(chan bool)
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	for {
+		logger.L().Info("Watching over workloads starting", helpers.String("kind", kind))
+		workloadWatcher, err := watchFunc()
+		if err != nil {
+			logger.L().Ctx(ctx).Error("Cannot watch over workloads", helpers.String("kind", kind), helpers.Error(err))
+			time.Sleep(3 * time.Second)
+			continue
+		}
+		wh.handleWorkloadWatch(ctx, kind, workloadWatcher, newStateChan, &lastWatchEventCreationTime)
+
+		logger.L().Info("Watching over workloads ended - since we got timeout", helpers.String("kind", kind))
+	}
+}
+
+func (wh *WatchHandler) handleWorkloadWatch(ctx context.Context, kind string, workloadWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
+	workloadChan := workloadWatcher.ResultChan()
+	logger.L().Info("Watching over workloads started", helpers.String("kind", kind))
+	for {
+		var event watch.Event
+		var ok bool
+		select {
+		case event, ok = <-workloadChan:
+		case <-newStateChan:
+			workloadWatcher.Stop()
+			*lastWatchEventCreationTime = time.Now()
+			return
+		}
+		if !ok {
+			workloadWatcher.Stop()
+			*lastWatchEventCreationTime = time.Now()
+			return
+		}
+		if event.Type == watch.Error {
+			logger.L().Ctx(ctx).Error("workload watch chan loop", helpers.String("kind", kind), helpers.Interface("error", event.Object))
+			workloadWatcher.Stop()
+			*lastWatchEventCreationTime = time.Now()
+			return
+		}
+		workload, ok := newWorkloadObject(event.Object)
+		if !ok {
+			workloadWatcher.Stop()
+			*lastWatchEventCreationTime = time.Now()
+			return
+		}
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			wh.ownerCache.update(&workload.objectMeta)
+		case watch.Deleted:
+			wh.ownerCache.remove(workload.objectMeta.UID)
+		}
+		if !wh.isNamespaceWatched(workload.objectMeta.Namespace) {
+			continue
+		}
+		if isOwnedByKind(&workload.objectMeta, "CronJob") {
+			continue
+		}
+		uid := string(workload.objectMeta.GetUID())
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			changed := wh.workloadIDs.observe(uid, &workload.objectMeta)
+			if event.Type == watch.Added && workload.objectMeta.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
+				logger.L().Debug("workload already exist, will not be reported", helpers.String("kind", kind), helpers.String("name", workload.objectMeta.Name))
+				continue
+			}
+			// only the status of the workload is changed, e.g. its replicas became ready
+			if event.Type == watch.Modified && !changed {
+				continue
+			}
+			// the workload may be reported already by the pod watcher, e.g. when its pods are running
+			id, reported := wh.workloadIDs.claim(uid, CreateID())
+			action := CREATED
+			if reported {
+				action = UPDATED
+			}
+			wh.jsonReport.AddToJsonFormat(wh.workloadToMicroServiceData(workload, id), MICROSERVICES, action)
+			informNewDataArrive(wh)
+		case watch.Deleted:
+			id, reported := wh.workloadIDs.release(uid)
+			if !reported {
+				continue
+			}
+			wh.jsonReport.AddToJsonFormat(wh.workloadToMicroServiceData(workload, id), MICROSERVICES, DELETED)
+			informNewDataArrive(wh)
+		case watch.Bookmark: //only the resource version is changed but it's the same workload
+			continue
+		}
+	}
+}
+
+func (wh *WatchHandler) workloadToMicroServiceData(workload *workloadObject, id int) MicroServiceData {
+	od := OwnerDet{
+		Name:      workload.objectMeta.Name,
+		Kind:      workload.typeMeta.Kind,
+		OwnerData: workload.owner,
+	}
+	return MicroServiceData{
+		Pod:            &core.Pod{Spec: workload.template.Spec, TypeMeta: workload.typeMeta, ObjectMeta: workload.objectMeta},
+		Owner:          od,
+		PodSpecId:      id,
+		Storage:        wh.getMicroServiceStorage(workload.objectMeta.Namespace, &workload.template.Spec),
+		WorkloadStatus: workload.status,
+	}
+}
+
+// newWorkloadObject converts a watched workload controller to a workloadObject
+func newWorkloadObject(obj interface{}) (*workloadObject, bool) {
+	var workload *workloadObject
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		o.TypeMeta = metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"}
+		workload = &workloadObject{typeMeta: o.TypeMeta, objectMeta: o.ObjectMeta, template: &o.Spec.Template, status: deploymentStatus(o), owner: o}
+	case *appsv1.StatefulSet:
+		o.TypeMeta = metav1.TypeMeta{Kind: "StatefulSet", APIVersion: "apps/v1"}
+		workload = &workloadObject{typeMeta: o.TypeMeta, objectMeta: o.ObjectMeta, template: &o.Spec.Template, status: statefulSetStatus(o), owner: o}
+	case *appsv1.DaemonSet:
+		o.TypeMeta = metav1.TypeMeta{Kind: "DaemonSet", APIVersion: "apps/v1"}
+		workload = &workloadObject{typeMeta: o.TypeMeta, objectMeta: o.ObjectMeta, template: &o.Spec.Template, status: daemonSetStatus(o), owner: o}
+	case *batchv1.Job:
+		o.TypeMeta = metav1.TypeMeta{Kind: "Job", APIVersion: "batch/v1"}
+		workload = &workloadObject{typeMeta: o.TypeMeta, objectMeta: o.ObjectMeta, template: &o.Spec.Template, status: jobStatus(o), owner: o}
+	default:
+		return nil, false
+	}
+	workload.objectMeta.ManagedFields = []metav1.ManagedFieldsEntry{}
+	if ownerMeta, ok := workload.owner.(metav1.Object); ok {
+		ownerMeta.SetManagedFields([]metav1.ManagedFieldsEntry{})
+	}
+	return workload, true
+}
+
+func isOwnedByKind(meta *metav1.ObjectMeta, kind string) bool {
+	for i := range meta.OwnerReferences {
+		if meta.OwnerReferences[i].Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func deploymentStatus(deployment *appsv1.Deployment) *WorkloadStatus {
+	status := &WorkloadStatus{
+		DesiredReplicas:   1,
+		Replicas:          deployment.Status.Replicas,
+		ReadyReplicas:     deployment.Status.ReadyReplicas,
+		UpdatedReplicas:   deployment.Status.UpdatedReplicas,
+		AvailableReplicas: deployment.Status.AvailableReplicas,
+	}
+	if deployment.Spec.Replicas != nil {
+		status.DesiredReplicas = *deployment.Spec.Replicas
+	}
+	for _, c := range deployment.Status.Conditions {
+		status.Conditions = append(status.Conditions, WorkloadCondition{Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Message: c.Message, LastTransitionTime: formatConditionTime(c.LastTransitionTime)})
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			status.RolloutStatus = RolloutStatusFailed
+		}
+	}
+	if status.RolloutStatus != "" {
+		return status
+	}
+	switch {
+	case deployment.Status.ObservedGeneration < deployment.Generation:
+		status.RolloutStatus = RolloutStatusProgressing
+	case status.DesiredReplicas == 0 && status.Replicas == 0:
+		status.RolloutStatus = RolloutStatusScaledToZero
+	case status.UpdatedReplicas == status.DesiredReplicas && status.Replicas == status.DesiredReplicas && status.AvailableReplicas == status.DesiredReplicas:
+		status.RolloutStatus = RolloutStatusComplete
+	default:
+		status.RolloutStatus = RolloutStatusProgressing
+	}
+	return status
+}
+
+func statefulSetStatus(statefulSet *appsv1.StatefulSet) *WorkloadStatus {
+	status := &WorkloadStatus{
+		DesiredReplicas:   1,
+		Replicas:          statefulSet.Status.Replicas,
+		ReadyReplicas:     statefulSet.Status.ReadyReplicas,
+		UpdatedReplicas:   statefulSet.Status.UpdatedReplicas,
+		AvailableReplicas: statefulSet.Status.AvailableReplicas,
+	}
+	if statefulSet.Spec.Replicas != nil {
+		status.DesiredReplicas = *statefulSet.Spec.Replicas
+	}
+	for _, c := range statefulSet.Status.Conditions {
+		status.Conditions = append(status.Conditions, WorkloadCondition{Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Message: c.Message, LastTransitionTime: formatConditionTime(c.LastTransitionTime)})
+	}
+	switch {
+	case statefulSet.Status.ObservedGeneration < statefulSet.Generation:
+		status.RolloutStatus = RolloutStatusProgressing
+	case status.DesiredReplicas == 0 && status.Replicas == 0:
+		status.RolloutStatus = RolloutStatusScaledToZero
+	case statefulSet.Status.UpdateRevision != "" && statefulSet.Status.UpdateRevision != statefulSet.Status.CurrentRevision:
+		status.RolloutStatus = RolloutStatusProgressing
+	case status.ReadyReplicas == status.DesiredReplicas:
+		status.RolloutStatus = RolloutStatusComplete
+	default:
+		status.RolloutStatus = RolloutStatusProgressing
+	}
+	return status
+}
+
+func daemonSetStatus(daemonSet *appsv1.DaemonSet) *WorkloadStatus {
+	status := &WorkloadStatus{
+		DesiredReplicas:   daemonSet.Status.DesiredNumberScheduled,
+		Replicas:          daemonSet.Status.CurrentNumberScheduled,
+		ReadyReplicas:     daemonSet.Status.NumberReady,
+		UpdatedReplicas:   daemonSet.Status.UpdatedNumberScheduled,
+		AvailableReplicas: daemonSet.Status.NumberAvailable,
+	}
+	for _, c := range daemonSet.Status.Conditions {
+		status.Conditions = append(status.Conditions, WorkloadCondition{Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Message: c.Message, LastTransitionTime: formatConditionTime(c.LastTransitionTime)})
+	}
+	switch {
+	case daemonSet.Status.ObservedGeneration < daemonSet.Generation:
+		status.RolloutStatus = RolloutStatusProgressing
+	case status.DesiredReplicas == 0:
+		status.RolloutStatus = RolloutStatusScaledToZero
+	case status.UpdatedReplicas == status.DesiredReplicas && status.AvailableReplicas == status.DesiredReplicas:
+		status.RolloutStatus = RolloutStatusComplete
+	default:
+		status.RolloutStatus = RolloutStatusProgressing
+	}
+	return status
+}
+
+func jobStatus(job *batchv1.Job) *WorkloadStatus {
+	status := &WorkloadStatus{
+		DesiredReplicas: 1,
+		Replicas:        job.Status.Active,
+		Active:          job.Status.Active,
+		Succeeded:       job.Status.Succeeded,
+		Failed:          job.Status.Failed,
+	}
+	if job.Spec.Completions != nil {
+		status.DesiredReplicas = *job.Spec.Completions
+	}
+	if job.Status.Ready != nil {
+		status.ReadyReplicas = *job.Status.Ready
+	}
+	status.RolloutStatus = RolloutStatusProgressing
+	if job.Spec.Suspend != nil && *job.Spec.Suspend {
+		status.RolloutStatus = RolloutStatusSuspended
+	}
+	for _, c := range job.Status.Conditions {
+		status.Conditions = append(status.Conditions, WorkloadCondition{Type: string(c.Type), Status: string(c.Status), Reason: c.Reason, Message: c.Message, LastTransitionTime: formatConditionTime(c.LastTransitionTime)})
+		if c.Status != core.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			status.RolloutStatus = RolloutStatusComplete
+		case batchv1.JobFailed:
+			status.RolloutStatus = RolloutStatusFailed
+		}
+	}
+	return status
+}
+
+func formatConditionTime(t metav1.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,162 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestDeploymentStatus(t *testing.T) {
+	zero := int32(0)
+	three := int32(3)
+	testCases := []struct {
+		name       string
+		deployment appsv1.Deployment
+		expected   string
+	}{
+		{
+			name: "scaled to zero",
+			deployment: appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{Replicas: &zero},
+			},
+			expected: RolloutStatusScaledToZero,
+		},
+		{
+			name: "complete",
+			deployment: appsv1.Deployment{
+				Spec:   appsv1.DeploymentSpec{Replicas: &three},
+				Status: appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3, ReadyReplicas: 3},
+			},
+			expected: RolloutStatusComplete,
+		},
+		{
+			name: "unschedulable pods",
+			deployment: appsv1.Deployment{
+				Spec:   appsv1.DeploymentSpec{Replicas: &three},
+				Status: appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3},
+			},
+			expected: RolloutStatusProgressing,
+		},
+		{
+			name: "new generation not observed",
+			deployment: appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Generation: 2},
+				Spec:       appsv1.DeploymentSpec{Replicas: &three},
+				Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 3},
+			},
+			expected: RolloutStatusProgressing,
+		},
+		{
+			name: "progress deadline exceeded",
+			deployment: appsv1.Deployment{
+				Spec: appsv1.DeploymentSpec{Replicas: &three},
+				Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+					{Type: appsv1.DeploymentProgressing, Status: core.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+				}},
+			},
+			expected: RolloutStatusFailed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, deploymentStatus(&tc.deployment).RolloutStatus)
+		})
+	}
+}
+
+func TestJobStatus(t *testing.T) {
+	job := batchv1.Job{
+		Status: batchv1.JobStatus{
+			Succeeded:  1,
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: core.ConditionTrue}},
+		},
+	}
+	status := jobStatus(&job)
+	assert.Equal(t, RolloutStatusComplete, status.RolloutStatus)
+	assert.Equal(t, int32(1), status.Succeeded)
+	assert.Len(t, status.Conditions, 1)
+}
+
+func TestNewWorkloadObject(t *testing.T) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:            "nightly-123",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "CronJob", Name: "nightly"}},
+		ManagedFields:   []metav1.ManagedFieldsEntry{{Manager: "kube-controller-manager"}},
+	}}
+	workload, ok := newWorkloadObject(job)
+	assert.True(t, ok)
+	assert.Equal(t, "Job", workload.typeMeta.Kind)
+	assert.Empty(t, workload.objectMeta.ManagedFields)
+	assert.True(t, isOwnedByKind(&workload.objectMeta, "CronJob"))
+
+	_, ok = newWorkloadObject(&core.Pod{})
+	assert.False(t, ok)
+}
+
+func TestHandleWorkloadWatchSharesIDsWithPods(t *testing.T) {
+	wh := &WatchHandler{
+		workloadIDs:            newWorkloadIDIndex(),
+		ownerCache:             newOwnerCache(),
+		includeNamespaces:      []string{""},
+		aggregateFirstDataFlag: true,
+	}
+	// the pods of the first deployment were reported by the pod watcher
+	podReported := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "default", UID: types.UID("frontend-uid")}}
+	scaledToZero := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "backend", Namespace: "default", UID: types.UID("backend-uid")}}
+	id, reported := wh.workloadIDs.claim(ownerUID(&OwnerDet{OwnerData: podReported}), 7)
+	assert.Equal(t, 7, id)
+	assert.False(t, reported)
+
+	watcher := watch.NewFakeWithChanSize(4, false)
+	watcher.Add(podReported)
+	watcher.Add(scaledToZero)
+	watcher.Delete(podReported)
+	watcher.Stop()
+	wh.handleWorkloadWatch(context.Background(), "Deployment", watcher, make(chan bool), &time.Time{})
+
+	assert.Len(t, wh.jsonReport.MicroServices.Created, 1)
+	assert.Equal(t, "backend", wh.jsonReport.MicroServices.Created[0].(MicroServiceData).Owner.Name)
+	assert.Len(t, wh.jsonReport.MicroServices.Updated, 1)
+	assert.Equal(t, 7, wh.jsonReport.MicroServices.Updated[0].(MicroServiceData).PodSpecId)
+	assert.Len(t, wh.jsonReport.MicroServices.Deleted, 1)
+	assert.Equal(t, 7, wh.jsonReport.MicroServices.Deleted[0].(MicroServiceData).PodSpecId)
+
+	// the pod watcher does not report the deleted workload again
+	_, reported = wh.workloadIDs.release("frontend-uid")
+	assert.False(t, reported)
+	_, reported = wh.workloadIDs.claim("backend-uid", 8)
+	assert.True(t, reported)
+}
+
+func TestHandleWorkloadWatchSkipsStatusUpdates(t *testing.T) {
+	wh := &WatchHandler{
+		workloadIDs:            newWorkloadIDIndex(),
+		ownerCache:             newOwnerCache(),
+		includeNamespaces:      []string{""},
+		aggregateFirstDataFlag: true,
+	}
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "frontend", Namespace: "default", UID: types.UID("frontend-uid"), Generation: 1}}
+	statusUpdated := deployment.DeepCopy()
+	statusUpdated.Status.ReadyReplicas = 2
+	specUpdated := statusUpdated.DeepCopy()
+	specUpdated.Generation = 2
+
+	watcher := watch.NewFakeWithChanSize(4, false)
+	watcher.Add(deployment)
+	watcher.Modify(statusUpdated)
+	watcher.Modify(specUpdated)
+	watcher.Stop()
+	wh.handleWorkloadWatch(context.Background(), "Deployment", watcher, make(chan bool), &time.Time{})
+
+	assert.Len(t, wh.jsonReport.MicroServices.Created, 1)
+	assert.Len(t, wh.jsonReport.MicroServices.Updated, 1)
+	assert.True(t, watcher.IsStopped())
+}